@@ -4,7 +4,7 @@ package arch
  * Datatype to describe the architecture of a simple emulator.
  */
 type Arch interface {
-	LoadGame(filepath string)
+	LoadGame(filepath string, patchPaths ...string) error
 	Run() // Returns when game or user quits.
 	Quit()
 }
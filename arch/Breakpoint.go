@@ -0,0 +1,62 @@
+package arch
+
+import (
+	"fmt"
+	"io"
+)
+
+/**
+ * Datatype to describe a breakpoint at an address. It only counts as hit
+ * when its condition (if any) is true, and only stops once it has been
+ * hit more times than it ignores. A tracepoint is a breakpoint with a
+ * message, which it prints instead of stopping.
+ */
+type Breakpoint struct {
+	Addr    uint16
+	Cond    *Expr // Always hit if nil.
+	Ignore  int   // Number of hits to pass through before stopping.
+	Hits    int
+	Message string // If set, print this instead of stopping.
+}
+
+// Matches returns whether the breakpoint's condition holds.
+// A condition that can't be evaluated counts as true, so it gets noticed.
+func (bp *Breakpoint) Matches(c8 *Chip8) bool {
+	if bp.Cond == nil {
+		return true
+	}
+	matches, err := bp.Cond.True(c8)
+	return matches || err != nil
+}
+
+// Hit counts a pass over the breakpoint, printing to w if it is a
+// tracepoint, and returns whether to stop.
+func (bp *Breakpoint) Hit(c8 *Chip8, w io.Writer) bool {
+	if !bp.Matches(c8) {
+		return false
+	}
+	bp.Hits++
+	if bp.Hits <= bp.Ignore {
+		return false
+	}
+	if bp.Message != "" {
+		fmt.Fprintf(w, "%03X: %v\n", bp.Addr, FormatMessage(c8, bp.Message))
+		return false
+	}
+	return true
+}
+
+func (bp *Breakpoint) String() string {
+	kind := "break"
+	if bp.Message != "" {
+		kind = fmt.Sprintf("trace %q", bp.Message)
+	}
+	desc := fmt.Sprintf("%03X: %v, hit %v times", bp.Addr, kind, bp.Hits)
+	if bp.Cond != nil {
+		desc += fmt.Sprintf(", if %v", bp.Cond)
+	}
+	if bp.Ignore > bp.Hits {
+		desc += fmt.Sprintf(", ignoring %v more", bp.Ignore-bp.Hits)
+	}
+	return desc
+}
@@ -0,0 +1,350 @@
+package arch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/**
+ * Datatype to describe the cheat engine: named cheats loaded from a
+ * per-ROM cheat file, freezes that hold a location at a fixed value
+ * every frame, and an iterative search for interesting memory addresses.
+ */
+type Cheats struct {
+	Named   []*Cheat
+	Freezes []Freeze // Freezes added by hand, outside of any named cheat.
+	Search  *MemorySearch
+}
+
+type Cheat struct {
+	Name    string
+	Freezes []Freeze
+	Enabled bool
+}
+
+type Freeze struct {
+	Loc   Location
+	Value uint16
+}
+
+func MakeCheats() *Cheats {
+	return &Cheats{}
+}
+
+// CheatFilePath returns where the cheat file for a ROM is kept.
+func CheatFilePath(romPath string) string {
+	return romPath + ".cheats"
+}
+
+// LoadCheats reads a cheat file. Each line names a cheat, followed by
+// a colon and the freezes it applies, for example:
+//
+//	# Comments start with a hash.
+//	Infinite lives: V3=3
+//	Start at level 5: 2F0=5, 2F1=0x10
+//
+// Cheats from the file start out disabled.
+func LoadCheats(filePath string) (*Cheats, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cheats := MakeCheats()
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, freezeList, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%v:%v: expected \"name: freezes\"", filePath, lineNum)
+		}
+		cheat := &Cheat{Name: strings.TrimSpace(name)}
+		for _, spec := range strings.Split(freezeList, ",") {
+			freeze, err := ParseFreeze(strings.TrimSpace(spec))
+			if err != nil {
+				return nil, fmt.Errorf("%v:%v: %v", filePath, lineNum, err)
+			}
+			cheat.Freezes = append(cheat.Freezes, freeze)
+		}
+		cheats.Named = append(cheats.Named, cheat)
+	}
+	return cheats, scanner.Err()
+}
+
+// ParseFreeze parses a freeze of the form "location=value".
+func ParseFreeze(spec string) (Freeze, error) {
+	locSpec, valueSpec, found := strings.Cut(spec, "=")
+	if !found {
+		return Freeze{}, fmt.Errorf("expected \"location=value\", got %q", spec)
+	}
+	loc, err := ParseLocation(strings.TrimSpace(locSpec))
+	if err != nil {
+		return Freeze{}, err
+	}
+	value, err := ParseValue(strings.TrimSpace(valueSpec))
+	if err != nil {
+		return Freeze{}, err
+	}
+	return Freeze{loc, value}, nil
+}
+
+// Apply writes every active freeze into the machine. It is run once per frame.
+func (cheats *Cheats) Apply(c8 *Chip8) {
+	for _, cheat := range cheats.Named {
+		if cheat.Enabled {
+			for _, freeze := range cheat.Freezes {
+				c8.Set(freeze.Loc, freeze.Value)
+			}
+		}
+	}
+	for _, freeze := range cheats.Freezes {
+		c8.Set(freeze.Loc, freeze.Value)
+	}
+}
+
+// Active returns true if any freeze would be applied.
+func (cheats *Cheats) Active() bool {
+	for _, cheat := range cheats.Named {
+		if cheat.Enabled {
+			return true
+		}
+	}
+	return len(cheats.Freezes) > 0
+}
+
+func (cheats *Cheats) Freeze(loc Location, value uint16) {
+	cheats.Unfreeze(loc)
+	cheats.Freezes = append(cheats.Freezes, Freeze{loc, value})
+}
+
+func (cheats *Cheats) Unfreeze(loc Location) {
+	kept := cheats.Freezes[:0]
+	for _, freeze := range cheats.Freezes {
+		if freeze.Loc != loc {
+			kept = append(kept, freeze)
+		}
+	}
+	cheats.Freezes = kept
+}
+
+// Finds a named cheat by its number (starting at 1) or its name.
+func (cheats *Cheats) find(nameOrNum string) *Cheat {
+	for num, cheat := range cheats.Named {
+		if nameOrNum == fmt.Sprint(num+1) || strings.EqualFold(nameOrNum, cheat.Name) {
+			return cheat
+		}
+	}
+	return nil
+}
+
+func (cheats *Cheats) List(w io.Writer) {
+	if len(cheats.Named) == 0 && len(cheats.Freezes) == 0 {
+		fmt.Fprintf(w, "No cheats loaded.\n")
+	}
+	for num, cheat := range cheats.Named {
+		fmt.Fprintf(w, "%v. [%v] %v: %v\n", num+1, onOff(cheat.Enabled), cheat.Name,
+			formatFreezes(cheat.Freezes))
+	}
+	if len(cheats.Freezes) > 0 {
+		fmt.Fprintf(w, "Frozen: %v\n", formatFreezes(cheats.Freezes))
+	}
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+func formatFreezes(freezes []Freeze) string {
+	specs := []string{}
+	for _, freeze := range freezes {
+		specs = append(specs, fmt.Sprintf("%v=%v", freeze.Loc, freeze.Value))
+	}
+	return strings.Join(specs, ", ")
+}
+
+const cheatHelp = `Cheat commands:
+  cheats                   List cheats and freezes.
+  cheat NAME|NUM [on|off]  Toggle, enable or disable a named cheat.
+  freeze LOC VALUE         Hold LOC (V0-VF, I, DT, ST or a hex address) at VALUE.
+  unfreeze LOC             Stop holding LOC.
+  search start             Snapshot memory to begin a new search.
+  search equal VALUE       Keep addresses holding VALUE.
+  search changed|unchanged|increased|decreased
+                           Keep addresses that changed that way since the last search.
+  search list              Show the remaining addresses.
+`
+
+// Exec runs a cheat command, given as a list of words. It returns false
+// if the words aren't a cheat command at all.
+func (cheats *Cheats) Exec(c8 *Chip8, args []string, w io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case "cheats":
+		cheats.List(w)
+	case "cheat":
+		if len(args) < 2 || len(args) > 3 {
+			return true, fmt.Errorf("usage: cheat NAME|NUM [on|off]")
+		}
+		cheat := cheats.find(args[1])
+		if cheat == nil {
+			return true, fmt.Errorf("no cheat named %q", args[1])
+		}
+		switch {
+		case len(args) == 2:
+			cheat.Enabled = !cheat.Enabled
+		case args[2] == "on":
+			cheat.Enabled = true
+		case args[2] == "off":
+			cheat.Enabled = false
+		default:
+			return true, fmt.Errorf("usage: cheat NAME|NUM [on|off]")
+		}
+		fmt.Fprintf(w, "Cheat %q is %v.\n", cheat.Name, onOff(cheat.Enabled))
+	case "freeze":
+		if len(args) != 3 {
+			return true, fmt.Errorf("usage: freeze LOC VALUE")
+		}
+		freeze, err := ParseFreeze(args[1] + "=" + args[2])
+		if err != nil {
+			return true, err
+		}
+		cheats.Freeze(freeze.Loc, freeze.Value)
+		c8.Set(freeze.Loc, freeze.Value)
+		fmt.Fprintf(w, "Froze %v at %v.\n", freeze.Loc, freeze.Value)
+	case "unfreeze":
+		if len(args) != 2 {
+			return true, fmt.Errorf("usage: unfreeze LOC")
+		}
+		loc, err := ParseLocation(args[1])
+		if err != nil {
+			return true, err
+		}
+		cheats.Unfreeze(loc)
+		fmt.Fprintf(w, "Unfroze %v.\n", loc)
+	case "search":
+		return true, cheats.execSearch(c8, args[1:], w)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (cheats *Cheats) execSearch(c8 *Chip8, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: search start|equal VALUE|changed|unchanged|increased|decreased|list")
+	}
+	if args[0] == "start" {
+		cheats.Search = MakeMemorySearch(c8)
+		fmt.Fprintf(w, "Search started with %v addresses.\n", len(cheats.Search.Candidates))
+		return nil
+	}
+	if cheats.Search == nil {
+		return fmt.Errorf("no search in progress; use \"search start\" first")
+	}
+	if args[0] == "list" {
+		cheats.Search.List(c8, w)
+		return nil
+	}
+
+	value := uint16(0)
+	if args[0] == "equal" {
+		if len(args) != 2 {
+			return fmt.Errorf("usage: search equal VALUE")
+		}
+		var err error
+		if value, err = ParseValue(args[1]); err != nil {
+			return err
+		}
+	}
+	if err := cheats.Search.Filter(c8, SearchComparison(args[0]), uint8(value)); err != nil {
+		return err
+	}
+	cheats.Search.List(c8, w)
+	return nil
+}
+
+/**
+ * Datatype to describe an iterative search of memory. Each pass compares
+ * memory against the snapshot taken on the previous pass, and keeps only
+ * the candidate addresses that match.
+ */
+type MemorySearch struct {
+	Candidates []uint16
+	Snapshot   [4096]uint8
+}
+
+type SearchComparison string
+
+const (
+	SearchEqual     SearchComparison = "equal"
+	SearchChanged   SearchComparison = "changed"
+	SearchUnchanged SearchComparison = "unchanged"
+	SearchIncreased SearchComparison = "increased"
+	SearchDecreased SearchComparison = "decreased"
+)
+
+// Maximum number of candidates to print when listing search results.
+const searchListLimit = 20
+
+func MakeMemorySearch(c8 *Chip8) *MemorySearch {
+	search := MemorySearch{}
+	for addr := range c8.Memory {
+		search.Candidates = append(search.Candidates, uint16(addr))
+	}
+	search.Snapshot = c8.Memory
+	return &search
+}
+
+func (search *MemorySearch) Filter(c8 *Chip8, cmp SearchComparison, value uint8) error {
+	var keep func(old, new uint8) bool
+	switch cmp {
+	case SearchEqual:
+		keep = func(old, new uint8) bool { return new == value }
+	case SearchChanged:
+		keep = func(old, new uint8) bool { return new != old }
+	case SearchUnchanged:
+		keep = func(old, new uint8) bool { return new == old }
+	case SearchIncreased:
+		keep = func(old, new uint8) bool { return new > old }
+	case SearchDecreased:
+		keep = func(old, new uint8) bool { return new < old }
+	default:
+		return fmt.Errorf("unknown search comparison %q", cmp)
+	}
+
+	kept := search.Candidates[:0]
+	for _, addr := range search.Candidates {
+		if keep(search.Snapshot[addr], c8.Memory[addr]) {
+			kept = append(kept, addr)
+		}
+	}
+	search.Candidates = kept
+	search.Snapshot = c8.Memory
+	return nil
+}
+
+func (search *MemorySearch) List(c8 *Chip8, w io.Writer) {
+	fmt.Fprintf(w, "%v addresses match.\n", len(search.Candidates))
+	addrs := append([]uint16{}, search.Candidates...)
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	if len(addrs) > searchListLimit {
+		return
+	}
+	for _, addr := range addrs {
+		fmt.Fprintf(w, "  %03X = %v\n", addr, c8.Memory[addr])
+	}
+}
@@ -0,0 +1,94 @@
+package arch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheatFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GAME.cheats")
+	contents := "# Test cheats.\nInfinite lives: V3=3\nLevel select: 2F0=5, I=0x300\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cheats, err := LoadCheats(path)
+	if err != nil {
+		t.Fatalf("Could not load cheats! Error was: %v\n", err)
+	}
+	if len(cheats.Named) != 2 || cheats.Named[1].Name != "Level select" {
+		t.Fatalf("Cheats were not parsed correctly! Cheats were %+v\n", cheats.Named)
+	}
+
+	c8 := MakeChip8(false)
+	c8.Cheats = cheats
+	out := bytes.Buffer{}
+	if _, err := cheats.Exec(c8, []string{"cheat", "level select"}, &out); err != nil {
+		t.Fatalf("Could not enable cheat! Error was: %v\n", err)
+	}
+	cheats.Apply(c8)
+
+	if c8.Memory[0x2F0] != 5 || c8.IndexReg != 0x300 {
+		t.Errorf("Enabled cheat was not applied!\n")
+	} else if c8.Registers[3] != 0 {
+		t.Errorf("Disabled cheat was applied!\n")
+	}
+}
+
+func TestMemorySearch(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.Memory[0x300] = 3 // Lives.
+	c8.Memory[0x301] = 3 // Something else.
+
+	out := bytes.Buffer{}
+	run := func(command string) {
+		if _, err := c8.Cheats.Exec(c8, strings.Fields(command), &out); err != nil {
+			t.Fatalf("Command %q failed! Error was: %v\n", command, err)
+		}
+	}
+
+	run("search start")
+	run("search equal 3")
+	c8.Memory[0x300] = 2 // Lose a life.
+	run("search decreased")
+
+	candidates := c8.Cheats.Search.Candidates
+	if len(candidates) != 1 || candidates[0] != 0x300 {
+		t.Fatalf("Search did not find the lives counter! Candidates were %X\n",
+			candidates)
+	}
+
+	// Freezing the address should hold it every frame.
+	run("freeze 300 9")
+	c8.Memory[0x300] = 1
+	c8.Cheats.Apply(c8)
+	if c8.Memory[0x300] != 9 {
+		t.Errorf("Frozen address was not held! Val was %v\n", c8.Memory[0x300])
+	}
+	run("unfreeze 300")
+	c8.Memory[0x300] = 1
+	c8.Cheats.Apply(c8)
+	if c8.Memory[0x300] != 1 {
+		t.Errorf("Unfrozen address was still held!\n")
+	}
+}
+
+func TestDebuggerCheatCommands(t *testing.T) {
+	c8 := MakeChip8(false)
+	out := bytes.Buffer{}
+	d := MakeDebugger(strings.NewReader(""), &out)
+
+	d.Exec(c8, "freeze V2 0x10")
+	c8.Cheats.Apply(c8)
+	if c8.Registers[2] != 0x10 {
+		t.Errorf("Debugger freeze was not applied! Val was %v\n", c8.Registers[2])
+	}
+
+	d.Exec(c8, "bogus")
+	if !strings.Contains(out.String(), "unknown command") {
+		t.Errorf("Debugger accepted an unknown command! Output was: %v\n", out.String())
+	}
+}
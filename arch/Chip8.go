@@ -2,10 +2,11 @@ package arch
 
 import (
 	"fmt"
-	"io"
 	"jugonz/chip8/gfx"
+	"jugonz/chip8/patch"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -31,13 +32,46 @@ type Chip8 struct {
 	Screen     gfx.Drawable
 	Fontset    [80]uint8
 	DrawFlag   bool // True if we just drew to the screen.
+	Paused     bool // True if Run should stop emulating until resumed.
+	SlowMotion bool // True if Run should emulate at SlowMotionSpeed.
+	Mute       bool // True to not ring the terminal bell for sound.
+	Stop       bool // True if Run should return, as if the window was closed.
+	Cheats     *Cheats
+	HeldKeys   [16]bool             // Keys held down by remote control, as well as the keypad.
+	Quirks     Quirks               // Which interpreter's behavior to copy for ambiguous instructions.
+	Tasks      chan func(c8 *Chip8) // Run between frames if non-nil, for remote control.
+	Fault      *Fault               // What paused the machine, if it faulted, until the next cycle.
+
+	// Fast-forward runs at FastForward times normal speed (DefaultFastForward
+	// if 0) while FastForwarding is true or the hotkey is held.
+	FastForward     float64
+	FastForwarding  bool
+	fastForwardHeld bool
+	frameCredit     float64 // Frames due to be emulated, at the current speed.
+	shownStatus     string  // Status last shown on the screen.
 
 	// Debug components.
 	Debug     bool
 	Count     int
 	CycleRate time.Duration
+	Profiler  *Profiler // Records every cycle if non-nil.
+	Coverage  *Coverage // Records every memory access if non-nil.
+	RomSize   int       // Size of the loaded game in bytes.
+	Debugger  *Debugger // Takes commands between frames if non-nil.
+	Rewind    *Rewind   // Records every frame if non-nil.
+	History   *History  // Records every cycle for time travel if non-nil.
+	Menu      *Menu     // Lets the player switch games if non-nil.
+	Cycle     uint64    // Number of cycles emulated so far.
 }
 
+const FrameRate = 60 // Frames per second, where cheats and hotkeys apply.
+
+// Resolution of the Chip8 display.
+const (
+	ScreenWidth  = 64
+	ScreenHeight = 32
+)
+
 func MakeChip8(debug bool) *Chip8 { // and initialize
 	c8 := Chip8{}
 	c8.Opcode = Opcode{}
@@ -68,173 +102,427 @@ func MakeChip8(debug bool) *Chip8 { // and initialize
 		c8.Memory[char] = c8.Fontset[char]
 	}
 
-	screen := gfx.MakeScreen(640, 480, 64, 32, "Chip-8 Emulator")
-	c8.Screen = &screen
-	c8.Controller = &screen
+	// Games run without a window until one is attached.
+	screen := gfx.MakeHeadless(ScreenWidth, ScreenHeight)
+	c8.Screen = screen
+	c8.Controller = screen
 	c8.Debug = debug
 	c8.CycleRate = time.Second / 10800
+	c8.Cheats = MakeCheats()
 	return &c8
 }
 
-func (c8 *Chip8) LoadGame(filePath string) {
-	// Open file and load into memory, else panic.
-	file, err := os.Open(filePath)
+/**
+ * Datatype to describe a game that could not be loaded, because it or one
+ * of its patches could not be read, a patch didn't apply, or the game is
+ * too big for memory.
+ */
+type LoadError struct {
+	Op   string // What couldn't be done, like "read" or "apply patch".
+	Path string // The game or patch it couldn't be done to.
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("Could not %v %v: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Largest game that fits in memory after the interpreter's 512 bytes.
+const MaxROMSize = 4096 - 0x200
+
+// LoadGame reads a game from a file, applies any patches to it (in order),
+// and puts it into memory. Any problem is returned as a *LoadError.
+func (c8 *Chip8) LoadGame(filePath string, patchPaths ...string) error {
+	rom, err := ReadGame(filePath, patchPaths...)
 	if err != nil {
-		panic(fmt.Sprintf(
-			"Error: File at %v could not be loaded! Error was: %v\n",
-			filePath, err))
+		return err
 	}
-	defer file.Close()
+	return c8.LoadROM(rom)
+}
 
-	// Now, we've opened the file, and can load
-	// its contents into memory.
-	// We must first get the file size.
-	stat, err := file.Stat()
+// LoadGameBytes is LoadGame for a game that was read already, like one
+// built into the executable. The name is only used in errors.
+func (c8 *Chip8) LoadGameBytes(name string, buffer []byte, patchPaths ...string) error {
+	rom, err := PatchGame(name, buffer, patchPaths...)
 	if err != nil {
-		panic(fmt.Sprintf(
-			"Error: Info about file at %v could not be found! Error was: %v\n",
-			filePath, err))
+		return err
 	}
+	return c8.LoadROM(rom)
+}
 
-	buffer := make([]byte, stat.Size()) // Make new buffer to store game.
-	_, err = io.ReadFull(file, buffer)
+// ReadGame is LoadGame without the loading: it returns the patched game,
+// checked to fit in memory, so that a running game can be kept until the
+// new one is known to be good.
+func ReadGame(filePath string, patchPaths ...string) ([]byte, error) {
+	buffer, err := os.ReadFile(filePath)
 	if err != nil {
-		panic(fmt.Sprintf(
-			"Error: File at %v could not be read completely! Error was: %v\n",
-			filePath, err))
+		return nil, &LoadError{"read", filePath, err}
+	}
+	return PatchGame(filePath, buffer, patchPaths...)
+}
+
+// PatchGame is ReadGame for a game that was read already.
+func PatchGame(name string, buffer []byte, patchPaths ...string) ([]byte, error) {
+	for _, patchPath := range patchPaths {
+		patchData, err := os.ReadFile(patchPath)
+		if err != nil {
+			return nil, &LoadError{"read patch", patchPath, err}
+		}
+		buffer, err = patch.Apply(buffer, patchData)
+		if err != nil {
+			return nil, &LoadError{"apply patch", patchPath, err}
+		}
+	}
+	if err := checkROMSize(buffer); err != nil {
+		return nil, &LoadError{"load", name, err}
+	}
+	return buffer, nil
+}
+
+func checkROMSize(rom []byte) error {
+	if len(rom) > MaxROMSize {
+		return fmt.Errorf("game is %v bytes, but only %v fit in memory", len(rom), MaxROMSize)
 	}
+	return nil
+}
+
+// LoadROM puts a game into memory, for games that aren't in files.
+func (c8 *Chip8) LoadROM(rom []byte) error {
+	if err := checkROMSize(rom); err != nil {
+		return err
+	}
+	copy(c8.Memory[0x200:], rom)
+	c8.RomSize = len(rom)
+	return nil
+}
 
-	for index, value := range buffer {
-		c8.Memory[index+0x200] = value
+// Reset puts the machine back in its power-on state, so that a new game
+// can be loaded. Anything recorded about the old game goes with it: history,
+// cheats (leaving an empty set, so that the search hotkeys still work), and
+// any profile or coverage.
+func (c8 *Chip8) Reset() {
+	s := State{PC: 0x200}
+	copy(s.Memory[:], c8.Fontset[:])
+	c8.LoadState(s)
+	c8.RomSize = 0
+	c8.Cycle = 0
+	c8.Fault = nil
+	c8.Cheats = MakeCheats()
+	if c8.Profiler != nil {
+		c8.Profiler = MakeProfiler()
+	}
+	if c8.Coverage != nil {
+		c8.Coverage = MakeCoverage()
+	}
+	if c8.Rewind != nil {
+		c8.Rewind.Clear()
+	}
+	if c8.History != nil {
+		c8.History.Reset()
 	}
 }
 
 func (c8 *Chip8) Run() {
-	for _ = range time.Tick(c8.CycleRate) {
-		if c8.Controller.ShouldClose() {
+	for _ = range time.Tick(time.Second / FrameRate) {
+		if c8.Controller.ShouldClose() || c8.Stop {
+			return
+		}
+
+		err := c8.PauseOnFault(func() {
+			if c8.Debugger != nil {
+				c8.Debugger.Poll(c8) // Run debugger commands between frames.
+			}
+			c8.RunTasks()
+			c8.handleSpeedHotkeys()
+			c8.handleMenuHotkey()
+			if c8.Menu != nil && c8.Menu.Open {
+				c8.SetKeys()
+				c8.menuFrame()
+			} else if c8.Paused {
+				c8.SetKeys() // Keep the window responsive.
+			} else if c8.Rewind != nil && c8.Controller.HotkeyHeld(gfx.HotkeyRewind) {
+				c8.RewindFrame()
+			} else {
+				c8.emulateAtSpeed()
+			}
+			c8.HandleHotkeys()
+		})
+		if err != nil {
+			c8.DrawScreen()
+			c8.reportFault(err)
+		}
+		c8.showStatus()
+	}
+}
+
+// Tells the player why the game stopped: in the debugger console if there
+// is one, since its prompt is waiting, and on the terminal otherwise.
+func (c8 *Chip8) reportFault(err error) {
+	if c8.Debugger == nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(c8.Debugger.Out, "\nError: %v\n", err)
+	c8.Debugger.PrintInstruction(c8)
+	fmt.Fprintf(c8.Debugger.Out, "(chip8) ")
+}
+
+// RunTasks runs every task that is waiting, without blocking.
+func (c8 *Chip8) RunTasks() {
+	for {
+		select {
+		case task := <-c8.Tasks:
+			task(c8)
+		default:
+			return
+		}
+	}
+}
+
+// Do runs a task between frames and waits for it to finish, so that other
+// goroutines can safely use the machine. If there is no task channel,
+// nothing else is running the machine, and the task is run right away.
+func (c8 *Chip8) Do(task func(c8 *Chip8)) {
+	if c8.Tasks == nil {
+		task(c8)
+		return
+	}
+	done := make(chan bool)
+	c8.Tasks <- func(c8 *Chip8) {
+		defer close(done) // Even if the task faults.
+		task(c8)
+	}
+	<-done
+}
+
+// Number of cycles emulated in each frame.
+func (c8 *Chip8) CyclesPerFrame() int {
+	return int(time.Second / FrameRate / c8.CycleRate)
+}
+
+// EmulateFrame runs a frame's worth of cycles. It doesn't draw, so that
+// callers can run several frames and show only the last; see DrawScreen.
+func (c8 *Chip8) EmulateFrame() {
+	for cycle := 0; cycle < c8.CyclesPerFrame(); cycle++ {
+		if c8.Debugger != nil && c8.Debugger.ShouldBreak(c8) {
 			return
 		}
+		c8.ExecuteCycle()
+		c8.SetKeys()
+	}
+
+	if c8.Cheats != nil && c8.Cheats.Active() {
+		c8.Cheats.Apply(c8)
+		if c8.History != nil {
+			c8.History.Diverge(c8) // Cheats aren't replayed.
+		}
+	}
+	if c8.Rewind != nil {
+		c8.Rewind.Push(c8)
+	}
+}
+
+// RewindFrame steps back to the state of the previous frame, if there is one.
+func (c8 *Chip8) RewindFrame() {
+	c8.SetKeys()
+	if c8.Rewind.Back(c8) {
+		c8.DrawScreen()
+		if c8.History != nil {
+			c8.History.Reset()
+		}
+	}
+}
 
-		c8.EmulateCycle()
+// Debugger commands run by each hotkey, so both work the same way.
+var hotkeyCommands = map[gfx.Hotkey]string{
+	gfx.HotkeyCheat1:          "cheat 1",
+	gfx.HotkeyCheat2:          "cheat 2",
+	gfx.HotkeyCheat3:          "cheat 3",
+	gfx.HotkeyCheat4:          "cheat 4",
+	gfx.HotkeyCheat5:          "cheat 5",
+	gfx.HotkeyCheat6:          "cheat 6",
+	gfx.HotkeyCheat7:          "cheat 7",
+	gfx.HotkeyCheat8:          "cheat 8",
+	gfx.HotkeySearchStart:     "search start",
+	gfx.HotkeySearchDecreased: "search decreased",
+	gfx.HotkeySearchIncreased: "search increased",
+	gfx.HotkeySearchUnchanged: "search unchanged",
+}
+
+func (c8 *Chip8) HandleHotkeys() {
+	for hotkey, command := range hotkeyCommands {
+		if !c8.Controller.HotkeyPressed(hotkey) || c8.Cheats == nil {
+			continue
+		}
+		_, err := c8.Cheats.Exec(c8, strings.Fields(command), os.Stdout)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
 	}
 }
 
 func (c8 *Chip8) EmulateCycle() {
+	c8.ExecuteCycle()
+	c8.DrawScreen() // Only draws if needed.
+	c8.SetKeys()
+}
+
+// ExecuteCycle runs a single instruction, without touching the window.
+func (c8 *Chip8) ExecuteCycle() {
+	c8.Fault = nil
+	if c8.History != nil {
+		c8.History.Record(c8)
+	}
 	c8.FetchOpcode() // Fetch instruction.
+	if c8.Profiler != nil {
+		c8.Profiler.Record(c8)
+	}
 	if c8.Debug {
 		fmt.Printf("On cycle %v, at mem loc %X\n", c8.Count, c8.PC)
 		c8.Count++
 	}
 
 	c8.DecodeExecute()
-	c8.DrawScreen() // Only draws if needed.
-	c8.SetKeys()
 	c8.UpdateTimers()
 	c8.IncrementPC()
+	c8.Cycle++
+}
+
+// OpcodeAt returns the opcode at addr without fetching it, or a zero
+// opcode if it doesn't fit in memory.
+func (c8 *Chip8) OpcodeAt(addr uint16) Opcode {
+	if int(addr)+1 >= len(c8.Memory) {
+		return Opcode{}
+	}
+	return MakeOpcode(uint16(c8.Memory[addr])<<8 | uint16(c8.Memory[addr+1]))
 }
 
 func (c8 *Chip8) FetchOpcode() {
+	if int(c8.PC)+1 >= len(c8.Memory) {
+		c8.Opcode = Opcode{}
+		c8.fault(FaultPC, c8.PC)
+	}
 	newOp := uint16(c8.Memory[c8.PC]) << 8
 	newOp |= uint16(c8.Memory[c8.PC+1])
 	c8.Opcode = MakeOpcode(newOp)
+
+	if c8.Coverage != nil {
+		c8.Coverage.Mark(c8.PC, CoverExecuted)
+		c8.Coverage.Mark(c8.PC+1, CoverExecuted)
+	}
 }
 
 func (c8 *Chip8) DecodeExecute() {
 	// Update PC by 2 unless overridden by an instruction.
 	c8.UpdatePC = 2
 
-	switch c8.Opcode.Value >> 12 { // Decode (big-ass switch statement)
-	case 0x0:
-		switch c8.Opcode.Value & 0xFF {
-		case 0xE0:
-			c8.ClearScreen()
-		case 0xEE:
-			c8.Return()
-		default:
-			c8.CallRCA1802()
-		}
-	case 0x1:
-		c8.Jump()
-	case 0x2:
-		c8.Call()
-	case 0x3:
-		c8.SkipInstrEqualLiteral()
-	case 0x4:
-		c8.SkipInstrNotEqualLiteral()
-	case 0x5:
-		c8.SkipInstrEqualReg()
-	case 0x6:
-		c8.SetRegToLiteral()
-	case 0x7:
-		c8.Add()
-	case 0x8:
-		switch c8.Opcode.Value & 0xF {
-		case 0x0:
-			c8.SetRegToReg()
-		case 0x1:
-			c8.Or()
-		case 0x2:
-			c8.And()
-		case 0x3:
-			c8.Xor()
-		case 0x4:
-			c8.AddWithCarry()
-		case 0x5:
-			c8.SubYFromX()
-		case 0x6:
-			c8.ShiftRight()
-		case 0x7:
-			c8.SubXFromY()
-		case 0xE:
-			c8.ShiftLeft()
-		default:
-			c8.UnknownInstruction()
-		}
-	case 0x9:
-		c8.SkipInstrNotEqualReg()
-	case 0xA:
-		c8.SetIndexLiteral()
-	case 0xB:
-		c8.JumpIndexLiteralOffset()
-	case 0xC:
-		c8.SetRegisterRandomMask()
-	case 0xD:
-		c8.DrawSprite()
-	case 0xE:
-		switch c8.Opcode.Value & 0xFF {
-		case 0x9E:
-			c8.SkipInstrKeyPressed()
-		case 0xA1:
-			c8.SkipInstrKeyNotPressed()
-		default:
-			c8.UnknownInstruction()
-		}
-	case 0xF:
-		switch c8.Opcode.Value & 0xFF {
-		case 0x07:
-			c8.GetDelayTimer()
-		case 0x0A:
-			c8.GetKeyPress()
-		case 0x15:
-			c8.SetDelayTimer()
-		case 0x18:
-			c8.SetSoundTimer()
-		case 0x1E:
-			c8.AddRegisterToIndex()
-		case 0x29:
-			c8.SetIndexToSprite()
-		case 0x33:
-			c8.SaveBinaryCodedDecimal()
-		case 0x55:
-			c8.SaveRegisters()
-		case 0x65:
-			c8.RestoreRegisters()
-		default:
-			c8.UnknownInstruction()
-		}
-	default:
-		c8.UnknownInstruction()
+	Decode(c8.Opcode).Execute(c8)
+}
+
+// Instructions access memory and registers through the methods below,
+// so that tools like coverage and watchpoints see every access.
+
+// ReadMemory reads a byte of data from memory on behalf of an instruction.
+func (c8 *Chip8) ReadMemory(addr uint16) uint8 {
+	if int(addr) >= len(c8.Memory) {
+		c8.fault(FaultMemory, addr)
+	}
+	if c8.Coverage != nil {
+		c8.Coverage.Mark(addr, CoverRead)
+	}
+	c8.read(Location{LocMemory, addr}, uint16(c8.Memory[addr]))
+	return c8.Memory[addr]
+}
+
+// WriteMemory writes a byte of data to memory on behalf of an instruction.
+func (c8 *Chip8) WriteMemory(addr uint16, value uint8) {
+	if int(addr) >= len(c8.Memory) {
+		c8.fault(FaultMemory, addr)
+	}
+	if c8.Coverage != nil {
+		c8.Coverage.Mark(addr, CoverWritten)
+	}
+	c8.written(Location{LocMemory, addr}, uint16(c8.Memory[addr]), uint16(value))
+	c8.Memory[addr] = value
+}
+
+func (c8 *Chip8) ReadRegister(reg uint8) uint8 {
+	c8.read(Location{LocRegister, uint16(reg)}, uint16(c8.Registers[reg]))
+	return c8.Registers[reg]
+}
+
+func (c8 *Chip8) WriteRegister(reg uint8, value uint8) {
+	c8.written(Location{LocRegister, uint16(reg)}, uint16(c8.Registers[reg]), uint16(value))
+	c8.Registers[reg] = value
+}
+
+func (c8 *Chip8) ReadIndex() uint16 {
+	c8.read(Location{Kind: LocIndex}, c8.IndexReg)
+	return c8.IndexReg
+}
+
+func (c8 *Chip8) WriteIndex(value uint16) {
+	c8.written(Location{Kind: LocIndex}, c8.IndexReg, value)
+	c8.IndexReg = value
+}
+
+func (c8 *Chip8) ReadDelayTimer() uint8 {
+	c8.read(Location{Kind: LocDelayTimer}, uint16(c8.DelayTimer))
+	return c8.DelayTimer
+}
+
+func (c8 *Chip8) WriteDelayTimer(value uint8) {
+	c8.written(Location{Kind: LocDelayTimer}, uint16(c8.DelayTimer), uint16(value))
+	c8.DelayTimer = value
+}
+
+func (c8 *Chip8) WriteSoundTimer(value uint8) {
+	c8.written(Location{Kind: LocSoundTimer}, uint16(c8.SoundTimer), uint16(value))
+	c8.SoundTimer = value
+}
+
+// Report accesses to the debugger, which may be watching the location.
+func (c8 *Chip8) read(loc Location, value uint16) {
+	if c8.Debugger != nil {
+		c8.Debugger.Access(c8, loc, AccessRead, value, value)
+	}
+}
+
+func (c8 *Chip8) written(loc Location, old, new uint16) {
+	if c8.Debugger != nil {
+		c8.Debugger.Access(c8, loc, AccessWrite, old, new)
+	}
+}
+
+// KeyPressed checks a key on behalf of an instruction.
+func (c8 *Chip8) KeyPressed(key uint8) bool {
+	if int(key) >= len(c8.HeldKeys) {
+		c8.fault(FaultKey, uint16(key))
+	}
+	pressed := func() bool {
+		return c8.HeldKeys[key] || c8.Controller.KeyPressed(key)
+	}
+	if c8.History != nil {
+		return c8.History.Input(func() uint8 {
+			if pressed() {
+				return 1
+			}
+			return 0
+		}) == 1
+	}
+	return pressed()
+}
+
+// RandomByte generates a random number on behalf of an instruction.
+func (c8 *Chip8) RandomByte() uint8 {
+	if c8.History != nil {
+		return c8.History.Input(func() uint8 { return uint8(c8.Rando.Uint32() % 256) })
 	}
+	return uint8(c8.Rando.Uint32() % 256)
 }
 
 func (c8 *Chip8) DrawScreen() {
@@ -253,12 +541,17 @@ func (c8 *Chip8) UpdateTimers() {
 		c8.DelayTimer--
 	}
 	if c8.SoundTimer > 0 {
-		fmt.Printf("\x07") // BEEP!
+		if !c8.Mute {
+			fmt.Printf("\x07") // BEEP!
+		}
 		c8.SoundTimer--
 	}
 }
 
 func (c8 *Chip8) IncrementPC() {
+	if next := c8.PC + c8.UpdatePC; int(next)+1 >= len(c8.Memory) {
+		c8.fault(FaultPC, next)
+	}
 	c8.PC += c8.UpdatePC
 }
 
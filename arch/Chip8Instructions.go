@@ -26,21 +26,25 @@ func (c8 *Chip8) DrawSprite() {
 		fmt.Println("Executing DrawSprite()")
 	}
 	// All variables are promoted to uint16 for easier manipulation.
-	xCoord := uint16(c8.Registers[c8.Opcode.Xreg])
-	yCoord := uint16(c8.Registers[c8.Opcode.Yreg])
+	xCoord := uint16(c8.ReadRegister(c8.Opcode.Xreg))
+	yCoord := uint16(c8.ReadRegister(c8.Opcode.Yreg))
 	height := c8.Opcode.Value & 0xF
 	width := uint16(8)         // Width is hardcoded.
 	shiftConst := uint16(0x80) // Shifting 128 right allows us to check indiv bits.
 
-	c8.Registers[0xF] = 0 // Assume we don't unset any pixels.
+	collision := uint8(0) // Assume we don't unset any pixels.
+	index := c8.ReadIndex()
 
 	var yLine, xLine uint16
 	for yLine = 0; yLine < height; yLine++ {
-		pixel := uint16(c8.Memory[c8.IndexReg+yLine])
+		pixel := uint16(c8.ReadMemory(index + yLine))
 
 		for xLine = 0; xLine < width; xLine++ {
 
 			x, y := xCoord+xLine, yCoord+yLine
+			if c8.Quirks.WrapSprites {
+				x, y = x%ScreenWidth, y%ScreenHeight
+			}
 			inBounds := c8.Screen.InBounds(x, y)
 
 			// If we need to draw this pixel...
@@ -48,13 +52,14 @@ func (c8 *Chip8) DrawSprite() {
 
 				// XOR the pixel, saving whether we set it.
 				if c8.Screen.GetPixel(x, y) {
-					c8.Registers[0xF] = 1
+					collision = 1
 				}
 				c8.Screen.XorPixel(x, y)
 
 			}
 		}
 	}
+	c8.WriteRegister(0xF, collision)
 
 	c8.DrawFlag = true
 }
@@ -63,20 +68,22 @@ func (c8 *Chip8) SetIndexToSprite() {
 	if c8.Debug {
 		fmt.Println("Executing SetIndexToSprite()")
 	}
-	char := c8.Registers[c8.Opcode.Xreg]
+	char := c8.ReadRegister(c8.Opcode.Xreg)
 	offset := uint8(len(c8.Fontset) / 16) // Number of sprites per character.
 
 	// Set index register to location of the
 	// first fontset sprite of the matching character.
-	c8.IndexReg = uint16(offset * char)
+	if c8.Quirks.FontLowDigit {
+		c8.WriteIndex(uint16(offset) * uint16(char&0xF))
+	} else {
+		c8.WriteIndex(uint16(offset * char))
+	}
 }
 
 // Control flow
 
 func (c8 *Chip8) CallRCA1802() {
-	address := c8.Opcode.Value & 0xFFF
-	panic(fmt.Sprintf("Unimplemented opcode CallRCA1802 called with address: %v\n",
-		address))
+	c8.fault(FaultMachineCode, c8.Opcode.Literal)
 }
 
 func (c8 *Chip8) Return() {
@@ -84,6 +91,12 @@ func (c8 *Chip8) Return() {
 		fmt.Println("Executing Return()")
 	}
 	// No return values, just stack movement.
+	if c8.SP == 0 {
+		c8.fault(FaultStackUnderflow, 0)
+	}
+	if int(c8.SP) > len(c8.Stack) {
+		c8.fault(FaultStackOverflow, 0)
+	}
 	c8.SP--
 	c8.PC = c8.Stack[c8.SP]
 }
@@ -92,18 +105,20 @@ func (c8 *Chip8) Jump() {
 	if c8.Debug {
 		fmt.Println("Executing Jump()")
 	}
-	c8.PC = c8.Opcode.Literal
-	c8.UpdatePC = 0 // Don't increment PC
+	c8.jumpTo(c8.Opcode.Literal)
 }
 
 func (c8 *Chip8) JumpIndexLiteralOffset() {
 	if c8.Debug {
 		fmt.Println("Executing JumpIndexLiteralOffset()")
 	}
-	newAddr := c8.Opcode.Literal + uint16(c8.Registers[0])
+	reg := uint8(0)
+	if c8.Quirks.JumpVX {
+		reg = c8.Opcode.Xreg
+	}
+	newAddr := c8.Opcode.Literal + uint16(c8.ReadRegister(reg))
 
-	c8.PC = newAddr
-	c8.UpdatePC = 0 // Don't increment PC
+	c8.jumpTo(newAddr)
 }
 
 func (c8 *Chip8) Call() {
@@ -111,10 +126,21 @@ func (c8 *Chip8) Call() {
 		fmt.Println("Executing Call()")
 	}
 	// Store the PC in the stack pointer.
+	if int(c8.SP) >= len(c8.Stack) {
+		c8.fault(FaultStackOverflow, 0)
+	}
 	c8.Stack[c8.SP] = c8.PC
-	c8.SP++ // TODO: Overflow?
+	c8.SP++
+
+	c8.jumpTo(c8.Opcode.Literal)
+}
 
-	c8.PC = c8.Opcode.Literal
+// Moves the PC to an address, unless there's no instruction there.
+func (c8 *Chip8) jumpTo(addr uint16) {
+	if int(addr)+1 >= len(c8.Memory) {
+		c8.fault(FaultPC, addr)
+	}
+	c8.PC = addr
 	c8.UpdatePC = 0 // Don't increment PC
 }
 
@@ -125,7 +151,7 @@ func (c8 *Chip8) SkipInstrEqualLiteral() {
 	literal := c8.Opcode.Value & 0xFF
 
 	// If the register contents equal the literal...
-	if uint16(c8.Registers[c8.Opcode.Xreg]) == literal {
+	if uint16(c8.ReadRegister(c8.Opcode.Xreg)) == literal {
 		c8.UpdatePC = 4 // skip an instruction.
 	}
 }
@@ -137,7 +163,7 @@ func (c8 *Chip8) SkipInstrNotEqualLiteral() {
 	literal := c8.Opcode.Value & 0xFF
 
 	// If the register contents don't equal the literal...
-	if uint16(c8.Registers[c8.Opcode.Xreg]) != literal {
+	if uint16(c8.ReadRegister(c8.Opcode.Xreg)) != literal {
 		c8.UpdatePC = 4 // skip an instruction.
 	}
 }
@@ -147,7 +173,7 @@ func (c8 *Chip8) SkipInstrEqualReg() {
 		fmt.Println("Executing SkipInstrEqualReg()")
 	}
 	// If the register contents are equal...
-	if c8.Registers[c8.Opcode.Xreg] == c8.Registers[c8.Opcode.Yreg] {
+	if c8.ReadRegister(c8.Opcode.Xreg) == c8.ReadRegister(c8.Opcode.Yreg) {
 		c8.UpdatePC = 4 // skip an instruction.
 	}
 }
@@ -157,7 +183,7 @@ func (c8 *Chip8) SkipInstrNotEqualReg() {
 		fmt.Println("Executing SkipInstrNotEqualReg()")
 	}
 	// If the register contents are not equal...
-	if c8.Registers[c8.Opcode.Xreg] != c8.Registers[c8.Opcode.Yreg] {
+	if c8.ReadRegister(c8.Opcode.Xreg) != c8.ReadRegister(c8.Opcode.Yreg) {
 		c8.UpdatePC = 4 // skip an instruction.
 	}
 }
@@ -166,7 +192,7 @@ func (c8 *Chip8) SkipInstrKeyPressed() {
 	if c8.Debug {
 		fmt.Println("Executing SkipInstrKeyPressed()")
 	}
-	if c8.Controller.KeyPressed(c8.Registers[c8.Opcode.Xreg]) {
+	if c8.KeyPressed(c8.ReadRegister(c8.Opcode.Xreg)) {
 		c8.UpdatePC = 4
 	}
 }
@@ -175,7 +201,7 @@ func (c8 *Chip8) SkipInstrKeyNotPressed() {
 	if c8.Debug {
 		fmt.Printf("Executing SkipInstrKeyNotPressed() - xreg is %v (xreg value %v) yreg %v value %v literal %v\n", c8.Opcode.Xreg, c8.Registers[c8.Opcode.Xreg], c8.Opcode.Yreg, c8.Opcode.Value, c8.Opcode.Literal)
 	}
-	if !c8.Controller.KeyPressed(c8.Registers[c8.Opcode.Xreg]) {
+	if !c8.KeyPressed(c8.ReadRegister(c8.Opcode.Xreg)) {
 		c8.UpdatePC = 4
 	}
 }
@@ -189,14 +215,14 @@ func (c8 *Chip8) SetRegToLiteral() {
 	literal := c8.Opcode.Value & 0xFF
 
 	// WARNING, MAY NOT FIT!
-	c8.Registers[c8.Opcode.Xreg] = uint8(literal)
+	c8.WriteRegister(c8.Opcode.Xreg, uint8(literal))
 }
 
 func (c8 *Chip8) SetRegToReg() {
 	if c8.Debug {
 		fmt.Println("Executing SetRegToReg()")
 	}
-	c8.Registers[c8.Opcode.Xreg] = c8.Registers[c8.Opcode.Yreg]
+	c8.WriteRegister(c8.Opcode.Xreg, c8.ReadRegister(c8.Opcode.Yreg))
 }
 
 func (c8 *Chip8) Add() {
@@ -206,21 +232,21 @@ func (c8 *Chip8) Add() {
 	literal := c8.Opcode.Value & 0xFF
 
 	// WARNING, MIGHT NOT FIT
-	c8.Registers[c8.Opcode.Xreg] += uint8(literal)
+	c8.WriteRegister(c8.Opcode.Xreg, c8.ReadRegister(c8.Opcode.Xreg)+uint8(literal))
 }
 
 func (c8 *Chip8) AddWithCarry() {
 	if c8.Debug {
 		fmt.Println("Executing AddWithCarry()")
 	}
-	sum := int(c8.Registers[c8.Opcode.Xreg]) +
-		int(c8.Registers[c8.Opcode.Yreg])
-	c8.Registers[c8.Opcode.Xreg] = uint8(sum)
+	sum := int(c8.ReadRegister(c8.Opcode.Xreg)) +
+		int(c8.ReadRegister(c8.Opcode.Yreg))
+	c8.WriteRegister(c8.Opcode.Xreg, uint8(sum))
 
 	if sum > math.MaxUint8 {
-		c8.Registers[0xF] = 1 // If overflow, save 1 into last reg.
+		c8.WriteRegister(0xF, 1) // If overflow, save 1 into last reg.
 	} else {
-		c8.Registers[0xF] = 0 // Else, save 0 into last reg.
+		c8.WriteRegister(0xF, 0) // Else, save 0 into last reg.
 	}
 }
 
@@ -228,38 +254,48 @@ func (c8 *Chip8) Or() {
 	if c8.Debug {
 		fmt.Println("Executing Or()")
 	}
-	c8.Registers[c8.Opcode.Xreg] =
-		c8.Registers[c8.Opcode.Xreg] | c8.Registers[c8.Opcode.Yreg]
+	c8.WriteRegister(c8.Opcode.Xreg,
+		c8.ReadRegister(c8.Opcode.Xreg)|c8.ReadRegister(c8.Opcode.Yreg))
+	c8.resetFlag()
 }
 
 func (c8 *Chip8) And() {
 	if c8.Debug {
 		fmt.Println("Executing And()")
 	}
-	c8.Registers[c8.Opcode.Xreg] =
-		c8.Registers[c8.Opcode.Xreg] & c8.Registers[c8.Opcode.Yreg]
+	c8.WriteRegister(c8.Opcode.Xreg,
+		c8.ReadRegister(c8.Opcode.Xreg)&c8.ReadRegister(c8.Opcode.Yreg))
+	c8.resetFlag()
 }
 
 func (c8 *Chip8) Xor() {
 	if c8.Debug {
 		fmt.Println("Executing Xor()")
 	}
-	c8.Registers[c8.Opcode.Xreg] =
-		c8.Registers[c8.Opcode.Xreg] ^ c8.Registers[c8.Opcode.Yreg]
+	c8.WriteRegister(c8.Opcode.Xreg,
+		c8.ReadRegister(c8.Opcode.Xreg)^c8.ReadRegister(c8.Opcode.Yreg))
+	c8.resetFlag()
+}
+
+// Clears VF after a logic instruction, if the quirks say to.
+func (c8 *Chip8) resetFlag() {
+	if c8.Quirks.ResetVF {
+		c8.WriteRegister(0xF, 0)
+	}
 }
 
 func (c8 *Chip8) SubXFromY() {
 	if c8.Debug {
 		fmt.Println("Executing SubXFromY()")
 	}
-	diff := int(c8.Registers[c8.Opcode.Yreg]) -
-		int(c8.Registers[c8.Opcode.Xreg])
-	c8.Registers[c8.Opcode.Xreg] = uint8(diff)
+	diff := int(c8.ReadRegister(c8.Opcode.Yreg)) -
+		int(c8.ReadRegister(c8.Opcode.Xreg))
+	c8.WriteRegister(c8.Opcode.Xreg, uint8(diff))
 
 	if diff < 0 {
-		c8.Registers[0xF] = 0 // If underflow, save 0 into last reg.
+		c8.WriteRegister(0xF, 0) // If underflow, save 0 into last reg.
 	} else {
-		c8.Registers[0xF] = 1 // Else, save 1 into last reg.
+		c8.WriteRegister(0xF, 1) // Else, save 1 into last reg.
 	}
 }
 
@@ -267,14 +303,14 @@ func (c8 *Chip8) SubYFromX() {
 	if c8.Debug {
 		fmt.Println("Executing SubYFromX()")
 	}
-	diff := int(c8.Registers[c8.Opcode.Xreg]) -
-		int(c8.Registers[c8.Opcode.Yreg])
-	c8.Registers[c8.Opcode.Xreg] = uint8(diff)
+	diff := int(c8.ReadRegister(c8.Opcode.Xreg)) -
+		int(c8.ReadRegister(c8.Opcode.Yreg))
+	c8.WriteRegister(c8.Opcode.Xreg, uint8(diff))
 
 	if diff < 0 {
-		c8.Registers[0xF] = 0 // If underflow, save 0 into last reg.
+		c8.WriteRegister(0xF, 0) // If underflow, save 0 into last reg.
 	} else {
-		c8.Registers[0xF] = 1 // Else, save 1 into last reg.
+		c8.WriteRegister(0xF, 1) // Else, save 1 into last reg.
 	}
 }
 
@@ -282,20 +318,44 @@ func (c8 *Chip8) ShiftRight() {
 	if c8.Debug {
 		fmt.Println("Executing ShiftRight()")
 	}
-	// Set VF to least significant bit of Xreg before shifting.
-	c8.Registers[0xF] = c8.Registers[c8.Opcode.Xreg] & 0x1
+	if !c8.Quirks.ShiftFlagLast {
+		// Set VF to least significant bit of Xreg before shifting.
+		c8.WriteRegister(0xF, c8.ReadRegister(c8.shiftSource())&0x1)
+
+		c8.WriteRegister(c8.Opcode.Xreg, c8.ReadRegister(c8.shiftSource())>>1)
+		return
+	}
+	value := c8.ReadRegister(c8.shiftSource())
+	c8.WriteRegister(c8.Opcode.Xreg, value>>1)
 
-	c8.Registers[c8.Opcode.Xreg] = c8.Registers[c8.Opcode.Xreg] >> 1
+	// Set VF to the bit shifted out, after the result in case VF is Xreg.
+	c8.WriteRegister(0xF, value&0x1)
 }
 
 func (c8 *Chip8) ShiftLeft() {
 	if c8.Debug {
 		fmt.Println("Executing ShiftLeft()")
 	}
-	// Set VF to most significant bit of Xreg before shifting.
-	c8.Registers[0xF] = (c8.Registers[c8.Opcode.Xreg] >> 7) & 0x1
+	if !c8.Quirks.ShiftFlagLast {
+		// Set VF to most significant bit of Xreg before shifting.
+		c8.WriteRegister(0xF, (c8.ReadRegister(c8.shiftSource())>>7)&0x1)
+
+		c8.WriteRegister(c8.Opcode.Xreg, c8.ReadRegister(c8.shiftSource())<<1)
+		return
+	}
+	value := c8.ReadRegister(c8.shiftSource())
+	c8.WriteRegister(c8.Opcode.Xreg, value<<1)
 
-	c8.Registers[c8.Opcode.Xreg] = c8.Registers[c8.Opcode.Xreg] << 1
+	// Set VF to the bit shifted out, after the result in case VF is Xreg.
+	c8.WriteRegister(0xF, (value>>7)&0x1)
+}
+
+// The register that shift instructions shift, depending on the quirks.
+func (c8 *Chip8) shiftSource() uint8 {
+	if c8.Quirks.ShiftVY {
+		return c8.Opcode.Yreg
+	}
+	return c8.Opcode.Xreg
 }
 
 func (c8 *Chip8) SetRegisterRandomMask() {
@@ -303,24 +363,25 @@ func (c8 *Chip8) SetRegisterRandomMask() {
 		fmt.Println("Executing SetRegisterRandomMask()")
 	}
 	mask := uint8(c8.Opcode.Value & 0xFF)
-	randNum := uint8(c8.Rando.Uint32() % 256) // Needs to fit in a uint8.
+	randNum := c8.RandomByte()
 
-	c8.Registers[c8.Opcode.Xreg] = mask & randNum
+	c8.WriteRegister(c8.Opcode.Xreg, mask&randNum)
 }
 
 func (c8 *Chip8) SaveBinaryCodedDecimal() {
 	if c8.Debug {
 		fmt.Println("Executing SaveBinaryCodedDecimal()")
 	}
-	valueToConvert := c8.Registers[c8.Opcode.Xreg]
+	valueToConvert := c8.ReadRegister(c8.Opcode.Xreg)
+	index := c8.ReadIndex()
 
 	// Store the decimal representation of value in memory so that
 	// the hundreths digit of the value is in Mem[Index],
 	// the tenths digit is in Mem[Index+1], and
 	// the ones digit is in Mem[Index+2].
-	c8.Memory[c8.IndexReg] = valueToConvert / 100
-	c8.Memory[c8.IndexReg+1] = (valueToConvert / 10) % 10
-	c8.Memory[c8.IndexReg+2] = (valueToConvert % 100) % 10
+	c8.WriteMemory(index, valueToConvert/100)
+	c8.WriteMemory(index+1, (valueToConvert/10)%10)
+	c8.WriteMemory(index+2, (valueToConvert%100)%10)
 }
 
 func (c8 *Chip8) GetKeyPress() {
@@ -330,8 +391,8 @@ func (c8 *Chip8) GetKeyPress() {
 
 	var key uint8
 	for key = 0; key < 16; key++ { // TODO: REMOVE HARDCODE
-		if c8.Controller.KeyPressed(key) {
-			c8.Registers[c8.Opcode.Xreg] = uint8(key)
+		if c8.KeyPressed(key) {
+			c8.WriteRegister(c8.Opcode.Xreg, uint8(key))
 			return
 		}
 	}
@@ -343,7 +404,7 @@ func (c8 *Chip8) GetDelayTimer() {
 	if c8.Debug {
 		fmt.Println("Executing GetDelayTimer()")
 	}
-	c8.Registers[c8.Opcode.Xreg] = c8.DelayTimer // Save delay timer in reg.
+	c8.WriteRegister(c8.Opcode.Xreg, c8.ReadDelayTimer()) // Save delay timer in reg.
 }
 
 // Manipulating special registers
@@ -352,28 +413,28 @@ func (c8 *Chip8) AddRegisterToIndex() {
 	if c8.Debug {
 		fmt.Println("Executing AddRegisterToIndex()")
 	}
-	c8.IndexReg += uint16(c8.Registers[c8.Opcode.Xreg])
+	c8.WriteIndex(c8.ReadIndex() + uint16(c8.ReadRegister(c8.Opcode.Xreg)))
 }
 
 func (c8 *Chip8) SetIndexLiteral() {
 	if c8.Debug {
 		fmt.Println("Executing SetIndexLiteral()")
 	}
-	c8.IndexReg = c8.Opcode.Literal
+	c8.WriteIndex(c8.Opcode.Literal)
 }
 
 func (c8 *Chip8) SetDelayTimer() {
 	if c8.Debug {
 		fmt.Println("Executing SetDelayTimer()")
 	}
-	c8.DelayTimer = c8.Registers[c8.Opcode.Xreg]
+	c8.WriteDelayTimer(c8.ReadRegister(c8.Opcode.Xreg))
 }
 
 func (c8 *Chip8) SetSoundTimer() {
 	if c8.Debug {
 		fmt.Println("Executing SetSoundTimer()")
 	}
-	c8.SoundTimer = c8.Registers[c8.Opcode.Xreg]
+	c8.WriteSoundTimer(c8.ReadRegister(c8.Opcode.Xreg))
 }
 
 // Context Switching
@@ -384,9 +445,10 @@ func (c8 *Chip8) SaveRegisters() {
 	}
 	// Store all registers up to last register in memory,
 	// starting in memory at the location in the index register.
-	for loc, reg := c8.IndexReg, uint16(0); reg <= uint16(c8.Opcode.Xreg); loc, reg = loc+1, reg+1 {
-		c8.Memory[loc] = c8.Registers[reg] // TODO: check overflow
+	for loc, reg := c8.ReadIndex(), uint8(0); reg <= c8.Opcode.Xreg; loc, reg = loc+1, reg+1 {
+		c8.WriteMemory(loc, c8.ReadRegister(reg))
 	}
+	c8.incrementIndex()
 }
 
 func (c8 *Chip8) RestoreRegisters() {
@@ -395,13 +457,21 @@ func (c8 *Chip8) RestoreRegisters() {
 	}
 	// Load all registers up to last register from memory,
 	// starting in memory at the location in the index register.
-	for loc, reg := c8.IndexReg, uint16(0); reg <= uint16(c8.Opcode.Xreg); loc, reg = loc+1, reg+1 {
-		c8.Registers[reg] = c8.Memory[loc] // TODO: check overflow
+	for loc, reg := c8.ReadIndex(), uint8(0); reg <= c8.Opcode.Xreg; loc, reg = loc+1, reg+1 {
+		c8.WriteRegister(reg, c8.ReadMemory(loc))
+	}
+	c8.incrementIndex()
+}
+
+// Moves I past the registers just saved or restored, if the quirks say to.
+func (c8 *Chip8) incrementIndex() {
+	if c8.Quirks.IncrementIndex {
+		c8.WriteIndex(c8.ReadIndex() + uint16(c8.Opcode.Xreg) + 1)
 	}
 }
 
 // Special
 
 func (c8 *Chip8) UnknownInstruction() {
-	panic(fmt.Sprintf("Unknown instruction: %v\n", c8.Opcode))
+	c8.fault(FaultUnknownInstruction, 0)
 }
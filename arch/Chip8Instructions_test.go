@@ -1,7 +1,11 @@
 package arch
 
 import (
+	"errors"
+	"io/fs"
 	"jugonz/chip8/gfx"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -19,7 +23,9 @@ func TestSetup(t *testing.T) {
 		}
 	}
 
-	c8.LoadGame("../c8games/PONG2")
+	if err := c8.LoadGame("../c8games/PONG2"); err != nil {
+		t.Fatalf("PONG2 could not be loaded: %v\n", err)
+	}
 	// Check that byte 1 is 22 and last byte is EE.
 	if c8.Memory[0x200] != 0x22 {
 		t.Errorf(
@@ -32,6 +38,27 @@ func TestSetup(t *testing.T) {
 	}
 }
 
+func TestLoadGamePatched(t *testing.T) {
+	// An IPS patch that changes the first byte of the ROM to 0x12.
+	patchPath := filepath.Join(t.TempDir(), "PONG2.ips")
+	err := os.WriteFile(patchPath, []byte("PATCH\x00\x00\x00\x00\x01\x12EOF"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c8 := MakeChip8(false)
+	if err := c8.LoadGame("../c8games/PONG2", patchPath); err != nil {
+		t.Fatalf("PONG2 could not be loaded: %v\n", err)
+	}
+	if c8.Memory[0x200] != 0x12 {
+		t.Errorf("Patch was not applied! Expected byte 1 to be 0x12, was: %v\n",
+			c8.Memory[0x200])
+	} else if c8.Memory[0x307] != 0xEE {
+		t.Errorf("Patch changed the rest of the ROM! Last byte was: %v\n",
+			c8.Memory[0x307])
+	}
+}
+
 func TestSkipInstr(t *testing.T) {
 	c8 := MakeChip8(false)
 
@@ -83,7 +110,7 @@ func TestSkipInstr(t *testing.T) {
 
 func TestClearScreen(t *testing.T) {
 	c8 := MakeChip8(false)
-	screen := c8.Screen.(*gfx.Screen)
+	screen := c8.Screen.(*gfx.Headless)
 
 	// Draw something to the screen, and see that it is not empty.
 	c8.Opcode = MakeOpcode(0xD324)
@@ -125,7 +152,20 @@ func TestDrawSprite(t *testing.T) {
 }
 
 func TestSetIndexToSprite(t *testing.T) {
-	// Do this one later too.
+	c8 := MakeChip8(false)
+	c8.Registers[0] = 0x33 // Past F, so 5*0x33 wraps to FF in a byte.
+
+	c8.Opcode = MakeOpcode(0xF029)
+	c8.DecodeExecute()
+	if c8.IndexReg != 0xFF {
+		t.Errorf("Index was %X, expected FF!\n", c8.IndexReg)
+	}
+
+	c8.Quirks.FontLowDigit = true
+	c8.DecodeExecute()
+	if c8.IndexReg != 3*5 {
+		t.Errorf("Index with FontLowDigit was %X, expected F (the 3)!\n", c8.IndexReg)
+	}
 }
 
 func TestCallReturn(t *testing.T) {
@@ -344,6 +384,31 @@ func TestShift(t *testing.T) {
 	}
 }
 
+func TestShiftIntoVF(t *testing.T) {
+	c8 := MakeChip8(false)
+
+	// By default, the flag is set first, and then VF itself is shifted.
+	c8.Registers[0xF] = 0x3
+	c8.Opcode = MakeOpcode(0x8F06)
+	c8.DecodeExecute()
+	if c8.Registers[0xF] != 0 {
+		t.Errorf("VF was %v after shifting it, expected 0!\n", c8.Registers[0xF])
+	}
+
+	c8.Quirks.ShiftFlagLast = true
+	c8.Registers[0xF] = 0x3
+	c8.DecodeExecute()
+	if c8.Registers[0xF] != 1 {
+		t.Errorf("VF was %v after shifting it with ShiftFlagLast, expected 1!\n", c8.Registers[0xF])
+	}
+	c8.Registers[0xF] = 0x81
+	c8.Opcode = MakeOpcode(0x8F0E)
+	c8.DecodeExecute()
+	if c8.Registers[0xF] != 1 {
+		t.Errorf("VF was %v after shifting it left with ShiftFlagLast, expected 1!\n", c8.Registers[0xF])
+	}
+}
+
 /* Test Delay Timer requires sleeps.
 func TestDelayTimer(t *testing.T) {
 	c8 := MakeChip8(false)
@@ -463,3 +528,20 @@ func TestSaveRestoreRegs(t *testing.T) {
 			c8.IndexReg)
 	}
 }
+
+func TestLoadGameErrors(t *testing.T) {
+	c8 := MakeChip8(false)
+	loadErr := &LoadError{}
+	err := c8.LoadGame(filepath.Join(t.TempDir(), "missing.ch8"))
+	if !errors.As(err, &loadErr) || loadErr.Op != "read" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Missing game gave %v\n", err)
+	}
+	err = c8.LoadGame("../c8games/PONG2", filepath.Join(t.TempDir(), "missing.ips"))
+	if !errors.As(err, &loadErr) || loadErr.Op != "read patch" {
+		t.Errorf("Missing patch gave %v\n", err)
+	}
+	err = c8.LoadGameBytes("huge", make([]byte, 4096))
+	if !errors.As(err, &loadErr) || loadErr.Op != "load" || loadErr.Path != "huge" {
+		t.Errorf("Game too big for memory gave %v\n", err)
+	}
+}
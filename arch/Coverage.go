@@ -0,0 +1,138 @@
+package arch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/**
+ * Datatype to describe how each byte of Chip8 memory has been used:
+ * fetched as an instruction, read as sprite or register data,
+ * or written to by an instruction.
+ *
+ * Coverage is saved as one flag byte per ROM byte, so offset N of
+ * a coverage file describes offset N of the ROM it was made from.
+ */
+type Coverage struct {
+	Flags [4096]CoverFlag
+}
+
+type CoverFlag uint8
+
+const (
+	CoverExecuted CoverFlag = 1 << iota // Fetched by FetchOpcode.
+	CoverRead                           // Read by DrawSprite or RestoreRegisters.
+	CoverWritten                        // Written by SaveBinaryCodedDecimal or SaveRegisters.
+)
+
+func MakeCoverage() *Coverage {
+	return &Coverage{}
+}
+
+func (cov *Coverage) Mark(addr uint16, flag CoverFlag) {
+	if int(addr) < len(cov.Flags) {
+		cov.Flags[addr] |= flag
+	}
+}
+
+// IsCode returns true if the byte at addr was ever executed.
+func (cov *Coverage) IsCode(addr uint16) bool {
+	return int(addr) < len(cov.Flags) && cov.Flags[addr]&CoverExecuted != 0
+}
+
+// IsData returns true if the byte at addr was accessed, but never executed.
+func (cov *Coverage) IsData(addr uint16) bool {
+	return int(addr) < len(cov.Flags) && cov.Flags[addr] != 0 && !cov.IsCode(addr)
+}
+
+func (flag CoverFlag) String() string {
+	if flag == 0 {
+		return "unused"
+	}
+	kinds := []string{}
+	if flag&CoverExecuted != 0 {
+		kinds = append(kinds, "code")
+	}
+	if flag&CoverRead != 0 {
+		kinds = append(kinds, "read")
+	}
+	if flag&CoverWritten != 0 {
+		kinds = append(kinds, "written")
+	}
+	return strings.Join(kinds, "+")
+}
+
+// Save writes the flags for the size bytes of memory starting at start.
+func (cov *Coverage) Save(filePath string, start uint16, size int) error {
+	buffer := make([]byte, size)
+	for offset := range buffer {
+		buffer[offset] = byte(cov.Flags[int(start)+offset])
+	}
+	return os.WriteFile(filePath, buffer, 0644)
+}
+
+// LoadCoverage reads a coverage file saved for memory starting at start.
+func LoadCoverage(filePath string, start uint16) (*Coverage, error) {
+	buffer, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if int(start)+len(buffer) > len(Coverage{}.Flags) {
+		return nil, fmt.Errorf("coverage file %v is too large (%v bytes)",
+			filePath, len(buffer))
+	}
+
+	cov := MakeCoverage()
+	for offset, value := range buffer {
+		cov.Flags[int(start)+offset] = CoverFlag(value)
+	}
+	return cov, nil
+}
+
+// Summary prints how the size bytes of memory starting at start were used,
+// followed by each run of bytes that were used the same way.
+func (cov *Coverage) Summary(w io.Writer, start uint16, size int) {
+	if size == 0 {
+		fmt.Fprintf(w, "Coverage: no bytes to summarize.\n")
+		return
+	}
+	end := int(start) + size
+	var code, data, both, written, unused int
+	for addr := int(start); addr < end; addr++ {
+		flag := cov.Flags[addr]
+		switch {
+		case flag == 0:
+			unused++
+		case flag&CoverExecuted != 0 && flag&(CoverRead|CoverWritten) != 0:
+			both++
+		case flag&CoverExecuted != 0:
+			code++
+		default:
+			data++
+		}
+		if flag&CoverWritten != 0 {
+			written++
+		}
+	}
+
+	percent := func(count int) float64 {
+		return 100 * float64(count) / float64(size)
+	}
+	fmt.Fprintf(w, "Coverage of %03X-%03X (%v bytes):\n", start, end-1, size)
+	fmt.Fprintf(w, "  Code:          %5v (%.2f%%)\n", code, percent(code))
+	fmt.Fprintf(w, "  Data:          %5v (%.2f%%)\n", data, percent(data))
+	fmt.Fprintf(w, "  Code and data: %5v (%.2f%%)\n", both, percent(both))
+	fmt.Fprintf(w, "  Unused:        %5v (%.2f%%)\n", unused, percent(unused))
+	fmt.Fprintf(w, "  Written:       %5v (%.2f%%)\n", written, percent(written))
+
+	fmt.Fprintf(w, "\nRanges:\n")
+	runStart := int(start)
+	for addr := int(start) + 1; addr <= end; addr++ {
+		if addr == end || cov.Flags[addr] != cov.Flags[runStart] {
+			fmt.Fprintf(w, "  %03X-%03X %v\n", runStart, addr-1, cov.Flags[runStart])
+			runStart = addr
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package arch
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.Coverage = MakeCoverage()
+
+	loadProgram(c8, []uint16{
+		0xA20A, // 200: Point index at 20A.
+		0xD001, // 202: Draw the sprite at 20A.
+		0xF033, // 204: Save V0 as BCD at 20A.
+		0x1206, // 206: Loop forever.
+		0x0000, // 208: Unused.
+		0x8000, // 20A: Sprite data.
+	})
+	for cycle := 0; cycle < 5; cycle++ {
+		c8.EmulateCycle()
+	}
+
+	cov := c8.Coverage
+	for addr := uint16(0x200); addr < 0x208; addr++ {
+		if !cov.IsCode(addr) {
+			t.Errorf("Byte at %X was not marked as code! Flags were %v\n",
+				addr, cov.Flags[addr])
+		}
+	}
+	if cov.Flags[0x208] != 0 || cov.Flags[0x209] != 0 {
+		t.Errorf("Unused bytes were marked as used!\n")
+	}
+	if cov.Flags[0x20A] != CoverRead|CoverWritten || !cov.IsData(0x20A) {
+		t.Errorf("Sprite byte was not marked as read and written! Flags were %v\n",
+			cov.Flags[0x20A])
+	}
+	if cov.Flags[0x20C] != CoverWritten {
+		t.Errorf("BCD byte was not marked as written! Flags were %v\n",
+			cov.Flags[0x20C])
+	}
+	if cov.IsCode(0xFFFF) || cov.IsData(0x1000) {
+		t.Errorf("Bytes past the end of memory were marked as used!\n")
+	}
+
+	// Check that the coverage map survives a round trip to disk.
+	path := filepath.Join(t.TempDir(), "coverage")
+	if err := cov.Save(path, 0x200, 0x10); err != nil {
+		t.Fatalf("Could not save coverage! Error was: %v\n", err)
+	}
+	loaded, err := LoadCoverage(path, 0x200)
+	if err != nil {
+		t.Fatalf("Could not load coverage! Error was: %v\n", err)
+	}
+	if loaded.Flags != cov.Flags {
+		t.Errorf("Loaded coverage did not match saved coverage!\n")
+	}
+}
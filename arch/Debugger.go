@@ -0,0 +1,504 @@
+package arch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Datatype to describe an interactive debugger console. Commands are read
+ * from the console in the background, but only run between frames by Run,
+ * so they never race with the emulated machine.
+ */
+type Debugger struct {
+	Breakpoints map[uint16]*Breakpoint
+	Watchpoints []Watchpoint
+	Hits        []WatchHit           // Watchpoint hits from the most recent cycle with any.
+	Until       func(c8 *Chip8) bool // If set, stop once it returns true, then forget it.
+	Out         io.Writer
+	commands    chan string
+	resuming    bool // True if we shouldn't break again before the next cycle.
+}
+
+const debuggerHelp = `Debugger commands:
+  help                     Show this message.
+  pause                    Pause emulation.
+  continue (c)             Resume emulation until the next breakpoint.
+  step (s) [N]             Execute N instructions (default 1), then pause.
+  next (n)                 Step over a call, stopping when it returns.
+  finish                   Run until the current subroutine returns.
+  reverse-step (rs) [N]    Go back N instructions (default 1).
+  reverse-continue (rc)    Go back to the previous breakpoint or watchpoint hit.
+  watch (w) LOC [MODE]     Break when an instruction accesses LOC, which is V0-VF, I,
+                           DT, ST, a hex address or a range like 300-30F. MODE is
+                           read, write (the default), change or access.
+  unwatch NUM              Remove a watchpoint.
+  watchpoints              List watchpoints.
+  break (b) ADDR [if EXPR] Set a breakpoint at a hex address, which only stops
+                           when EXPR (like "V3 == 0x10 && mem[I] != 0") is true.
+  trace (t) ADDR MESSAGE   Print MESSAGE without stopping whenever ADDR is reached.
+                           Each {EXPR} in it is replaced by its value ({EXPR:x} in hex).
+  condition ADDR [EXPR]    Change or remove the condition of a breakpoint.
+  ignore ADDR COUNT        Pass through a breakpoint COUNT more times before stopping.
+  delete (d) ADDR          Remove a breakpoint or tracepoint.
+  breakpoints              List breakpoints, with how often they were hit.
+  regs (r)                 Show all registers.
+  mem (x) ADDR [LEN]       Show LEN bytes of memory (default 16) at a hex address.
+  print (p) LOC|EXPR       Show V0-VF, I, DT, ST, the byte at a hex address, or the
+                           value of an expression over V0-VF, I, PC, SP, DT, ST and
+                           mem[ADDR], using C operators.
+  set LOC VALUE            Change V0-VF, I, DT, ST or the byte at a hex address.
+`
+
+// MakeDebugger starts reading commands from in, one per line.
+// If in is nil, there is no console, and the debugger is only
+// controlled through its methods.
+func MakeDebugger(in io.Reader, out io.Writer) *Debugger {
+	d := Debugger{}
+	d.Breakpoints = make(map[uint16]*Breakpoint)
+	d.Out = out
+	if in == nil {
+		return &d
+	}
+	d.commands = make(chan string)
+
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			d.commands <- scanner.Text()
+		}
+		close(d.commands)
+	}()
+	return &d
+}
+
+// Poll runs every command that is waiting, without blocking.
+func (d *Debugger) Poll(c8 *Chip8) {
+	for {
+		select {
+		case line, ok := <-d.commands:
+			if !ok {
+				d.commands = nil // Console closed; stop listening.
+				return
+			}
+			d.Exec(c8, line)
+			fmt.Fprintf(d.Out, "(chip8) ")
+		default:
+			return
+		}
+	}
+}
+
+// ShouldBreak returns true (and pauses) if a breakpoint is set at the PC.
+// It is checked before every cycle while running.
+func (d *Debugger) ShouldBreak(c8 *Chip8) bool {
+	if d.resuming {
+		d.resuming = false
+		return false
+	}
+	if d.hitBefore(c8) {
+		c8.Paused = true
+		fmt.Fprintf(d.Out, "\n")
+		d.PrintHits()
+		d.PrintInstruction(c8)
+		fmt.Fprintf(d.Out, "(chip8) ")
+		return true
+	}
+	if d.Until != nil && d.Until(c8) {
+		d.Until = nil
+		c8.Paused = true
+		fmt.Fprintf(d.Out, "\n")
+		d.PrintInstruction(c8)
+		fmt.Fprintf(d.Out, "(chip8) ")
+		return true
+	}
+	if bp := d.Breakpoints[c8.PC]; bp != nil && bp.Hit(c8, d.Out) {
+		c8.Paused = true
+		fmt.Fprintf(d.Out, "\nBreakpoint at %03X.\n", c8.PC)
+		d.PrintInstruction(c8)
+		fmt.Fprintf(d.Out, "(chip8) ")
+		return true
+	}
+	return false
+}
+
+// Access checks an access by an instruction against the watchpoints.
+func (d *Debugger) Access(c8 *Chip8, loc Location, kind AccessKind, old, new uint16) {
+	for index, w := range d.Watchpoints {
+		if !w.Matches(loc, kind, old, new) {
+			continue
+		}
+		if len(d.Hits) > 0 && d.Hits[0].Cycle != c8.Cycle {
+			d.Hits = nil // Forget hits from earlier cycles.
+		}
+		d.Hits = append(d.Hits, WatchHit{index + 1, loc, kind, old, new, c8.Cycle, c8.PC, c8.Opcode})
+	}
+}
+
+// RecentHits returns the watchpoint hits from the cycle just before this one.
+func (d *Debugger) RecentHits(c8 *Chip8) []WatchHit {
+	if len(d.Hits) > 0 && d.Hits[0].Cycle+1 == c8.Cycle {
+		return d.Hits
+	}
+	return nil
+}
+
+func (d *Debugger) hitBefore(c8 *Chip8) bool {
+	return d.RecentHits(c8) != nil
+}
+
+// Continue resumes emulation, without breaking again at the current PC.
+func (d *Debugger) Continue(c8 *Chip8) {
+	c8.Paused = false
+	d.resuming = true
+}
+
+// StepOver executes one instruction, unless it is a call, in which case it
+// continues until the call returns. It returns false if it continued.
+func (d *Debugger) StepOver(c8 *Chip8) bool {
+	op := c8.OpcodeAt(c8.PC)
+	if Decode(op) != &InstrCall {
+		c8.Paused = true
+		c8.EmulateCycle()
+		return true
+	}
+	returnAddr, sp := c8.PC+2, c8.SP
+	d.Until = func(c8 *Chip8) bool { return c8.PC == returnAddr && c8.SP == sp }
+	d.Continue(c8)
+	return false
+}
+
+// StepOut continues until the current subroutine returns.
+func (d *Debugger) StepOut(c8 *Chip8) error {
+	if c8.SP == 0 {
+		return fmt.Errorf("not in a subroutine")
+	}
+	sp := c8.SP
+	d.Until = func(c8 *Chip8) bool { return c8.SP < sp }
+	d.Continue(c8)
+	return nil
+}
+
+// ReverseStep pauses and goes back count cycles.
+func (d *Debugger) ReverseStep(c8 *Chip8, count uint64) error {
+	if c8.History == nil {
+		return fmt.Errorf("time travel is off")
+	}
+	c8.Paused = true
+	if count > c8.Cycle {
+		count = c8.Cycle
+	}
+	return c8.History.Seek(c8, c8.Cycle-count)
+}
+
+// ReverseContinue pauses and goes back to the previous breakpoint or
+// watchpoint hit. It returns false if it reached the start of history instead.
+func (d *Debugger) ReverseContinue(c8 *Chip8) (bool, error) {
+	if c8.History == nil {
+		return false, fmt.Errorf("time travel is off")
+	}
+	c8.Paused = true
+	return c8.History.SeekBack(c8, func(c8 *Chip8) bool {
+		bp := d.Breakpoints[c8.PC]
+		return bp != nil && bp.Message == "" && bp.Matches(c8) || d.hitBefore(c8)
+	})
+}
+
+// Exec runs a single command line.
+func (d *Debugger) Exec(c8 *Chip8, line string) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	if err := d.exec(c8, line, args); err != nil {
+		fmt.Fprintf(d.Out, "Error: %v\n", err)
+	}
+}
+
+func (d *Debugger) exec(c8 *Chip8, line string, args []string) error {
+	switch args[0] {
+	case "help", "h":
+		fmt.Fprint(d.Out, debuggerHelp, cheatHelp)
+	case "pause":
+		c8.Paused = true
+		d.PrintInstruction(c8)
+	case "continue", "c":
+		d.Continue(c8)
+	case "step", "s":
+		count := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("%q is not a number of steps", args[1])
+			}
+			count = n
+		}
+		c8.Paused = true
+		err := c8.PauseOnFault(func() {
+			for step := 0; step < count; step++ {
+				c8.EmulateCycle()
+				if d.hitBefore(c8) {
+					d.PrintHits()
+					break
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		d.PrintInstruction(c8)
+	case "next", "n":
+		stepped := false
+		if err := c8.PauseOnFault(func() { stepped = d.StepOver(c8) }); err != nil {
+			return err
+		}
+		if stepped {
+			d.PrintInstruction(c8)
+		}
+	case "finish":
+		return d.StepOut(c8)
+	case "reverse-step", "rs":
+		count := uint64(1)
+		if len(args) > 1 {
+			n, err := strconv.ParseUint(args[1], 10, 64)
+			if err != nil || n < 1 {
+				return fmt.Errorf("%q is not a number of steps", args[1])
+			}
+			count = n
+		}
+		if err := d.ReverseStep(c8, count); err != nil {
+			return err
+		}
+		d.PrintInstruction(c8)
+	case "reverse-continue", "rc":
+		hit, err := d.ReverseContinue(c8)
+		if err != nil {
+			return err
+		}
+		if hit && d.hitBefore(c8) {
+			d.PrintHits()
+		} else if hit {
+			fmt.Fprintf(d.Out, "Breakpoint at %03X.\n", c8.PC)
+		} else {
+			fmt.Fprintf(d.Out, "Reached the start of history.\n")
+		}
+		d.PrintInstruction(c8)
+	case "break", "b":
+		if len(args) != 2 && (len(args) < 4 || args[2] != "if") {
+			return fmt.Errorf("usage: break ADDR [if EXPR]")
+		}
+		addr, err := ParseAddress(args[1])
+		if err != nil {
+			return err
+		}
+		bp := &Breakpoint{Addr: addr}
+		if len(args) > 2 {
+			if bp.Cond, err = ParseExpr(afterFields(line, 3)); err != nil {
+				return err
+			}
+		}
+		d.Breakpoints[addr] = bp
+		fmt.Fprintf(d.Out, "Breakpoint set at %03X.\n", addr)
+	case "trace", "t":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: trace ADDR MESSAGE")
+		}
+		addr, err := ParseAddress(args[1])
+		if err != nil {
+			return err
+		}
+		d.Breakpoints[addr] = &Breakpoint{Addr: addr, Message: afterFields(line, 2)}
+		fmt.Fprintf(d.Out, "Tracepoint set at %03X.\n", addr)
+	case "delete", "d", "condition", "ignore":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %v ADDR", args[0])
+		}
+		addr, err := ParseAddress(args[1])
+		if err != nil {
+			return err
+		}
+		bp := d.Breakpoints[addr]
+		if bp == nil {
+			return fmt.Errorf("no breakpoint at %03X", addr)
+		}
+		switch args[0] {
+		case "condition":
+			bp.Cond = nil
+			if len(args) > 2 {
+				if bp.Cond, err = ParseExpr(afterFields(line, 2)); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(d.Out, "%v\n", bp)
+		case "ignore":
+			if len(args) != 3 {
+				return fmt.Errorf("usage: ignore ADDR COUNT")
+			}
+			count, err := strconv.Atoi(args[2])
+			if err != nil || count < 0 {
+				return fmt.Errorf("%q is not a count", args[2])
+			}
+			bp.Ignore = bp.Hits + count
+			fmt.Fprintf(d.Out, "%v\n", bp)
+		default:
+			delete(d.Breakpoints, addr)
+			fmt.Fprintf(d.Out, "Breakpoint at %03X removed.\n", addr)
+		}
+	case "breakpoints":
+		addrs := []int{}
+		for addr := range d.Breakpoints {
+			addrs = append(addrs, int(addr))
+		}
+		sort.Ints(addrs)
+		for _, addr := range addrs {
+			fmt.Fprintf(d.Out, "  %v\n", d.Breakpoints[uint16(addr)])
+		}
+	case "watch", "w":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: watch LOC [read|write|change|access]")
+		}
+		mode := string(WatchWrite)
+		if len(args) == 3 {
+			mode = args[2]
+		}
+		w, err := ParseWatchpoint(args[1], mode)
+		if err != nil {
+			return err
+		}
+		d.Watchpoints = append(d.Watchpoints, w)
+		fmt.Fprintf(d.Out, "Watchpoint %v: %v.\n", len(d.Watchpoints), w)
+	case "unwatch":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: unwatch NUM")
+		}
+		num, err := strconv.Atoi(args[1])
+		if err != nil || num < 1 || num > len(d.Watchpoints) {
+			return fmt.Errorf("no watchpoint %q", args[1])
+		}
+		d.Watchpoints = append(d.Watchpoints[:num-1], d.Watchpoints[num:]...)
+		d.Hits = nil
+		fmt.Fprintf(d.Out, "Watchpoint %v removed.\n", num)
+	case "watchpoints":
+		for index, w := range d.Watchpoints {
+			fmt.Fprintf(d.Out, "  %v. %v\n", index+1, w)
+		}
+	case "regs", "r":
+		d.PrintRegisters(c8)
+	case "mem", "x":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: mem ADDR [LEN]")
+		}
+		addr, err := ParseAddress(args[1])
+		if err != nil {
+			return err
+		}
+		length := uint16(16)
+		if len(args) == 3 {
+			if length, err = ParseValue(args[2]); err != nil {
+				return err
+			}
+		}
+		d.PrintMemory(c8, addr, length)
+	case "print", "p":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: print LOC|EXPR")
+		}
+		if loc, err := ParseLocation(args[1]); err == nil && len(args) == 2 {
+			value := c8.Get(loc)
+			fmt.Fprintf(d.Out, "%v = %v (0x%X)\n", loc, value, value)
+			return nil
+		}
+		expr, err := ParseExpr(afterFields(line, 1))
+		if err != nil {
+			return err
+		}
+		value, err := expr.Eval(c8)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(d.Out, "%v = %v (0x%X)\n", expr, value, value)
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: set LOC VALUE")
+		}
+		freeze, err := ParseFreeze(args[1] + "=" + args[2])
+		if err != nil {
+			return err
+		}
+		c8.Set(freeze.Loc, freeze.Value)
+		if c8.History != nil {
+			c8.History.Diverge(c8)
+		}
+	default:
+		if c8.Cheats == nil {
+			c8.Cheats = MakeCheats()
+		}
+		handled, err := c8.Cheats.Exec(c8, args, d.Out)
+		if !handled {
+			return fmt.Errorf("unknown command %q; type \"help\" for a list", args[0])
+		}
+		if args[0] == "freeze" && err == nil && c8.History != nil {
+			c8.History.Diverge(c8)
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *Debugger) PrintHits() {
+	for _, hit := range d.Hits {
+		fmt.Fprintf(d.Out, "%v\n", hit)
+	}
+}
+
+// Returns the rest of a line after skipping some words.
+func afterFields(line string, skip int) string {
+	line = strings.TrimSpace(line)
+	for ; skip > 0; skip-- {
+		if index := strings.IndexAny(line, " \t"); index >= 0 {
+			line = strings.TrimSpace(line[index:])
+		} else {
+			line = ""
+		}
+	}
+	return line
+}
+
+// PrintInstruction shows the instruction that will run next.
+func (d *Debugger) PrintInstruction(c8 *Chip8) {
+	op := c8.OpcodeAt(c8.PC)
+	fmt.Fprintf(d.Out, "%03X: %04X %v\n", c8.PC, op.Value, Decode(op).Name)
+}
+
+func (d *Debugger) PrintRegisters(c8 *Chip8) {
+	for reg, value := range c8.Registers {
+		fmt.Fprintf(d.Out, "V%X=%02X ", reg, value)
+		if reg%8 == 7 {
+			fmt.Fprintf(d.Out, "\n")
+		}
+	}
+	fmt.Fprintf(d.Out, "I=%03X PC=%03X SP=%X DT=%02X ST=%02X Cycle=%v\n",
+		c8.IndexReg, c8.PC, c8.SP, c8.DelayTimer, c8.SoundTimer, c8.Cycle)
+	fmt.Fprintf(d.Out, "Stack:")
+	for _, addr := range c8.Stack[:c8.SP] {
+		fmt.Fprintf(d.Out, " %03X", addr)
+	}
+	fmt.Fprintf(d.Out, "\n")
+}
+
+func (d *Debugger) PrintMemory(c8 *Chip8, addr, length uint16) {
+	for offset := uint16(0); offset < length && int(addr+offset) < len(c8.Memory); offset++ {
+		if offset%16 == 0 {
+			if offset > 0 {
+				fmt.Fprintf(d.Out, "\n")
+			}
+			fmt.Fprintf(d.Out, "%03X:", addr+offset)
+		}
+		fmt.Fprintf(d.Out, " %02X", c8.Memory[addr+offset])
+	}
+	fmt.Fprintf(d.Out, "\n")
+}
@@ -0,0 +1,141 @@
+package arch
+
+/**
+ * Datatype to describe a decoded Chip8 instruction.
+ */
+type Instruction struct {
+	Name    string // Name of the InstructionSet method, e.g. "DrawSprite".
+	Pattern string // Opcode pattern from the Chip8 opcode table, e.g. "DXYN".
+	Execute func(c8 *Chip8)
+}
+
+// The full Chip8 instruction table. Decode returns pointers into it,
+// so callers may compare against these to identify an instruction.
+var (
+	InstrClearScreen              = Instruction{"ClearScreen", "00E0", (*Chip8).ClearScreen}
+	InstrReturn                   = Instruction{"Return", "00EE", (*Chip8).Return}
+	InstrCallRCA1802              = Instruction{"CallRCA1802", "0NNN", (*Chip8).CallRCA1802}
+	InstrJump                     = Instruction{"Jump", "1NNN", (*Chip8).Jump}
+	InstrCall                     = Instruction{"Call", "2NNN", (*Chip8).Call}
+	InstrSkipInstrEqualLiteral    = Instruction{"SkipInstrEqualLiteral", "3XNN", (*Chip8).SkipInstrEqualLiteral}
+	InstrSkipInstrNotEqualLiteral = Instruction{"SkipInstrNotEqualLiteral", "4XNN", (*Chip8).SkipInstrNotEqualLiteral}
+	InstrSkipInstrEqualReg        = Instruction{"SkipInstrEqualReg", "5XY0", (*Chip8).SkipInstrEqualReg}
+	InstrSetRegToLiteral          = Instruction{"SetRegToLiteral", "6XNN", (*Chip8).SetRegToLiteral}
+	InstrAdd                      = Instruction{"Add", "7XNN", (*Chip8).Add}
+	InstrSetRegToReg              = Instruction{"SetRegToReg", "8XY0", (*Chip8).SetRegToReg}
+	InstrOr                       = Instruction{"Or", "8XY1", (*Chip8).Or}
+	InstrAnd                      = Instruction{"And", "8XY2", (*Chip8).And}
+	InstrXor                      = Instruction{"Xor", "8XY3", (*Chip8).Xor}
+	InstrAddWithCarry             = Instruction{"AddWithCarry", "8XY4", (*Chip8).AddWithCarry}
+	InstrSubYFromX                = Instruction{"SubYFromX", "8XY5", (*Chip8).SubYFromX}
+	InstrShiftRight               = Instruction{"ShiftRight", "8XY6", (*Chip8).ShiftRight}
+	InstrSubXFromY                = Instruction{"SubXFromY", "8XY7", (*Chip8).SubXFromY}
+	InstrShiftLeft                = Instruction{"ShiftLeft", "8XYE", (*Chip8).ShiftLeft}
+	InstrSkipInstrNotEqualReg     = Instruction{"SkipInstrNotEqualReg", "9XY0", (*Chip8).SkipInstrNotEqualReg}
+	InstrSetIndexLiteral          = Instruction{"SetIndexLiteral", "ANNN", (*Chip8).SetIndexLiteral}
+	InstrJumpIndexLiteralOffset   = Instruction{"JumpIndexLiteralOffset", "BNNN", (*Chip8).JumpIndexLiteralOffset}
+	InstrSetRegisterRandomMask    = Instruction{"SetRegisterRandomMask", "CXNN", (*Chip8).SetRegisterRandomMask}
+	InstrDrawSprite               = Instruction{"DrawSprite", "DXYN", (*Chip8).DrawSprite}
+	InstrSkipInstrKeyPressed      = Instruction{"SkipInstrKeyPressed", "EX9E", (*Chip8).SkipInstrKeyPressed}
+	InstrSkipInstrKeyNotPressed   = Instruction{"SkipInstrKeyNotPressed", "EXA1", (*Chip8).SkipInstrKeyNotPressed}
+	InstrGetDelayTimer            = Instruction{"GetDelayTimer", "FX07", (*Chip8).GetDelayTimer}
+	InstrGetKeyPress              = Instruction{"GetKeyPress", "FX0A", (*Chip8).GetKeyPress}
+	InstrSetDelayTimer            = Instruction{"SetDelayTimer", "FX15", (*Chip8).SetDelayTimer}
+	InstrSetSoundTimer            = Instruction{"SetSoundTimer", "FX18", (*Chip8).SetSoundTimer}
+	InstrAddRegisterToIndex       = Instruction{"AddRegisterToIndex", "FX1E", (*Chip8).AddRegisterToIndex}
+	InstrSetIndexToSprite         = Instruction{"SetIndexToSprite", "FX29", (*Chip8).SetIndexToSprite}
+	InstrSaveBinaryCodedDecimal   = Instruction{"SaveBinaryCodedDecimal", "FX33", (*Chip8).SaveBinaryCodedDecimal}
+	InstrSaveRegisters            = Instruction{"SaveRegisters", "FX55", (*Chip8).SaveRegisters}
+	InstrRestoreRegisters         = Instruction{"RestoreRegisters", "FX65", (*Chip8).RestoreRegisters}
+	InstrUnknownInstruction       = Instruction{"UnknownInstruction", "????", (*Chip8).UnknownInstruction}
+)
+
+// Decode maps an opcode to the instruction that DecodeExecute would run.
+// It has no side effects, so it is safe to use for static analysis.
+func Decode(op Opcode) *Instruction {
+	switch op.Value >> 12 { // Decode (big-ass switch statement)
+	case 0x0:
+		switch op.Value & 0xFF {
+		case 0xE0:
+			return &InstrClearScreen
+		case 0xEE:
+			return &InstrReturn
+		default:
+			return &InstrCallRCA1802
+		}
+	case 0x1:
+		return &InstrJump
+	case 0x2:
+		return &InstrCall
+	case 0x3:
+		return &InstrSkipInstrEqualLiteral
+	case 0x4:
+		return &InstrSkipInstrNotEqualLiteral
+	case 0x5:
+		return &InstrSkipInstrEqualReg
+	case 0x6:
+		return &InstrSetRegToLiteral
+	case 0x7:
+		return &InstrAdd
+	case 0x8:
+		switch op.Value & 0xF {
+		case 0x0:
+			return &InstrSetRegToReg
+		case 0x1:
+			return &InstrOr
+		case 0x2:
+			return &InstrAnd
+		case 0x3:
+			return &InstrXor
+		case 0x4:
+			return &InstrAddWithCarry
+		case 0x5:
+			return &InstrSubYFromX
+		case 0x6:
+			return &InstrShiftRight
+		case 0x7:
+			return &InstrSubXFromY
+		case 0xE:
+			return &InstrShiftLeft
+		}
+	case 0x9:
+		return &InstrSkipInstrNotEqualReg
+	case 0xA:
+		return &InstrSetIndexLiteral
+	case 0xB:
+		return &InstrJumpIndexLiteralOffset
+	case 0xC:
+		return &InstrSetRegisterRandomMask
+	case 0xD:
+		return &InstrDrawSprite
+	case 0xE:
+		switch op.Value & 0xFF {
+		case 0x9E:
+			return &InstrSkipInstrKeyPressed
+		case 0xA1:
+			return &InstrSkipInstrKeyNotPressed
+		}
+	case 0xF:
+		switch op.Value & 0xFF {
+		case 0x07:
+			return &InstrGetDelayTimer
+		case 0x0A:
+			return &InstrGetKeyPress
+		case 0x15:
+			return &InstrSetDelayTimer
+		case 0x18:
+			return &InstrSetSoundTimer
+		case 0x1E:
+			return &InstrAddRegisterToIndex
+		case 0x29:
+			return &InstrSetIndexToSprite
+		case 0x33:
+			return &InstrSaveBinaryCodedDecimal
+		case 0x55:
+			return &InstrSaveRegisters
+		case 0x65:
+			return &InstrRestoreRegisters
+		}
+	}
+	return &InstrUnknownInstruction
+}
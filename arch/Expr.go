@@ -0,0 +1,341 @@
+package arch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Datatype to describe a debugger expression, such as
+ * "V3 == 0x10 && mem[I] != 0". Expressions work on integers, using the
+ * operators and precedence of C, and can refer to V0-VF, I, PC, SP, DT,
+ * ST, and bytes of memory as mem[ADDR]. Comparisons give 1 or 0.
+ */
+type Expr struct {
+	Source string
+	root   *exprNode
+}
+
+type exprNode struct {
+	op    string // Operator, or "num", "var" or "mem".
+	value int    // Value of a number.
+	name  string // Name of a variable.
+	left  *exprNode
+	right *exprNode
+}
+
+// Binary operators, from lowest to highest precedence.
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func ParseExpr(source string) (*Expr, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	p := exprParser{tokens: tokens}
+	root, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos])
+	}
+	return &Expr{source, root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.Source
+}
+
+// Eval computes the value of the expression for the current state.
+func (e *Expr) Eval(c8 *Chip8) (int, error) {
+	return e.root.eval(c8)
+}
+
+// True returns whether the expression has a non-zero value.
+func (e *Expr) True(c8 *Chip8) (bool, error) {
+	value, err := e.Eval(c8)
+	return value != 0, err
+}
+
+func tokenizeExpr(source string) ([]string, error) {
+	tokens := []string{}
+	for pos := 0; pos < len(source); {
+		char := source[pos]
+		switch {
+		case char == ' ' || char == '\t':
+			pos++
+		case isExprWordChar(char):
+			start := pos
+			for pos < len(source) && isExprWordChar(source[pos]) {
+				pos++
+			}
+			tokens = append(tokens, source[start:pos])
+		case strings.ContainsRune("|&=!<>", rune(char)) && pos+1 < len(source) &&
+			isExprOperator(source[pos:pos+2]):
+			tokens = append(tokens, source[pos:pos+2])
+			pos += 2
+		case strings.ContainsRune("+-*/%&|^!~<>()[]", rune(char)):
+			tokens = append(tokens, source[pos:pos+1])
+			pos++
+		default:
+			return nil, fmt.Errorf("unexpected %q in expression", char)
+		}
+	}
+	return tokens, nil
+}
+
+func isExprWordChar(char byte) bool {
+	return char >= '0' && char <= '9' || char >= 'a' && char <= 'z' ||
+		char >= 'A' && char <= 'Z' || char == '_'
+}
+
+func isExprOperator(token string) bool {
+	for _, level := range exprPrecedence {
+		for _, op := range level {
+			if op == token {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) expect(token string) error {
+	if p.peek() != token {
+		return fmt.Errorf("expected %q in expression", token)
+	}
+	p.pos++
+	return nil
+}
+
+// Parses binary operators at the given precedence level or higher.
+func (p *exprParser) parseBinary(level int) (*exprNode, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, candidate := range exprPrecedence[level] {
+			found = found || op == candidate
+		}
+		if !found {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (*exprNode, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("expression ended early")
+	case token == "-" || token == "!" || token == "~":
+		operand, err := p.parseUnary()
+		return &exprNode{op: token, left: operand}, err
+	case token == "(":
+		node, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	case strings.EqualFold(token, "mem"):
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		addr, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: "mem", left: addr}, p.expect("]")
+	case token[0] >= '0' && token[0] <= '9':
+		value, err := strconv.ParseUint(token, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", token)
+		}
+		return &exprNode{op: "num", value: int(value)}, nil
+	}
+
+	name := strings.ToUpper(token)
+	switch name {
+	case "I", "PC", "SP", "DT", "ST":
+		return &exprNode{op: "var", name: name}, nil
+	}
+	if len(name) == 2 && name[0] == 'V' {
+		if reg, err := strconv.ParseUint(name[1:], 16, 8); err == nil {
+			return &exprNode{op: "var", name: name, value: int(reg)}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown name %q in expression", token)
+}
+
+func (node *exprNode) eval(c8 *Chip8) (int, error) {
+	switch node.op {
+	case "num":
+		return node.value, nil
+	case "var":
+		switch node.name {
+		case "I":
+			return int(c8.IndexReg), nil
+		case "PC":
+			return int(c8.PC), nil
+		case "SP":
+			return int(c8.SP), nil
+		case "DT":
+			return int(c8.DelayTimer), nil
+		case "ST":
+			return int(c8.SoundTimer), nil
+		default:
+			return int(c8.Registers[node.value]), nil
+		}
+	}
+
+	left, err := node.left.eval(c8)
+	if err != nil {
+		return 0, err
+	}
+	switch node.op {
+	case "mem":
+		if left < 0 || left >= len(c8.Memory) {
+			return 0, fmt.Errorf("mem[%X] is out of range", left)
+		}
+		return int(c8.Memory[left]), nil
+	case "-":
+		if node.right == nil {
+			return -left, nil
+		}
+	case "!":
+		return boolToInt(left == 0), nil
+	case "~":
+		return ^left, nil
+	case "&&", "||":
+		// Short-circuit, so "V0 != 0 && 10 / V0 > 2" is safe.
+		if (node.op == "&&") == (left == 0) {
+			return boolToInt(left != 0), nil
+		}
+	}
+
+	right, err := node.right.eval(c8)
+	if err != nil {
+		return 0, err
+	}
+	switch node.op {
+	case "&&", "||":
+		return boolToInt(right != 0), nil
+	case "|":
+		return left | right, nil
+	case "^":
+		return left ^ right, nil
+	case "&":
+		return left & right, nil
+	case "==":
+		return boolToInt(left == right), nil
+	case "!=":
+		return boolToInt(left != right), nil
+	case "<":
+		return boolToInt(left < right), nil
+	case "<=":
+		return boolToInt(left <= right), nil
+	case ">":
+		return boolToInt(left > right), nil
+	case ">=":
+		return boolToInt(left >= right), nil
+	case "<<":
+		return left << uint(right&63), nil
+	case ">>":
+		return left >> uint(right&63), nil
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/", "%":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		if node.op == "/" {
+			return left / right, nil
+		}
+		return left % right, nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", node.op)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// FormatMessage replaces each {EXPR} in a message with its value,
+// or {EXPR:x} with its value in hex.
+func FormatMessage(c8 *Chip8, message string) string {
+	out := strings.Builder{}
+	for {
+		start := strings.Index(message, "{")
+		end := -1
+		if start >= 0 {
+			end = strings.Index(message[start:], "}")
+		}
+		if end < 0 {
+			out.WriteString(message)
+			return out.String()
+		}
+		end += start
+		out.WriteString(message[:start])
+		source, format := message[start+1:end], "%v"
+		if trimmed, found := strings.CutSuffix(source, ":x"); found {
+			source, format = trimmed, "%X"
+		}
+
+		expr, err := ParseExpr(source)
+		value := 0
+		if err == nil {
+			value, err = expr.Eval(c8)
+		}
+		if err != nil {
+			fmt.Fprintf(&out, "<%v>", err)
+		} else {
+			fmt.Fprintf(&out, format, value)
+		}
+		message = message[end+1:]
+	}
+}
@@ -0,0 +1,106 @@
+package arch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.Registers[3] = 0x10
+	c8.IndexReg = 0x300
+	c8.Memory[0x301] = 7
+
+	tests := map[string]int{
+		"V3 == 0x10 && mem[I] != 0":   0,
+		"V3 == 0x10 && mem[I+1] == 7": 1,
+		"1 + 2 * 3":                   7,
+		"(1 + 2) * 3":                 9,
+		"-v3 + ~0":                    -17,
+		"I >> 4 | 1 << 2":             0x34,
+		"V0 != 0 && 10 / V0":          0, // Short-circuits before dividing by zero.
+		"PC - 0x200 == SP":            1,
+		"!(DT < 3) || mem[0x301] % 4": 1,
+	}
+	for source, expected := range tests {
+		expr, err := ParseExpr(source)
+		if err != nil {
+			t.Errorf("Could not parse %q! Error was: %v\n", source, err)
+			continue
+		}
+		if value, err := expr.Eval(c8); err != nil || value != expected {
+			t.Errorf("%q was %v (error %v), expected %v!\n", source, value, err, expected)
+		}
+	}
+
+	for _, source := range []string{"V3 = 1", "mem[I", "VG", "1 +", "(2))"} {
+		if _, err := ParseExpr(source); err == nil {
+			t.Errorf("Parsing %q should have failed!\n", source)
+		}
+	}
+	if expr, _ := ParseExpr("1 / V0"); expr != nil {
+		if _, err := expr.Eval(c8); err == nil {
+			t.Errorf("Dividing by zero should fail!\n")
+		}
+	}
+	if message := FormatMessage(c8, "a} {V3} {I:x} {"); message != "a} 16 300 {" {
+		t.Errorf("Formatted message was %q\n", message)
+	}
+}
+
+func TestConditionalBreakpoints(t *testing.T) {
+	c8 := MakeChip8(false)
+	out := bytes.Buffer{}
+	d := MakeDebugger(strings.NewReader(""), &out)
+	loadProgram(c8, []uint16{
+		0x7001, // 200: Add 1 to V0.
+		0x1200, // 202: Loop.
+	})
+	run := func() {
+		c8.Paused = false
+		d.resuming = true
+		for cycle := 0; cycle < 100 && !c8.Paused; cycle++ {
+			if !d.ShouldBreak(c8) {
+				c8.EmulateCycle()
+			}
+		}
+	}
+
+	d.Exec(c8, "break 202 if V0 % 5 == 0")
+	run()
+	if c8.Registers[0] != 5 {
+		t.Errorf("Conditional breakpoint stopped with V0 = %v, expected 5!\n", c8.Registers[0])
+	}
+
+	d.Exec(c8, "ignore 202 2")
+	run()
+	if c8.Registers[0] != 20 {
+		t.Errorf("Ignored breakpoint stopped with V0 = %v, expected 20!\n", c8.Registers[0])
+	}
+
+	d.Exec(c8, "trace 200 V0 is  {V0:x}")
+	d.Exec(c8, "break 202 if V0 == 0x17")
+	out.Reset()
+	run()
+	if c8.Registers[0] != 0x17 || !strings.Contains(out.String(), "200: V0 is  16\n") {
+		t.Errorf("Tracepoint did not print as expected! Output was:\n%v", out.String())
+	}
+
+	out.Reset()
+	c8.Memory[0x204], c8.Memory[0x205] = 0x01, 0x23 // Machine code.
+	c8.PC = 0x204
+	d.Exec(c8, "step")
+	if !strings.Contains(out.String(), "Error: Unimplemented") || !c8.Paused || c8.Fault == nil {
+		t.Errorf("Stepping into machine code printed %q\n", out.String())
+	}
+	c8.PC = 0xFFF // Half an instruction.
+	d.Exec(c8, "pause")
+	c8.PC = 0x200
+
+	out.Reset()
+	d.Exec(c8, "print V0 * 2 + mem[0x200]")
+	if out.String() != "V0 * 2 + mem[0x200] = 158 (0x9E)\n" {
+		t.Errorf("Print showed %q\n", out.String())
+	}
+}
@@ -0,0 +1,94 @@
+package arch
+
+import (
+	"fmt"
+)
+
+/**
+ * Datatype to describe an error in a running game, such as an unknown
+ * instruction or a stack overflow. Instructions stop by panicking with a
+ * *Fault, which CatchFault turns back into an error. Any other panic is
+ * a bug in the emulator itself.
+ */
+type Fault struct {
+	Kind   FaultKind
+	PC     uint16 // Address of the instruction at fault.
+	Opcode uint16
+	Value  uint16 // The address, key or routine that was out of range.
+}
+
+type FaultKind int
+
+const (
+	FaultUnknownInstruction FaultKind = iota
+	FaultMachineCode                  // Calls to machine code routines (0NNN) can't be emulated.
+	FaultStackOverflow
+	FaultStackUnderflow
+	FaultMemory // Memory access past the end of memory.
+	FaultPC     // Jump or step past the end of memory.
+	FaultKey    // Key number above F.
+)
+
+var faultKindNames = [...]string{"unknown instruction", "machine code call",
+	"stack overflow", "stack underflow", "memory", "PC", "key"}
+
+func (k FaultKind) String() string {
+	if int(k) < len(faultKindNames) {
+		return faultKindNames[k]
+	}
+	return fmt.Sprintf("FaultKind(%d)", int(k))
+}
+
+func (f *Fault) Error() string {
+	at := fmt.Sprintf("at %03X (opcode %04X)", f.PC, f.Opcode)
+	switch f.Kind {
+	case FaultUnknownInstruction:
+		return "Unknown instruction " + at
+	case FaultMachineCode:
+		return fmt.Sprintf("Unimplemented machine code routine %03X called %v", f.Value, at)
+	case FaultStackOverflow:
+		return "Stack overflow " + at
+	case FaultStackUnderflow:
+		return "Return with an empty stack " + at
+	case FaultMemory:
+		return fmt.Sprintf("Memory access at %X is out of bounds %v", f.Value, at)
+	case FaultPC:
+		return fmt.Sprintf("Jump to %X is out of bounds %v", f.Value, at)
+	case FaultKey:
+		return fmt.Sprintf("Key %X does not exist %v", f.Value, at)
+	}
+	return "Fault " + at
+}
+
+// Stops the current instruction with a fault.
+func (c8 *Chip8) fault(kind FaultKind, value uint16) {
+	panic(&Fault{kind, c8.PC, c8.Opcode.Value, value})
+}
+
+// PauseOnFault runs emulate, and if the game faults, pauses the machine
+// and returns the fault instead of panicking. The fault stays in c8.Fault
+// until the next cycle, so that servers can report why the machine stopped.
+func (c8 *Chip8) PauseOnFault(emulate func()) (err error) {
+	defer func() {
+		if fault, ok := err.(*Fault); ok {
+			c8.Paused = true
+			c8.Fault = fault
+		}
+	}()
+	defer CatchFault(&err)
+	emulate()
+	return nil
+}
+
+// CatchFault recovers a fault into *err, for use as
+// "defer arch.CatchFault(&err)" around emulation.
+// Other panics keep going, since they are bugs.
+func CatchFault(err *error) {
+	if r := recover(); r != nil {
+		fault, ok := r.(*Fault)
+		if !ok {
+			panic(r)
+		}
+		*err = fault
+	}
+}
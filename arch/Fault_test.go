@@ -0,0 +1,143 @@
+package arch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Runs a program until it faults, or for a number of cycles.
+func runUntilFault(c8 *Chip8, cycles int) (err error) {
+	defer CatchFault(&err)
+	for i := 0; i < cycles; i++ {
+		c8.ExecuteCycle()
+	}
+	return nil
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		kind    FaultKind
+		pc      uint16
+	}{
+		{"unknown", []byte{0x8A, 0xB9}, FaultUnknownInstruction, 0x200},
+		{"machine code", []byte{0x60, 0x00, 0x01, 0x23}, FaultMachineCode, 0x202},
+		{"overflow", []byte{0x22, 0x00}, FaultStackOverflow, 0x200},
+		{"underflow", []byte{0x00, 0xEE}, FaultStackUnderflow, 0x200},
+		{"memory", []byte{0xAF, 0xFF, 0xF1, 0x55}, FaultMemory, 0x202},
+		{"jump", []byte{0x60, 0xFF, 0xBF, 0xFF}, FaultPC, 0x202},
+		{"key", []byte{0x60, 0x10, 0xE0, 0x9E}, FaultKey, 0x202},
+	}
+	for _, test := range tests {
+		c8 := MakeChip8(false)
+		c8.LoadROM(test.program)
+		err := runUntilFault(c8, 100)
+
+		fault := &Fault{}
+		if !errors.As(err, &fault) {
+			t.Errorf("%v: expected a fault, got %v\n", test.name, err)
+		} else if fault.Kind != test.kind || fault.PC != test.pc {
+			t.Errorf("%v: expected fault %v at %03X, got %v at %03X (%v)\n",
+				test.name, test.kind, test.pc, fault.Kind, fault.PC, fault)
+		}
+	}
+}
+
+func TestRunningOffTheEnd(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.PC = 0xFFC // The second instruction has nowhere to step to.
+	c8.Memory[0xFFC], c8.Memory[0xFFE] = 0x60, 0x60
+
+	fault := &Fault{}
+	if err := runUntilFault(c8, 3); !errors.As(err, &fault) || fault.Kind != FaultPC || fault.Value != 0x1000 {
+		t.Errorf("Expected a fault stepping to 1000, got %v\n", err)
+	}
+	if c8.PC != 0xFFE {
+		t.Errorf("PC left memory: %X\n", c8.PC)
+	}
+}
+
+func TestReturnWithBadStackPointer(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.LoadROM([]byte{0x00, 0xEE})
+	c8.SP = 0x20
+
+	fault := &Fault{}
+	if err := runUntilFault(c8, 1); !errors.As(err, &fault) || fault.Kind != FaultStackOverflow {
+		t.Errorf("Expected a stack fault returning with SP 20, got %v\n", err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, op := range []uint16{0x00E0, 0x01EE, 0x0123, 0x5AB3, 0x8AB6, 0xE09E, 0xF265, 0xFFFF} {
+		f.Add(op)
+	}
+	f.Fuzz(func(t *testing.T, op uint16) {
+		instr := Decode(MakeOpcode(op))
+		if instr == nil {
+			t.Fatalf("%04X decoded to nil\n", op)
+		}
+		// Digits in the pattern must match the opcode; letters are operands.
+		// Decode ignores the second digit of 00E0 and 00EE, and the last
+		// digit of 5XY0 and 9XY0.
+		ignored := -1
+		switch instr {
+		case &InstrClearScreen, &InstrReturn:
+			ignored = 1
+		case &InstrSkipInstrEqualReg, &InstrSkipInstrNotEqualReg:
+			ignored = 3
+		}
+		for i, digit := range instr.Pattern {
+			want, err := strconv.ParseUint(string(digit), 16, 4)
+			nibble := op >> (12 - 4*i) & 0xF
+			if err == nil && i != ignored && uint16(want) != nibble {
+				t.Errorf("%04X decoded to %v (%v)\n", op, instr.Name, instr.Pattern)
+			}
+		}
+	})
+}
+
+// Fuzzes whole programs, holding down keys from a bitmask that changes
+// every frame. Programs may fault, but the emulator itself mustn't panic.
+func FuzzExecute(f *testing.F) {
+	games, _ := filepath.Glob(filepath.Join("..", "c8games", "*"))
+	for _, game := range games {
+		if rom, err := os.ReadFile(game); err == nil {
+			f.Add(rom, []byte{0x10, 0x00, 0x20, 0x40, 0x00, 0x01})
+		}
+	}
+	f.Add([]byte{0xF0, 0x0A, 0xD0, 0x15, 0x12, 0x00}, []byte{0xFF, 0xFF})
+	f.Add([]byte{0xF1, 0x65, 0xFF, 0x1E, 0xF2, 0x33, 0x12, 0x00}, []byte{})
+
+	f.Fuzz(func(t *testing.T, rom []byte, keys []byte) {
+		c8 := MakeChip8(false)
+		c8.Mute = true
+		if c8.LoadROM(rom) != nil {
+			t.Skip()
+		}
+
+		var err error
+		for frame := 0; frame < 20 && err == nil; frame++ {
+			if len(keys) >= 2 {
+				index := frame * 2 % (len(keys) - 1)
+				mask := uint16(keys[index])<<8 | uint16(keys[index+1])
+				for key := range c8.HeldKeys {
+					c8.HeldKeys[key] = mask&(1<<key) != 0
+				}
+			}
+			for cycle := 0; cycle < c8.CyclesPerFrame() && err == nil; cycle++ {
+				err = runUntilFault(c8, 1)
+				if int(c8.SP) > len(c8.Stack) {
+					t.Fatalf("SP is %v after %v cycles\n", c8.SP, c8.Cycle)
+				}
+				if int(c8.PC)+1 >= len(c8.Memory) {
+					t.Fatalf("PC is %X after %v cycles\n", c8.PC, c8.Cycle)
+				}
+			}
+		}
+	})
+}
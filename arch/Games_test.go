@@ -0,0 +1,182 @@
+package arch
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden images in testdata/golden")
+
+// Every game in c8games, with the keys to press while it runs: FRAME+KEY
+// presses a key at the start of a frame, and FRAME-KEY releases it.
+var goldenGames = []struct{ Name, Script string }{
+	{"15PUZZLE", "60+5 70-5 120+6 130-6 180+2 190-2"},
+	{"BLINKY", "30+6 150-6 150+8 250-8"},
+	{"BLITZ", "60+5 70-5 200+5 210-5"},
+	{"BRIX", "30+4 90-4 120+6 200-6"},
+	{"CONNECT4", "60+6 70-6 100+5 110-5 160+4 170-4 200+5 210-5"},
+	{"GUESS", "60+5 70-5 120+5 130-5"},
+	{"HIDDEN", "60+6 70-6 100+5 110-5 140+8 150-8 180+5 190-5"},
+	{"INVADERS", "30+5 40-5 100+4 150-4 160+5 170-5"},
+	{"KALEID", "10+2 60-2 60+4 120-4 120+8 180-8 180+6 240-6"},
+	{"MAZE", ""},
+	{"MERLIN", "200+4 210-4 230+5 240-5"},
+	{"MISSILE", "60+8 70-8 150+8 160-8"},
+	{"PONG", "30+1 90-1 90+D 150-D"},
+	{"PONG2", "30+1 90-1 90+D 150-D"},
+	{"PUZZLE", "60+2 70-2 100+4 110-4"},
+	{"SYZYGY", "60+7 120-7 120+3 180-3"},
+	{"TANK", "30+2 90-2 100+5 110-5"},
+	{"TETRIS", "60+5 90-5 120+4 130-4 200+7 260-7"},
+	{"TICTAC", "60+5 70-5 120+1 130-1"},
+	{"UFO", "60+5 70-5 150+4 160-4"},
+	{"VBRIX", "30+7 40-7 60+1 120-1"},
+	{"VERS", "60+7 80-7 100+1 140-1"},
+	{"WIPEOFF", "30+4 90-4 120+6 200-6"},
+}
+
+// Frames each game runs for, with random numbers from a fixed seed.
+const goldenFrames = 300
+
+func TestGoldenImages(t *testing.T) {
+	for _, game := range goldenGames {
+		game := game
+		t.Run(game.Name, func(t *testing.T) {
+			t.Parallel()
+			c8 := MakeChip8(false)
+			c8.Mute = true
+			c8.Rando = rand.New(rand.NewSource(1))
+			if err := c8.LoadGame(filepath.Join("..", "c8games", game.Name)); err != nil {
+				t.Fatalf("Game could not be loaded: %v\n", err)
+			}
+			if err := playScript(c8, game.Script, goldenFrames); err != nil {
+				t.Fatalf("Bad script: %v\n", err)
+			}
+
+			actual := screenImage(c8)
+			goldenPath := filepath.Join("testdata", "golden", game.Name+".png")
+			if *update {
+				if err := writePNG(goldenPath, actual); err != nil {
+					t.Fatalf("Could not write golden image! Error was: %v\n", err)
+				}
+				return
+			}
+
+			golden, err := readPNG(goldenPath)
+			if err != nil {
+				t.Fatalf("Could not read golden image (run with -update to make it)! Error was: %v\n", err)
+			}
+			diffPath := filepath.Join("testdata", "golden", "failed", game.Name+".png")
+			os.Remove(diffPath) // From an earlier failure.
+			if diff, count := diffImages(golden, actual); count > 0 {
+				writePNG(diffPath, diff)
+				t.Errorf("Screen differs from %v in %v pixels. See %v, where red pixels "+
+					"should have been lit and green pixels should not.\n", goldenPath, count, diffPath)
+			}
+		})
+	}
+}
+
+// Runs a game for a number of frames, pressing keys as the script says.
+func playScript(c8 *Chip8, script string, frames int) error {
+	events := map[int][]string{}
+	for _, event := range strings.Fields(script) {
+		split := strings.IndexAny(event, "+-")
+		frame, err := strconv.Atoi(event[:max(split, 0)])
+		if split < 0 || err != nil || len(event) != split+2 {
+			return fmt.Errorf("%q is not FRAME+KEY or FRAME-KEY", event)
+		}
+		events[frame] = append(events[frame], event[split:])
+	}
+
+	for frame := 0; frame < frames; frame++ {
+		for _, event := range events[frame] {
+			key, err := strconv.ParseUint(event[1:], 16, 4)
+			if err != nil {
+				return fmt.Errorf("%q is not a key", event[1:])
+			}
+			c8.HeldKeys[key] = event[0] == '+'
+		}
+		c8.EmulateFrame()
+	}
+	return nil
+}
+
+func screenImage(c8 *Chip8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, ScreenWidth, ScreenHeight))
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			if c8.Screen.GetPixel(uint16(x), uint16(y)) {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	return img
+}
+
+// Makes an enlarged picture of the differences between two screens, and
+// counts the pixels that differ. Pixels lit in both are white, pixels
+// only lit in want are red, and pixels only lit in got are green.
+func diffImages(want, got image.Image) (*image.RGBA, int) {
+	const scale = 8
+	diff := image.NewRGBA(image.Rect(0, 0, ScreenWidth*scale, ScreenHeight*scale))
+	count := 0
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			wantLit := color.GrayModel.Convert(want.At(x, y)).(color.Gray).Y > 127
+			gotLit := color.GrayModel.Convert(got.At(x, y)).(color.Gray).Y > 127
+			shade := color.RGBA{0, 0, 0, 255}
+			switch {
+			case wantLit && gotLit:
+				shade = color.RGBA{255, 255, 255, 255}
+			case wantLit:
+				shade = color.RGBA{255, 0, 0, 255}
+			case gotLit:
+				shade = color.RGBA{0, 255, 0, 255}
+			}
+			if wantLit != gotLit {
+				count++
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					diff.SetRGBA(x*scale+dx, y*scale+dy, shade)
+				}
+			}
+		}
+	}
+	return diff, count
+}
+
+func readPNG(filePath string) (image.Image, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err == nil && img.Bounds() != image.Rect(0, 0, ScreenWidth, ScreenHeight) {
+		err = fmt.Errorf("image is %v, not %vx%v", img.Bounds().Size(), ScreenWidth, ScreenHeight)
+	}
+	return img, err
+}
+
+func writePNG(filePath string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return png.Encode(file, img)
+}
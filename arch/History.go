@@ -0,0 +1,182 @@
+package arch
+
+import (
+	"fmt"
+)
+
+/**
+ * Datatype to describe the execution history used for time-travel
+ * debugging. The machine's state is checkpointed periodically, and every
+ * key press and random number an instruction asks for is logged, so any
+ * earlier cycle can be reached again by restoring the checkpoint before
+ * it and re-executing deterministically from there.
+ */
+type History struct {
+	Checkpoints []Checkpoint // Oldest first.
+	Interval    uint64       // Cycles between checkpoints.
+	Limit       int          // Maximum number of checkpoints kept.
+	inputs      []uint8      // Every value read from the keypad or PRNG.
+	cursor      int          // Index into inputs of the next value to read.
+	end         uint64       // Cycle number of the newest cycle ever executed, plus 1.
+}
+
+type Checkpoint struct {
+	Cycle uint64
+	State State
+	Input int // Index into the input log at this cycle.
+}
+
+func MakeHistory() *History {
+	h := History{}
+	h.Interval = 1000 // About 10 checkpoints per second.
+	h.Limit = 600     // About a minute of history.
+	return &h
+}
+
+// Oldest returns the earliest cycle that can be reached.
+func (h *History) Oldest() uint64 {
+	if len(h.Checkpoints) == 0 {
+		return 0
+	}
+	return h.Checkpoints[0].Cycle
+}
+
+// Record is called before every cycle, checkpointing when one is due.
+func (h *History) Record(c8 *Chip8) {
+	if c8.Cycle < h.end {
+		return // Replaying, so there's a checkpoint for this already.
+	}
+	h.end = c8.Cycle + 1
+	last := len(h.Checkpoints) - 1
+	if last < 0 || c8.Cycle-h.Checkpoints[last].Cycle >= h.Interval {
+		h.checkpoint(c8)
+	}
+}
+
+func (h *History) checkpoint(c8 *Chip8) {
+	h.Checkpoints = append(h.Checkpoints, Checkpoint{c8.Cycle, c8.SaveState(), h.cursor})
+	if len(h.Checkpoints) <= h.Limit {
+		return
+	}
+
+	// Drop the oldest checkpoint, along with the inputs only it needed.
+	h.Checkpoints = h.Checkpoints[1:]
+	dropped := h.Checkpoints[0].Input
+	h.inputs = h.inputs[dropped:]
+	h.cursor -= dropped
+	for index := range h.Checkpoints {
+		h.Checkpoints[index].Input -= dropped
+	}
+}
+
+// Input returns the logged value when replaying, or otherwise
+// reads a new value from live and logs it.
+func (h *History) Input(live func() uint8) uint8 {
+	if h.cursor == len(h.inputs) {
+		h.inputs = append(h.inputs, live())
+	}
+	h.cursor++
+	return h.inputs[h.cursor-1]
+}
+
+// Diverge is called when the state was changed from outside the program,
+// for example by the debugger or a cheat. Anything recorded after this
+// point no longer applies, and replaying must start from the new state.
+func (h *History) Diverge(c8 *Chip8) {
+	kept := h.Checkpoints[:0]
+	for _, checkpoint := range h.Checkpoints {
+		if checkpoint.Cycle < c8.Cycle {
+			kept = append(kept, checkpoint)
+		}
+	}
+	h.Checkpoints = kept
+	h.inputs = h.inputs[:h.cursor]
+	h.end = c8.Cycle
+	h.checkpoint(c8)
+}
+
+// Reset forgets all history, for when the whole state was replaced.
+func (h *History) Reset() {
+	h.Checkpoints = nil
+	h.inputs = nil
+	h.cursor = 0
+	h.end = 0
+}
+
+// Seek moves the machine to the state it was in before the given cycle.
+func (h *History) Seek(c8 *Chip8, target uint64) error {
+	if target < h.Oldest() || target > h.end {
+		return fmt.Errorf("cycle %v is not in history (cycles %v to %v)",
+			target, h.Oldest(), h.end)
+	}
+	index := h.find(target)
+	if c8.Cycle > target || c8.Cycle < h.Checkpoints[index].Cycle {
+		h.restore(c8, index)
+	}
+	h.replay(c8, target, nil)
+	c8.DrawFlag = true
+	c8.DrawScreen()
+	return nil
+}
+
+// SeekBack moves the machine to the most recent earlier cycle before
+// which stop returns true. Stops may depend on what the previous cycle
+// did, like a watchpoint hit. If there is no such cycle, it moves to the
+// oldest cycle in history and returns false.
+func (h *History) SeekBack(c8 *Chip8, stop func(c8 *Chip8) bool) (bool, error) {
+	if len(h.Checkpoints) == 0 {
+		return false, fmt.Errorf("no history recorded yet")
+	}
+	start, end := c8.Cycle, c8.Cycle
+	for index := h.find(end); index >= 0; index-- {
+		if h.Checkpoints[index].Cycle >= end {
+			continue
+		}
+		h.restore(c8, index)
+		found, hit := uint64(0), false
+		check := func(c8 *Chip8) {
+			if stop(c8) {
+				found, hit = c8.Cycle, true
+			}
+		}
+		h.replay(c8, end, check)
+		if end < start {
+			check(c8) // The next segment, checked already, started just after this.
+		}
+		if hit {
+			return true, h.Seek(c8, found)
+		}
+		end = h.Checkpoints[index].Cycle
+	}
+	return false, h.Seek(c8, h.Oldest())
+}
+
+// Finds the index of the last checkpoint at or before a cycle.
+func (h *History) find(cycle uint64) int {
+	index := len(h.Checkpoints) - 1
+	for index > 0 && h.Checkpoints[index].Cycle > cycle {
+		index--
+	}
+	return index
+}
+
+func (h *History) restore(c8 *Chip8, index int) {
+	checkpoint := h.Checkpoints[index]
+	c8.LoadState(checkpoint.State)
+	c8.Cycle = checkpoint.Cycle
+	h.cursor = checkpoint.Input
+}
+
+// Re-executes cycles up to target, calling visit before each one.
+// Profiling and coverage are left off, since the cycles already counted.
+func (h *History) replay(c8 *Chip8, target uint64, visit func(c8 *Chip8)) {
+	profiler, coverage := c8.Profiler, c8.Coverage
+	c8.Profiler, c8.Coverage = nil, nil
+	for c8.Cycle < target {
+		if visit != nil {
+			visit(c8)
+		}
+		c8.ExecuteCycle()
+	}
+	c8.Profiler, c8.Coverage = profiler, coverage
+}
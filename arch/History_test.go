@@ -0,0 +1,76 @@
+package arch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHistorySeek(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.History = MakeHistory()
+	c8.History.Interval = 7 // Make replays start between checkpoints.
+	loadProgram(c8, []uint16{
+		0xC10F, // 200: Set V1 to a random key.
+		0x8214, // 202: Add V1 to V2.
+		0xE19E, // 204: Skip if the key in V1 is pressed.
+		0x1200, // 206: Loop.
+		0x1200, // 208: Loop.
+	})
+
+	states := []State{}
+	for cycle := 0; cycle < 50; cycle++ {
+		states = append(states, c8.SaveState())
+		c8.EmulateCycle()
+	}
+	states = append(states, c8.SaveState())
+
+	for _, target := range []uint64{49, 3, 21, 50, 0} {
+		if err := c8.History.Seek(c8, target); err != nil {
+			t.Fatalf("Could not seek to cycle %v! Error was: %v\n", target, err)
+		}
+		if c8.Cycle != target || c8.SaveState() != states[target] {
+			t.Errorf("State after seeking to cycle %v did not match the original!\n", target)
+		}
+	}
+	if err := c8.History.Seek(c8, 51); err == nil {
+		t.Errorf("Seeking past the newest cycle should fail!\n")
+	}
+}
+
+func TestReverseDebugging(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.History = MakeHistory()
+	c8.History.Interval = 5
+	out := bytes.Buffer{}
+	d := MakeDebugger(strings.NewReader(""), &out)
+	loadProgram(c8, []uint16{
+		0x7001, // 200: Add 1 to V0.
+		0x7101, // 202: Add 1 to V1.
+		0x1200, // 204: Loop.
+	})
+	for cycle := 0; cycle < 30; cycle++ {
+		c8.EmulateCycle()
+	}
+
+	d.Exec(c8, "reverse-step 4")
+	if c8.Cycle != 26 || c8.PC != 0x204 || c8.Registers[0] != 9 {
+		t.Errorf("Reverse step ended at cycle %v, PC %03X, V0 %v!\n", c8.Cycle, c8.PC, c8.Registers[0])
+	}
+
+	d.Exec(c8, "break 202")
+	d.Exec(c8, "reverse-continue")
+	if c8.Cycle != 25 || c8.PC != 0x202 || c8.Registers[1] != 8 {
+		t.Errorf("Reverse continue ended at cycle %v, PC %03X, V1 %v!\n", c8.Cycle, c8.PC, c8.Registers[1])
+	}
+
+	// Changing state discards the old future.
+	d.Exec(c8, "set V1 100")
+	for cycle := 0; cycle < 3; cycle++ {
+		c8.EmulateCycle()
+	}
+	d.Exec(c8, "rs 2")
+	if c8.Registers[1] != 101 {
+		t.Errorf("V1 was %v after changing history, expected 101!\n", c8.Registers[1])
+	}
+}
@@ -0,0 +1,117 @@
+package arch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Datatype to describe a single piece of Chip8 machine state that tools
+ * such as cheats and the debugger can read and write: a byte of memory,
+ * a data register, the index register, or one of the timers.
+ */
+type Location struct {
+	Kind LocationKind
+	Addr uint16 // Memory address, or data register number.
+}
+
+type LocationKind int
+
+const (
+	LocMemory LocationKind = iota
+	LocRegister
+	LocIndex
+	LocDelayTimer
+	LocSoundTimer
+)
+
+// ParseLocation parses "V0" through "VF", "I", "DT", "ST",
+// or a memory address in hex (with or without a leading "0x").
+func ParseLocation(s string) (Location, error) {
+	upper := strings.ToUpper(s)
+	switch upper {
+	case "I":
+		return Location{Kind: LocIndex}, nil
+	case "DT":
+		return Location{Kind: LocDelayTimer}, nil
+	case "ST":
+		return Location{Kind: LocSoundTimer}, nil
+	}
+	if len(upper) == 2 && upper[0] == 'V' {
+		reg, err := strconv.ParseUint(upper[1:], 16, 8)
+		if err == nil {
+			return Location{LocRegister, uint16(reg)}, nil
+		}
+	}
+
+	addr, err := ParseAddress(s)
+	if err != nil {
+		return Location{}, fmt.Errorf("%q is not a register or memory address", s)
+	}
+	return Location{LocMemory, addr}, nil
+}
+
+// ParseAddress parses a memory address in hex, with or without a leading "0x".
+func ParseAddress(s string) (uint16, error) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 16)
+	if err != nil || addr >= uint64(len(Chip8{}.Memory)) {
+		return 0, fmt.Errorf("%q is not a memory address", s)
+	}
+	return uint16(addr), nil
+}
+
+// ParseValue parses a decimal value, or a hex value with a leading "0x".
+func ParseValue(s string) (uint16, error) {
+	value, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a value", s)
+	}
+	return uint16(value), nil
+}
+
+func (loc Location) String() string {
+	switch loc.Kind {
+	case LocRegister:
+		return fmt.Sprintf("V%X", loc.Addr)
+	case LocIndex:
+		return "I"
+	case LocDelayTimer:
+		return "DT"
+	case LocSoundTimer:
+		return "ST"
+	default:
+		return fmt.Sprintf("%03X", loc.Addr)
+	}
+}
+
+func (c8 *Chip8) Get(loc Location) uint16 {
+	switch loc.Kind {
+	case LocRegister:
+		return uint16(c8.Registers[loc.Addr])
+	case LocIndex:
+		return c8.IndexReg
+	case LocDelayTimer:
+		return uint16(c8.DelayTimer)
+	case LocSoundTimer:
+		return uint16(c8.SoundTimer)
+	default:
+		return uint16(c8.Memory[loc.Addr])
+	}
+}
+
+// Set stores value at loc, truncating it to a byte unless loc is I.
+func (c8 *Chip8) Set(loc Location, value uint16) {
+	switch loc.Kind {
+	case LocRegister:
+		c8.Registers[loc.Addr] = uint8(value)
+	case LocIndex:
+		c8.IndexReg = value
+	case LocDelayTimer:
+		c8.DelayTimer = uint8(value)
+	case LocSoundTimer:
+		c8.SoundTimer = uint8(value)
+	default:
+		c8.Memory[loc.Addr] = uint8(value)
+	}
+}
@@ -0,0 +1,294 @@
+package arch
+
+import (
+	"fmt"
+	"io/fs"
+	"jugonz/chip8/gfx"
+	"jugonz/chip8/roms"
+	"path"
+	"strings"
+)
+
+/**
+ * Datatype to describe a menu of games, drawn on the Chip8 screen in place
+ * of the game, for switching games without restarting. The menu is driven
+ * from the keypad: 2 and 8 move up and down, and 5 plays the chosen game.
+ */
+type Menu struct {
+	ROMs     fs.FS    // Directory the games are read from.
+	Names    []string // File names of the games in ROMs.
+	Selected int      // Index in Names of the chosen game.
+	Open     bool     // True if the menu is showing instead of the game.
+	Playing  string   // Name of the game last played from the menu, if any.
+
+	// Called after a game is played from the menu, if non-nil,
+	// for setting up anything else that depends on the game.
+	Launched func(name string, rom []byte)
+
+	keysHeld [16]bool // Keys held last frame, so that holding a key counts once.
+	frames   int      // Frames since the selection changed, for scrolling text.
+	saved    *State   // The game that was running when the menu opened.
+}
+
+// Keypad keys used in the menu.
+const (
+	menuKeyUp     = 0x2
+	menuKeyDown   = 0x8
+	menuKeySelect = 0x5
+)
+
+// Layout of the menu: lines of text are a glyph plus a blank row high,
+// and glyphs are 4 pixels wide with a blank column after.
+const (
+	menuLineHeight = 6
+	menuCharWidth  = 5
+	menuNames      = 3  // Lines of game names, above a description and controls.
+	menuScrollWait = 60 // Frames before long lines start scrolling.
+	menuScrollGap  = 16 // Pixels between the end of a scrolling line and its next start.
+)
+
+func MakeMenu(romDir fs.FS) (*Menu, error) {
+	names, err := roms.List(romDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Menu{ROMs: romDir, Names: names}, nil
+}
+
+// OpenMenu shows the menu, keeping the running game to go back to.
+func (c8 *Chip8) OpenMenu() {
+	m := c8.Menu
+	if m.Open {
+		return
+	}
+	if c8.RomSize > 0 {
+		saved := c8.SaveState()
+		m.saved = &saved
+	}
+	m.Open = true
+	m.frames = 0
+	m.keysHeld = c8.menuKeys() // Keys already held don't count as presses.
+	for index, name := range m.Names {
+		if name == m.Playing {
+			m.Selected = index
+		}
+	}
+	c8.DrawFlag = true
+}
+
+// CloseMenu goes back to the game that was running when the menu opened.
+// With no game to go back to, the menu stays open.
+func (c8 *Chip8) CloseMenu() {
+	m := c8.Menu
+	if !m.Open || m.saved == nil {
+		return
+	}
+	c8.LoadState(*m.saved)
+	m.saved = nil
+	m.Open = false
+}
+
+// PlayGame resets the machine and starts a game from the menu's directory.
+// Nothing carries over from the old game, including its cheats, profile,
+// coverage and any pause or fast-forward, and the menu closes.
+func (c8 *Chip8) PlayGame(name string) error {
+	m := c8.Menu
+	rom, err := fs.ReadFile(m.ROMs, name)
+	if err != nil {
+		return err
+	}
+	if rom, err = PatchGame(name, rom); err != nil {
+		return err
+	}
+
+	c8.Reset()
+	c8.LoadROM(rom)
+	c8.Paused = false
+	c8.FastForwarding = false
+	c8.frameCredit = 0
+	c8.HeldKeys = [16]bool{}
+	m.Playing = name
+	m.Open = false
+	m.saved = nil
+	if m.Launched != nil {
+		m.Launched(name, rom)
+	}
+	return nil
+}
+
+// Opens or closes the menu when its hotkey is pressed.
+func (c8 *Chip8) handleMenuHotkey() {
+	if !c8.Controller.HotkeyPressed(gfx.HotkeyMenu) || c8.Menu == nil {
+		return
+	}
+	if c8.Menu.Open {
+		c8.CloseMenu()
+	} else {
+		c8.OpenMenu()
+	}
+}
+
+// Runs the menu for a frame: moves the selection or plays the chosen
+// game on new key presses, and draws the menu.
+func (c8 *Chip8) menuFrame() {
+	m := c8.Menu
+	keys, held := c8.menuKeys(), m.keysHeld
+	pressed := func(key int) bool {
+		return keys[key] && !held[key]
+	}
+	m.keysHeld = keys
+	m.frames++
+
+	if len(m.Names) > 0 {
+		switch {
+		case pressed(menuKeyUp):
+			m.Selected = (m.Selected + len(m.Names) - 1) % len(m.Names)
+			m.frames = 0
+		case pressed(menuKeyDown):
+			m.Selected = (m.Selected + 1) % len(m.Names)
+			m.frames = 0
+		case pressed(menuKeySelect):
+			if err := c8.PlayGame(m.Names[m.Selected]); err != nil {
+				fmt.Printf("Error: %v could not be played! Error was: %v\n", m.Names[m.Selected], err)
+			} else {
+				c8.DrawScreen()
+				return
+			}
+		}
+	}
+	c8.drawMenu()
+	c8.DrawScreen()
+}
+
+// Keys held on the keypad, or by remote control.
+func (c8 *Chip8) menuKeys() [16]bool {
+	keys := c8.HeldKeys
+	for key := range keys {
+		keys[key] = keys[key] || c8.Controller.KeyPressed(uint8(key))
+	}
+	return keys
+}
+
+// Draws the list of games, with the chosen one lit up, then its
+// description and controls from the ROM database.
+func (c8 *Chip8) drawMenu() {
+	m := c8.Menu
+	c8.Screen.ClearScreen()
+	c8.DrawFlag = true
+	if len(m.Names) == 0 {
+		c8.drawText("NO ROMS", 0, 1)
+		return
+	}
+
+	// Keep the chosen game in the middle line, except at the ends.
+	first := max(min(m.Selected-menuNames/2, len(m.Names)-menuNames), 0)
+	for line := 0; line < menuNames && first+line < len(m.Names); line++ {
+		name := m.Names[first+line]
+		name = strings.ToUpper(strings.TrimSuffix(name, path.Ext(name)))
+		if first+line == m.Selected {
+			c8.fillRows(line*menuLineHeight, menuLineHeight+1) // A blank row above and below.
+		}
+		c8.drawText(name, 1, line*menuLineHeight+1)
+	}
+
+	info, ok := roms.Lookup(m.Names[m.Selected])
+	description, keys := "No description.", ""
+	if ok {
+		description = info.Title + ": " + info.Description
+		keys = "Keys: " + info.Keys
+	}
+	c8.drawScrollingText(description, menuNames*menuLineHeight+1)
+	c8.drawScrollingText(keys, (menuNames+1)*menuLineHeight+1)
+}
+
+// Draws a line of text, scrolling it sideways if it's too wide to fit.
+func (c8 *Chip8) drawScrollingText(text string, y int) {
+	width := len(text) * menuCharWidth
+	if width <= ScreenWidth {
+		c8.drawText(text, 0, y)
+		return
+	}
+	scroll := max(c8.Menu.frames-menuScrollWait, 0) / 2 % (width + menuScrollGap)
+	c8.drawText(text, -scroll, y)
+	c8.drawText(text, width+menuScrollGap-scroll, y)
+}
+
+// Draws text with the font, with its top left at (x, y). Pixels are XORed,
+// so text on a lit background is dark, and text off the screen is cut off.
+func (c8 *Chip8) drawText(text string, x, y int) {
+	for _, char := range strings.ToUpper(text) {
+		glyph := c8.glyph(char)
+		for row, bits := range glyph {
+			for col := 0; col < 4; col++ {
+				px, py := x+col, y+row
+				if bits&(0x80>>col) != 0 && px >= 0 && py >= 0 &&
+					c8.Screen.InBounds(uint16(px), uint16(py)) {
+					c8.Screen.XorPixel(uint16(px), uint16(py))
+				}
+			}
+		}
+		x += menuCharWidth
+	}
+}
+
+// Lights up every pixel in some rows of the screen.
+func (c8 *Chip8) fillRows(y, rows int) {
+	for py := y; py < y+rows; py++ {
+		for px := 0; px < ScreenWidth; px++ {
+			if !c8.Screen.GetPixel(uint16(px), uint16(py)) {
+				c8.Screen.XorPixel(uint16(px), uint16(py))
+			}
+		}
+	}
+}
+
+// Finds the rows of a character's glyph. Hex digits come from the Chip8's
+// own font, and other characters from menuFont in the same style.
+// Characters with no glyph are blank.
+func (c8 *Chip8) glyph(char rune) []uint8 {
+	switch {
+	case char >= '0' && char <= '9':
+		return c8.Fontset[(char-'0')*5:][:5]
+	case char >= 'A' && char <= 'F':
+		return c8.Fontset[(char-'A'+10)*5:][:5]
+	}
+	glyph := menuFont[char]
+	return glyph[:]
+}
+
+// Glyphs for the rest of the alphabet and some punctuation, five rows of
+// four pixels each, in the high bits of each byte.
+var menuFont = map[rune][5]uint8{
+	'G':  {0xF0, 0x80, 0xB0, 0x90, 0xF0},
+	'H':  {0x90, 0x90, 0xF0, 0x90, 0x90},
+	'I':  {0xE0, 0x40, 0x40, 0x40, 0xE0},
+	'J':  {0x30, 0x10, 0x10, 0x90, 0x60},
+	'K':  {0x90, 0xA0, 0xC0, 0xA0, 0x90},
+	'L':  {0x80, 0x80, 0x80, 0x80, 0xF0},
+	'M':  {0x90, 0xF0, 0xF0, 0x90, 0x90},
+	'N':  {0x90, 0xD0, 0xB0, 0x90, 0x90},
+	'O':  {0x60, 0x90, 0x90, 0x90, 0x60},
+	'P':  {0xE0, 0x90, 0xE0, 0x80, 0x80},
+	'Q':  {0x60, 0x90, 0x90, 0xB0, 0x70},
+	'R':  {0xE0, 0x90, 0xE0, 0xA0, 0x90},
+	'S':  {0x70, 0x80, 0x60, 0x10, 0xE0},
+	'T':  {0xE0, 0x40, 0x40, 0x40, 0x40},
+	'U':  {0x90, 0x90, 0x90, 0x90, 0xF0},
+	'V':  {0x90, 0x90, 0x90, 0xA0, 0x40},
+	'W':  {0x90, 0x90, 0xF0, 0xF0, 0x90},
+	'X':  {0x90, 0x90, 0x60, 0x90, 0x90},
+	'Y':  {0xA0, 0xA0, 0x40, 0x40, 0x40},
+	'Z':  {0xF0, 0x10, 0x60, 0x80, 0xF0},
+	'-':  {0x00, 0x00, 0xE0, 0x00, 0x00},
+	'+':  {0x00, 0x40, 0xE0, 0x40, 0x00},
+	'=':  {0x00, 0xE0, 0x00, 0xE0, 0x00},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x40},
+	',':  {0x00, 0x00, 0x00, 0x40, 0x80},
+	':':  {0x00, 0x40, 0x00, 0x40, 0x00},
+	'\'': {0x40, 0x40, 0x00, 0x00, 0x00},
+	'!':  {0x40, 0x40, 0x40, 0x00, 0x40},
+	'?':  {0xE0, 0x10, 0x60, 0x00, 0x40},
+	'/':  {0x10, 0x10, 0x20, 0x40, 0x80},
+	'(':  {0x20, 0x40, 0x40, 0x40, 0x20},
+	')':  {0x40, 0x20, 0x20, 0x20, 0x40},
+}
@@ -0,0 +1,137 @@
+package arch
+
+import (
+	"errors"
+	"jugonz/chip8/gfx"
+	"testing"
+	"testing/fstest"
+)
+
+func makeMenuChip8(t *testing.T, fsys fstest.MapFS) (*Chip8, *gfx.Headless) {
+	c8 := MakeChip8(false)
+	menu, err := MakeMenu(fsys)
+	if err != nil {
+		t.Fatalf("Could not make menu: %v\n", err)
+	}
+	c8.Menu = menu
+	return c8, c8.Screen.(*gfx.Headless)
+}
+
+// Holds a key for a frame of the menu, then lets go for a frame
+// if the menu is still open.
+func pressMenuKey(c8 *Chip8, screen *gfx.Headless, key uint8) {
+	screen.Keyboard[key] = true
+	c8.menuFrame()
+	screen.Keyboard[key] = false
+	if c8.Menu.Open {
+		c8.menuFrame()
+	}
+}
+
+func TestMenuPlaysGames(t *testing.T) {
+	c8, screen := makeMenuChip8(t, fstest.MapFS{
+		"BRIX":        {Data: []byte{0x12, 0x00}},
+		"PONG":        {Data: []byte{0x60, 0x05, 0x12, 0x02}},
+		"PONG.cheats": {Data: []byte("Lives: V3=3\n")},
+	})
+	launched := ""
+	c8.Menu.Launched = func(name string, rom []byte) { launched = name }
+	c8.Paused = true
+	c8.Registers[3] = 7
+	c8.Cheats = nil
+	c8.Profiler = MakeProfiler()
+	c8.Coverage = MakeCoverage()
+	c8.Coverage.Mark(0x200, CoverExecuted)
+	oldProfiler := c8.Profiler
+
+	c8.OpenMenu()
+	c8.menuFrame()
+	if !c8.Menu.Open || c8.Status() != "Menu" || screen.Frames == 0 {
+		t.Fatalf("Menu wasn't shown\n")
+	}
+	pressMenuKey(c8, screen, menuKeyDown)
+	pressMenuKey(c8, screen, menuKeyDown) // Wraps around.
+	pressMenuKey(c8, screen, menuKeyUp)
+	if c8.Menu.Selected != 1 {
+		t.Fatalf("Expected PONG to be chosen, got %v\n", c8.Menu.Names[c8.Menu.Selected])
+	}
+
+	pressMenuKey(c8, screen, menuKeySelect)
+	if c8.Menu.Open || c8.Menu.Playing != "PONG" || launched != "PONG" {
+		t.Fatalf("PONG wasn't played: open %v, playing %q\n", c8.Menu.Open, c8.Menu.Playing)
+	}
+	if c8.PC != 0x200 || c8.Registers[3] != 0 || c8.Paused || c8.Memory[0x201] != 0x05 || c8.RomSize != 4 {
+		t.Errorf("Machine wasn't reset for the new game\n")
+	}
+	if c8.Cheats == nil || c8.Profiler == oldProfiler || c8.Coverage.IsCode(0x200) {
+		t.Errorf("Cheats, profile or coverage weren't reset for the new game\n")
+	}
+	for x := 0; x < ScreenWidth; x++ {
+		for y := 0; y < ScreenHeight; y++ {
+			if screen.GetPixel(uint16(x), uint16(y)) {
+				t.Fatalf("Menu was left on screen at %v, %v\n", x, y)
+			}
+		}
+	}
+}
+
+func TestMenuKeepsGameWhenNewOneIsTooBig(t *testing.T) {
+	c8, _ := makeMenuChip8(t, fstest.MapFS{
+		"BRIX": {Data: []byte{0x12, 0x00}},
+		"HUGE": {Data: make([]byte, MaxROMSize+1)},
+	})
+	c8.Registers[3] = 7
+
+	loadErr := &LoadError{}
+	if err := c8.PlayGame("HUGE"); !errors.As(err, &loadErr) || loadErr.Path != "HUGE" {
+		t.Errorf("Playing a game that doesn't fit gave %v\n", err)
+	}
+	if c8.Registers[3] != 7 {
+		t.Errorf("Machine was reset for a game that doesn't fit\n")
+	}
+}
+
+func TestMenuGoesBackToGame(t *testing.T) {
+	c8, screen := makeMenuChip8(t, fstest.MapFS{"BRIX": {Data: []byte{0x12, 0x00}}})
+	c8.LoadROM([]byte{0x00, 0xE0, 0x12, 0x02})
+	c8.Registers[3] = 7
+	screen.XorPixel(10, 10)
+	before := c8.SaveState()
+
+	c8.OpenMenu()
+	c8.menuFrame()
+	if c8.SaveState() == before {
+		t.Fatalf("Menu wasn't drawn\n")
+	}
+	c8.CloseMenu()
+	if c8.Menu.Open || c8.SaveState() != before {
+		t.Errorf("Game wasn't restored after closing the menu\n")
+	}
+}
+
+func TestMenuStaysOpenWithoutGame(t *testing.T) {
+	c8, _ := makeMenuChip8(t, fstest.MapFS{})
+	c8.OpenMenu()
+	c8.menuFrame()
+	c8.CloseMenu()
+	if !c8.Menu.Open {
+		t.Errorf("Menu closed with no game to go back to\n")
+	}
+}
+
+func TestMenuFont(t *testing.T) {
+	c8 := MakeChip8(false)
+	seen := map[[5]uint8]rune{}
+	for _, char := range "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ" {
+		glyph := [5]uint8(c8.glyph(char))
+		if other, ok := seen[glyph]; ok {
+			t.Errorf("%c looks the same as %c\n", char, other)
+		}
+		seen[glyph] = char
+		for _, row := range glyph {
+			if row&0x0F != 0 {
+				t.Errorf("%c is wider than 4 pixels\n", char)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package arch
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+/**
+ * This file writes a Profiler out in the pprof profile.proto format, so that
+ * `go tool pprof` can be used to view it. Each Chip8 subroutine appears as a
+ * function, and each instruction address as a location (and line) within it.
+ * The format is simple enough that we encode the protobuf by hand.
+ */
+
+// Field numbers from github.com/google/pprof/proto/profile.proto.
+const (
+	pprofProfileSampleType   = 1
+	pprofProfileSample       = 2
+	pprofProfileLocation     = 4
+	pprofProfileFunction     = 5
+	pprofProfileStringTable  = 6
+	pprofProfilePeriodType   = 11
+	pprofProfilePeriod       = 12
+	pprofValueTypeType       = 1
+	pprofValueTypeUnit       = 2
+	pprofSampleLocationID    = 1
+	pprofSampleValue         = 2
+	pprofLocationID          = 1
+	pprofLocationAddress     = 3
+	pprofLocationLine        = 4
+	pprofLineFunctionID      = 1
+	pprofLineLine            = 2
+	pprofFunctionID          = 1
+	pprofFunctionName        = 2
+	pprofFunctionSystemName  = 3
+	pprofFunctionFilename    = 4
+	pprofFunctionStartLine   = 5
+	protoWireVarint          = 0
+	protoWireLengthDelimited = 2
+)
+
+// WritePprof writes the profile as a gzipped pprof protobuf. Samples are
+// measured in cycles, and romName is reported as the source file name.
+func (p *Profiler) WritePprof(w io.Writer, romName string) error {
+	enc := pprofEncoder{strings: map[string]int64{"": 0}, stringTable: []string{""}}
+
+	cycles, count := enc.str("cycles"), enc.str("count")
+	enc.buf.putMessage(pprofProfileSampleType, func(b *protoBuffer) {
+		b.putInt(pprofValueTypeType, cycles)
+		b.putInt(pprofValueTypeUnit, count)
+	})
+	enc.buf.putMessage(pprofProfilePeriodType, func(b *protoBuffer) {
+		b.putInt(pprofValueTypeType, cycles)
+		b.putInt(pprofValueTypeUnit, count)
+	})
+	enc.buf.putInt(pprofProfilePeriod, 1)
+
+	functions := map[uint16]uint64{} // Subroutine address to function ID.
+	locations := map[uint32]uint64{} // Function and address to location ID.
+	var funcBuf, locBuf protoBuffer
+
+	function := func(target uint16) uint64 {
+		if id, ok := functions[target]; ok {
+			return id
+		}
+		id := uint64(len(functions) + 1)
+		functions[target] = id
+		name := fmt.Sprintf("sub_%03X", target)
+		if target == profileEntryPoint {
+			name = "main"
+		}
+		funcBuf.putMessage(pprofProfileFunction, func(b *protoBuffer) {
+			b.putUint(pprofFunctionID, id)
+			b.putInt(pprofFunctionName, enc.str(name))
+			b.putInt(pprofFunctionSystemName, enc.str(name))
+			b.putInt(pprofFunctionFilename, enc.str(romName))
+			b.putInt(pprofFunctionStartLine, int64(target))
+		})
+		return id
+	}
+	location := func(target, addr uint16) uint64 {
+		key := uint32(target)<<16 | uint32(addr)
+		if id, ok := locations[key]; ok {
+			return id
+		}
+		funcID := function(target)
+		id := uint64(len(locations) + 1)
+		locations[key] = id
+		locBuf.putMessage(pprofProfileLocation, func(b *protoBuffer) {
+			b.putUint(pprofLocationID, id)
+			b.putUint(pprofLocationAddress, uint64(addr))
+			b.putMessage(pprofLocationLine, func(line *protoBuffer) {
+				line.putUint(pprofLineFunctionID, funcID)
+				line.putInt(pprofLineLine, int64(addr)) // Lines are addresses.
+			})
+		})
+		return id
+	}
+
+	for _, key := range p.order {
+		ids := make([]uint64, key.Depth)
+		for i := range ids {
+			ids[i] = location(key.Targets[i], key.Sites[i])
+		}
+		value := p.samples[key]
+		enc.buf.putMessage(pprofProfileSample, func(b *protoBuffer) {
+			b.putPacked(pprofSampleLocationID, ids)
+			b.putPacked(pprofSampleValue, []uint64{value})
+		})
+	}
+	enc.buf.bytes = append(enc.buf.bytes, locBuf.bytes...)
+	enc.buf.bytes = append(enc.buf.bytes, funcBuf.bytes...)
+	for _, s := range enc.stringTable {
+		enc.buf.putString(pprofProfileStringTable, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(enc.buf.bytes); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+type pprofEncoder struct {
+	buf         protoBuffer
+	strings     map[string]int64
+	stringTable []string
+}
+
+// Returns the string table index for s, adding it if needed.
+func (enc *pprofEncoder) str(s string) int64 {
+	if index, ok := enc.strings[s]; ok {
+		return index
+	}
+	index := int64(len(enc.stringTable))
+	enc.strings[s] = index
+	enc.stringTable = append(enc.stringTable, s)
+	return index
+}
+
+/**
+ * Minimal protobuf wire format encoder.
+ */
+type protoBuffer struct {
+	bytes []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.bytes = append(b.bytes, byte(x)|0x80)
+		x >>= 7
+	}
+	b.bytes = append(b.bytes, byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) putUint(field int, x uint64) {
+	if x == 0 {
+		return // Zero is the default value and is omitted.
+	}
+	b.key(field, protoWireVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) putInt(field int, x int64) {
+	b.putUint(field, uint64(x))
+}
+
+func (b *protoBuffer) putString(field int, s string) {
+	b.key(field, protoWireLengthDelimited)
+	b.varint(uint64(len(s)))
+	b.bytes = append(b.bytes, s...)
+}
+
+// Appends an embedded message built by fill.
+func (b *protoBuffer) putMessage(field int, fill func(*protoBuffer)) {
+	inner := protoBuffer{}
+	fill(&inner)
+	b.key(field, protoWireLengthDelimited)
+	b.varint(uint64(len(inner.bytes)))
+	b.bytes = append(b.bytes, inner.bytes...)
+}
+
+func (b *protoBuffer) putPacked(field int, xs []uint64) {
+	inner := protoBuffer{}
+	for _, x := range xs {
+		inner.varint(x)
+	}
+	b.key(field, protoWireLengthDelimited)
+	b.varint(uint64(len(inner.bytes)))
+	b.bytes = append(b.bytes, inner.bytes...)
+}
@@ -0,0 +1,200 @@
+package arch
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+/**
+ * Datatype to describe an execution profile of a running Chip8 ROM.
+ * Every cycle is attributed to the instruction's address, its opcode
+ * class, and every subroutine (CALL target) that is active at the time.
+ */
+type Profiler struct {
+	Cycles      uint64
+	PCCounts    [4096]uint64      // Executions per instruction address.
+	PCOpcodes   [4096]uint16      // Last opcode seen at each address.
+	ClassCounts map[string]uint64 // Executions per opcode pattern, e.g. "DXYN".
+	Subroutines map[uint16]*SubroutineStats
+
+	frames  []profileFrame      // Shadow of the Chip8 call stack.
+	samples map[stackKey]uint64 // Cycles per unique call stack, for pprof.
+	order   []stackKey          // Sample keys in first-seen order.
+}
+
+/**
+ * Datatype to describe the time spent inside a single subroutine.
+ */
+type SubroutineStats struct {
+	Target     uint16
+	Calls      uint64
+	Cycles     uint64 // Cycles spent in the subroutine and its callees.
+	SelfCycles uint64 // Cycles spent in the subroutine alone.
+}
+
+type profileFrame struct {
+	Target uint16 // Address of the subroutine.
+	Site   uint16 // Address of the CALL that entered it.
+}
+
+// A call stack, leaf first. Sites[0] is the executing PC, and
+// Sites[i] lies inside the subroutine starting at Targets[i].
+// There is room for every stack entry plus the entry point.
+type stackKey struct {
+	Depth   uint8
+	Sites   [17]uint16
+	Targets [17]uint16
+}
+
+// Subroutine address used for code that runs outside of any CALL.
+const profileEntryPoint = 0x200
+
+func MakeProfiler() *Profiler {
+	p := Profiler{}
+	p.ClassCounts = make(map[string]uint64)
+	p.Subroutines = make(map[uint16]*SubroutineStats)
+	p.samples = make(map[stackKey]uint64)
+	return &p
+}
+
+// Record attributes one cycle to the instruction that was just fetched.
+// It must be called after FetchOpcode and before DecodeExecute.
+func (p *Profiler) Record(c8 *Chip8) {
+	pc := c8.PC & 0xFFF
+	instr := Decode(c8.Opcode)
+
+	p.Cycles++
+	p.PCCounts[pc]++
+	p.PCOpcodes[pc] = c8.Opcode.Value
+	p.ClassCounts[instr.Pattern]++
+
+	// Charge the cycle to every active subroutine once, even if recursive.
+	for i, frame := range p.frames {
+		if !p.activeAbove(i, frame.Target) {
+			p.Subroutines[frame.Target].Cycles++
+		}
+	}
+	if len(p.frames) > 0 {
+		p.Subroutines[p.frames[len(p.frames)-1].Target].SelfCycles++
+	}
+
+	key := p.stack(pc)
+	if _, ok := p.samples[key]; !ok {
+		p.order = append(p.order, key)
+	}
+	p.samples[key]++
+
+	// Now follow the control flow of the instruction.
+	switch instr {
+	case &InstrCall:
+		target := c8.Opcode.Literal
+		stats, ok := p.Subroutines[target]
+		if !ok {
+			stats = &SubroutineStats{Target: target}
+			p.Subroutines[target] = stats
+		}
+		stats.Calls++
+		if len(p.frames) < len(c8.Stack) {
+			p.frames = append(p.frames, profileFrame{target, pc})
+		}
+	case &InstrReturn:
+		if len(p.frames) > 0 {
+			p.frames = p.frames[:len(p.frames)-1]
+		}
+	}
+}
+
+// Returns true if target is also active deeper in the stack than index.
+func (p *Profiler) activeAbove(index int, target uint16) bool {
+	for _, frame := range p.frames[index+1:] {
+		if frame.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Profiler) stack(pc uint16) stackKey {
+	key := stackKey{}
+	key.Sites[0] = pc
+	for i := len(p.frames) - 1; i >= 0; i-- {
+		key.Targets[key.Depth] = p.frames[i].Target
+		key.Depth++
+		key.Sites[key.Depth] = p.frames[i].Site
+	}
+	key.Targets[key.Depth] = profileEntryPoint
+	key.Depth++
+	return key
+}
+
+// Report prints the top hot spots by address, all opcode classes,
+// and all subroutines, each sorted by the number of cycles spent.
+func (p *Profiler) Report(w io.Writer, top int) {
+	if p.Cycles == 0 {
+		fmt.Fprintf(w, "Profile: no cycles executed.\n")
+		return
+	}
+	percent := func(count uint64) float64 {
+		return 100 * float64(count) / float64(p.Cycles)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Profile: %v cycles\n\nHot spots:\n", p.Cycles)
+	addrs := []uint16{}
+	for addr, count := range p.PCCounts {
+		if count > 0 {
+			addrs = append(addrs, uint16(addr))
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return p.PCCounts[addrs[i]] > p.PCCounts[addrs[j]]
+	})
+	if top > 0 && len(addrs) > top {
+		addrs = addrs[:top]
+	}
+	fmt.Fprintf(tw, "Address\tOpcode\tInstruction\tCount\tPercent\t\n")
+	for _, addr := range addrs {
+		op := MakeOpcode(p.PCOpcodes[addr])
+		fmt.Fprintf(tw, "%03X\t%04X\t%v\t%v\t%.2f%%\t\n", addr, op.Value,
+			Decode(op).Name, p.PCCounts[addr], percent(p.PCCounts[addr]))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nOpcode classes:\n")
+	classes := []string{}
+	for class := range p.ClassCounts {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if p.ClassCounts[classes[i]] != p.ClassCounts[classes[j]] {
+			return p.ClassCounts[classes[i]] > p.ClassCounts[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+	fmt.Fprintf(tw, "Class\tCount\tPercent\t\n")
+	for _, class := range classes {
+		fmt.Fprintf(tw, "%v\t%v\t%.2f%%\t\n", class, p.ClassCounts[class],
+			percent(p.ClassCounts[class]))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nSubroutines:\n")
+	subs := []*SubroutineStats{}
+	for _, stats := range p.Subroutines {
+		subs = append(subs, stats)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].Cycles != subs[j].Cycles {
+			return subs[i].Cycles > subs[j].Cycles
+		}
+		return subs[i].Target < subs[j].Target
+	})
+	fmt.Fprintf(tw, "Target\tCalls\tCycles\tSelf\tPercent\t\n")
+	for _, stats := range subs {
+		fmt.Fprintf(tw, "%03X\t%v\t%v\t%v\t%.2f%%\t\n", stats.Target, stats.Calls,
+			stats.Cycles, stats.SelfCycles, percent(stats.Cycles))
+	}
+	tw.Flush()
+}
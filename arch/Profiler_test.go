@@ -0,0 +1,75 @@
+package arch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func loadProgram(c8 *Chip8, program []uint16) {
+	for index, op := range program {
+		c8.Memory[0x200+2*index] = uint8(op >> 8)
+		c8.Memory[0x200+2*index+1] = uint8(op)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.Profiler = MakeProfiler()
+
+	loadProgram(c8, []uint16{
+		0x2206, // 200: Call 206.
+		0x1202, // 202: Loop forever.
+		0x0000, // 204: Unused.
+		0x6001, // 206: Set V0 to 1.
+		0x00EE, // 208: Return.
+	})
+	for cycle := 0; cycle < 10; cycle++ {
+		c8.EmulateCycle()
+	}
+
+	p := c8.Profiler
+	if p.Cycles != 10 {
+		t.Errorf("Profiler counted %v cycles, expected 10!\n", p.Cycles)
+	}
+	if p.PCCounts[0x202] != 7 {
+		t.Errorf("Profiler counted %v executions at 0x202, expected 7!\n",
+			p.PCCounts[0x202])
+	}
+	if p.ClassCounts["1NNN"] != 7 || p.ClassCounts["2NNN"] != 1 {
+		t.Errorf("Profiler opcode classes were wrong! Counts were %v\n",
+			p.ClassCounts)
+	}
+
+	sub, ok := p.Subroutines[0x206]
+	if !ok {
+		t.Fatalf("Profiler did not record the subroutine at 0x206!\n")
+	} else if sub.Calls != 1 || sub.Cycles != 2 || sub.SelfCycles != 2 {
+		t.Errorf("Profiler subroutine stats were wrong! Stats were %+v\n", *sub)
+	}
+
+	// The report should list the hottest address first.
+	report := bytes.Buffer{}
+	p.Report(&report, 5)
+	hot, cold := strings.Index(report.String(), "1202"), strings.Index(report.String(), "2206")
+	if hot < 0 || cold < 0 || hot > cold {
+		t.Errorf("Profiler report did not list the hot spot! Report was:\n%v",
+			report.String())
+	}
+
+	// The pprof output should be a gzipped protobuf naming our subroutine.
+	out := bytes.Buffer{}
+	if err := p.WritePprof(&out, "test.ch8"); err != nil {
+		t.Fatalf("Could not write pprof profile! Error was: %v\n", err)
+	}
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("pprof profile was not gzipped! Error was: %v\n", err)
+	}
+	raw, _ := io.ReadAll(gz)
+	if !bytes.Contains(raw, []byte("sub_206")) || !bytes.Contains(raw, []byte("main")) {
+		t.Errorf("pprof profile did not name its functions!\n")
+	}
+}
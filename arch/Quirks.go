@@ -0,0 +1,37 @@
+package arch
+
+import (
+	"sort"
+)
+
+/**
+ * Datatype to describe the instructions whose behavior differs between
+ * Chip8 interpreters. The zero value is this emulator's own behavior.
+ */
+type Quirks struct {
+	ShiftVY        bool // 8XY6 and 8XYE shift VY into VX, instead of shifting VX.
+	IncrementIndex bool // FX55 and FX65 leave I just past the last register.
+	JumpVX         bool // BXNN jumps relative to VX, instead of BNNN using V0.
+	ResetVF        bool // 8XY1, 8XY2 and 8XY3 set VF to 0.
+	WrapSprites    bool // DXYN wraps sprites around the screen, instead of clipping.
+	ShiftFlagLast  bool // 8XY6 and 8XYE set VF after VX, so that 8FY6 leaves the flag in VF.
+	FontLowDigit   bool // FX29 points I at the character for VX's last digit, instead of at VX*5 wrapped to a byte.
+}
+
+// Quirks of well-known interpreters, by name.
+var QuirkProfiles = map[string]Quirks{
+	"default": {},
+	"vip":     {ShiftVY: true, IncrementIndex: true, ResetVF: true, ShiftFlagLast: true, FontLowDigit: true},
+	"schip":   {JumpVX: true, ShiftFlagLast: true, FontLowDigit: true},
+	"xochip":  {ShiftVY: true, IncrementIndex: true, WrapSprites: true, ShiftFlagLast: true, FontLowDigit: true},
+}
+
+// QuirkProfileNames lists the names in QuirkProfiles, in order.
+func QuirkProfileNames() []string {
+	names := []string{}
+	for name := range QuirkProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
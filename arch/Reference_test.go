@@ -0,0 +1,490 @@
+package arch
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+/**
+ * A small Chip8 interpreter written from the opcode table, separately
+ * from Chip8Instructions.go, to check it against. It runs one instruction
+ * on a bare State, with timers ticking once per instruction like Chip8.
+ */
+type refMachine struct {
+	State
+	Keys   [16]bool
+	Quirks Quirks
+	Rando  *rand.Rand
+}
+
+// Stops the reference instruction, like Chip8.fault.
+type refFault struct{ Kind FaultKind }
+
+func (m *refMachine) load(addr uint16) uint8 {
+	if addr >= 4096 {
+		panic(refFault{FaultMemory})
+	}
+	return m.Memory[addr]
+}
+
+func (m *refMachine) store(addr uint16, value uint8) {
+	if addr >= 4096 {
+		panic(refFault{FaultMemory})
+	}
+	m.Memory[addr] = value
+}
+
+func (m *refMachine) pressed(key uint8) bool {
+	if key > 0xF {
+		panic(refFault{FaultKey})
+	}
+	return m.Keys[key]
+}
+
+// Runs one instruction, returning the fault that stopped it, if any.
+func (m *refMachine) step() (fault *refFault) {
+	defer func() {
+		if r := recover(); r != nil {
+			f := r.(refFault)
+			fault = &f
+		}
+	}()
+
+	op := uint16(m.Memory[m.PC])<<8 | uint16(m.Memory[m.PC+1])
+	x, y := op>>8&0xF, op>>4&0xF
+	nnn, nn, n := op&0xFFF, uint8(op), op&0xF
+	v := &m.Registers
+	next := m.PC + 2
+	jump := func(addr uint16) {
+		if addr >= 4095 {
+			panic(refFault{FaultPC})
+		}
+		next = addr
+	}
+	skipIf := func(cond bool) {
+		if cond {
+			next += 2
+		}
+	}
+	flag := func(set bool) {
+		v[0xF] = 0
+		if set {
+			v[0xF] = 1
+		}
+	}
+
+	switch {
+	case op&0xF0FF == 0x00E0:
+		m.Pixels = [ScreenWidth * ScreenHeight]bool{}
+	case op&0xF0FF == 0x00EE:
+		if m.SP == 0 {
+			panic(refFault{FaultStackUnderflow})
+		}
+		m.SP--
+		next = m.Stack[m.SP] + 2
+	case op>>12 == 0x0:
+		panic(refFault{FaultMachineCode})
+	case op>>12 == 0x1:
+		jump(nnn)
+	case op>>12 == 0x2:
+		if m.SP == 16 {
+			panic(refFault{FaultStackOverflow})
+		}
+		m.Stack[m.SP] = m.PC
+		m.SP++
+		jump(nnn)
+	case op>>12 == 0x3:
+		skipIf(v[x] == nn)
+	case op>>12 == 0x4:
+		skipIf(v[x] != nn)
+	case op>>12 == 0x5:
+		skipIf(v[x] == v[y])
+	case op>>12 == 0x6:
+		v[x] = nn
+	case op>>12 == 0x7:
+		v[x] += nn
+	case op&0xF00F == 0x8000:
+		v[x] = v[y]
+	case op&0xF00C == 0x8000: // 8XY1 to 8XY3
+		switch n {
+		case 1:
+			v[x] |= v[y]
+		case 2:
+			v[x] &= v[y]
+		case 3:
+			v[x] ^= v[y]
+		}
+		if m.Quirks.ResetVF {
+			v[0xF] = 0
+		}
+	case op&0xF00F == 0x8004:
+		carry := int(v[x])+int(v[y]) > 255
+		v[x] += v[y]
+		flag(carry)
+	case op&0xF00F == 0x8005:
+		noBorrow := v[x] >= v[y]
+		v[x] -= v[y]
+		flag(noBorrow)
+	case op&0xF00F == 0x8007:
+		noBorrow := v[y] >= v[x]
+		v[x] = v[y] - v[x]
+		flag(noBorrow)
+	case op&0xF00F == 0x8006, op&0xF00F == 0x800E:
+		src := v[x]
+		if m.Quirks.ShiftVY {
+			src = v[y]
+		}
+		bit := src & 0x01
+		if n == 0xE {
+			bit = src >> 7
+		}
+		if !m.Quirks.ShiftFlagLast {
+			// The flag goes first, and the shift sees it if it shifts VF.
+			v[0xF] = bit
+			src = v[x]
+			if m.Quirks.ShiftVY {
+				src = v[y]
+			}
+		}
+		if n == 0x6 {
+			v[x] = src >> 1
+		} else {
+			v[x] = src << 1
+		}
+		if m.Quirks.ShiftFlagLast {
+			v[0xF] = bit
+		}
+	case op>>12 == 0x9:
+		skipIf(v[x] != v[y])
+	case op>>12 == 0xA:
+		m.IndexReg = nnn
+	case op>>12 == 0xB:
+		offset := v[0]
+		if m.Quirks.JumpVX {
+			offset = v[x]
+		}
+		jump(nnn + uint16(offset))
+	case op>>12 == 0xC:
+		v[x] = uint8(m.Rando.Uint32()%256) & nn
+	case op>>12 == 0xD:
+		rows := make([]uint8, n)
+		for row := range rows {
+			rows[row] = m.load(m.IndexReg + uint16(row))
+		}
+		hit := false
+		for row, bits := range rows {
+			for col := 0; col < 8; col++ {
+				px, py := int(v[x])+col, int(v[y])+row
+				if m.Quirks.WrapSprites {
+					px, py = px%ScreenWidth, py%ScreenHeight
+				}
+				if bits&(0x80>>col) == 0 || px >= ScreenWidth || py >= ScreenHeight {
+					continue
+				}
+				pixel := &m.Pixels[py*ScreenWidth+px]
+				hit = hit || *pixel
+				*pixel = !*pixel
+			}
+		}
+		flag(hit)
+	case op&0xF0FF == 0xE09E:
+		skipIf(m.pressed(v[x]))
+	case op&0xF0FF == 0xE0A1:
+		skipIf(!m.pressed(v[x]))
+	case op&0xF0FF == 0xF007:
+		v[x] = m.DelayTimer
+	case op&0xF0FF == 0xF00A:
+		next = m.PC // Wait, unless a key is down.
+		for key := uint8(0); key < 16; key++ {
+			if m.Keys[key] {
+				v[x], next = key, m.PC+2
+				break
+			}
+		}
+	case op&0xF0FF == 0xF015:
+		m.DelayTimer = v[x]
+	case op&0xF0FF == 0xF018:
+		m.SoundTimer = v[x]
+	case op&0xF0FF == 0xF01E:
+		m.IndexReg += uint16(v[x])
+	case op&0xF0FF == 0xF029:
+		if m.Quirks.FontLowDigit {
+			m.IndexReg = uint16(v[x]&0xF) * 5
+		} else {
+			m.IndexReg = uint16(v[x] * 5)
+		}
+	case op&0xF0FF == 0xF033:
+		m.store(m.IndexReg, v[x]/100)
+		m.store(m.IndexReg+1, v[x]/10%10)
+		m.store(m.IndexReg+2, v[x]%10)
+	case op&0xF0FF == 0xF055:
+		for reg := uint16(0); reg <= x; reg++ {
+			m.store(m.IndexReg+reg, v[reg])
+		}
+		if m.Quirks.IncrementIndex {
+			m.IndexReg += x + 1
+		}
+	case op&0xF0FF == 0xF065:
+		for reg := uint16(0); reg <= x; reg++ {
+			v[reg] = m.load(m.IndexReg + reg)
+		}
+		if m.Quirks.IncrementIndex {
+			m.IndexReg += x + 1
+		}
+	default:
+		panic(refFault{FaultUnknownInstruction})
+	}
+
+	if m.DelayTimer > 0 {
+		m.DelayTimer--
+	}
+	if m.SoundTimer > 0 {
+		m.SoundTimer--
+	}
+	if next >= 4095 {
+		panic(refFault{FaultPC})
+	}
+	m.PC = next
+	return nil
+}
+
+// A machine state and keypad to run a single instruction from.
+type diffCase struct {
+	State
+	Keys [16]bool
+	Seed int64 // For CXNN.
+}
+
+// Opcode patterns to generate instructions from, with some unknown ones.
+var diffPatterns = []string{
+	"00E0", "00EE", "0NNN", "1NNN", "2NNN", "3XNN", "4XNN", "5XY0", "5XYN",
+	"6XNN", "7XNN", "8XY0", "8XY1", "8XY2", "8XY3", "8XY4", "8XY5", "8XY6",
+	"8XY7", "8XYE", "8XYN", "9XY0", "9XYN", "ANNN", "BNNN", "CXNN", "DXYN",
+	"EX9E", "EXA1", "EXNN", "FX07", "FX0A", "FX15", "FX18", "FX1E", "FX29",
+	"FX33", "FX55", "FX65", "FXNN",
+}
+
+// Makes a random case, favoring values at the edges of their ranges.
+func randomDiffCase(r *rand.Rand) diffCase {
+	edgy := func(edges ...int) int {
+		if r.Intn(3) == 0 {
+			return edges[r.Intn(len(edges))]
+		}
+		return r.Intn(edges[len(edges)-1] + 1)
+	}
+
+	c := diffCase{Seed: r.Int63()}
+	r.Read(c.Memory[:])
+	for reg := range c.Registers {
+		c.Registers[reg] = uint8(edgy(0, 1, 0x0F, 0x10, 0x7F, 0x80, 0xFF))
+	}
+	c.IndexReg = uint16(edgy(0, 0x50, 0xFF0, 0xFFD, 0xFFF, 0xFFFF))
+	c.PC = uint16(edgy(0, 0x200, 0xFFC, 0xFFD, 0xFFE))
+	c.SP = uint16(edgy(0, 1, 15, 16))
+	for level := range c.Stack {
+		c.Stack[level] = uint16(edgy(0x200, 0xFFC, 0xFFE))
+	}
+	c.DelayTimer = uint8(edgy(0, 1, 0xFF))
+	c.SoundTimer = uint8(edgy(0, 1, 0xFF))
+	for pixel := range c.Pixels {
+		c.Pixels[pixel] = r.Intn(2) == 0
+	}
+	for key := range c.Keys {
+		c.Keys[key] = r.Intn(4) == 0
+	}
+
+	op := uint16(0)
+	for _, digit := range diffPatterns[r.Intn(len(diffPatterns))] {
+		nibble := uint16(r.Intn(16))
+		if strings.ContainsRune("0123456789ABCDEF", digit) {
+			fmt.Sscanf(string(digit), "%X", &nibble)
+		}
+		op = op<<4 | nibble
+	}
+	c.Memory[c.PC], c.Memory[c.PC+1] = uint8(op>>8), uint8(op)
+	return c
+}
+
+// Runs a case on both machines, returning how they differ afterwards.
+func runDiffCase(c diffCase, quirks Quirks) []string {
+	ref := refMachine{State: c.State, Keys: c.Keys, Quirks: quirks, Rando: rand.New(rand.NewSource(c.Seed))}
+	refFault := ref.step()
+
+	c8 := MakeChip8(false)
+
+	c8.Mute = true
+	c8.Quirks = quirks
+	c8.Rando = rand.New(rand.NewSource(c.Seed))
+	c8.LoadState(c.State)
+	c8.HeldKeys = c.Keys
+	err := runUntilFault(c8, 1)
+
+	// After a fault, the machine is left mid-instruction, so only the
+	// kind of fault is comparable.
+	fault, _ := err.(*Fault)
+	switch {
+	case refFault == nil && fault == nil:
+		return diffStates(ref.State, c8.SaveState())
+	case refFault == nil:
+		return []string{fmt.Sprintf("fault: reference none, emulator %v", fault)}
+	case fault == nil:
+		return []string{fmt.Sprintf("fault: reference %v, emulator none", refFault.Kind)}
+	case refFault.Kind != fault.Kind:
+		return []string{fmt.Sprintf("fault: reference %v, emulator %v", refFault.Kind, fault)}
+	}
+	return nil
+}
+
+func diffStates(want, got State) []string {
+	if want == got {
+		return nil
+	}
+	diffs := []string{}
+	differ := func(name string, want, got any) {
+		if want != got {
+			diffs = append(diffs, fmt.Sprintf("%v: reference %X, emulator %X", name, want, got))
+		}
+	}
+	for reg := range want.Registers {
+		differ(fmt.Sprintf("V%X", reg), want.Registers[reg], got.Registers[reg])
+	}
+	differ("I", want.IndexReg, got.IndexReg)
+	differ("PC", want.PC, got.PC)
+	differ("SP", want.SP, got.SP)
+	differ("DT", want.DelayTimer, got.DelayTimer)
+	differ("ST", want.SoundTimer, got.SoundTimer)
+	for level := range want.Stack {
+		differ(fmt.Sprintf("stack[%v]", level), want.Stack[level], got.Stack[level])
+	}
+	for addr := range want.Memory {
+		differ(fmt.Sprintf("mem[%03X]", addr), want.Memory[addr], got.Memory[addr])
+	}
+	for pixel := range want.Pixels {
+		if want.Pixels[pixel] != got.Pixels[pixel] {
+			diffs = append(diffs, fmt.Sprintf("pixel (%v,%v): reference %v, emulator %v",
+				pixel%ScreenWidth, pixel/ScreenWidth, want.Pixels[pixel], got.Pixels[pixel]))
+		}
+	}
+	return diffs
+}
+
+// Simplifies a failing case as far as it will go while still failing,
+// by zeroing one part of it at a time.
+func minimizeDiffCase(c diffCase, quirks Quirks) diffCase {
+	op := [2]uint8{c.Memory[c.PC], c.Memory[c.PC+1]}
+	simplifications := []func(c *diffCase){
+		func(c *diffCase) { // Move the instruction to 200.
+			c.Memory[c.PC], c.Memory[c.PC+1] = 0, 0
+			c.PC = 0x200
+			c.Memory[c.PC], c.Memory[c.PC+1] = op[0], op[1]
+		},
+		func(c *diffCase) {
+			c.Memory = [4096]uint8{}
+			c.Memory[c.PC], c.Memory[c.PC+1] = op[0], op[1]
+		},
+		func(c *diffCase) { c.Pixels = [ScreenWidth * ScreenHeight]bool{} },
+		func(c *diffCase) { c.Stack = [16]uint16{} },
+		func(c *diffCase) { c.Keys = [16]bool{} },
+		func(c *diffCase) { c.IndexReg = 0 },
+		func(c *diffCase) { c.SP = 0 },
+		func(c *diffCase) { c.DelayTimer = 0 },
+		func(c *diffCase) { c.SoundTimer = 0 },
+	}
+	for reg := range c.Registers {
+		simplifications = append(simplifications, func(c *diffCase) { c.Registers[reg] = 0 })
+	}
+	for level := range c.Stack {
+		simplifications = append(simplifications, func(c *diffCase) { c.Stack[level] = 0 })
+	}
+	for key := range c.Keys {
+		simplifications = append(simplifications, func(c *diffCase) { c.Keys[key] = false })
+	}
+	for addr := range c.Memory {
+		simplifications = append(simplifications, func(c *diffCase) {
+			if uint16(addr) != c.PC && uint16(addr) != c.PC+1 {
+				c.Memory[addr] = 0
+			}
+		})
+	}
+	for pixel := range c.Pixels {
+		simplifications = append(simplifications, func(c *diffCase) { c.Pixels[pixel] = false })
+	}
+
+	for simplified := true; simplified; {
+		simplified = false
+		for _, simplify := range simplifications {
+			smaller := c
+			simplify(&smaller)
+			if smaller != c && len(runDiffCase(smaller, quirks)) > 0 {
+				c, simplified = smaller, true
+			}
+		}
+	}
+	return c
+}
+
+// Describes the parts of a case that aren't zero.
+func (c diffCase) String() string {
+	parts := []string{fmt.Sprintf("opcode %02X%02X at PC=%03X", c.Memory[c.PC], c.Memory[c.PC+1], c.PC)}
+	for reg, value := range c.Registers {
+		if value != 0 {
+			parts = append(parts, fmt.Sprintf("V%X=%02X", reg, value))
+		}
+	}
+	for name, value := range map[string]uint16{"I": c.IndexReg, "SP": c.SP,
+		"DT": uint16(c.DelayTimer), "ST": uint16(c.SoundTimer)} {
+		if value != 0 {
+			parts = append(parts, fmt.Sprintf("%v=%X", name, value))
+		}
+	}
+	for level, addr := range c.Stack {
+		if addr != 0 {
+			parts = append(parts, fmt.Sprintf("stack[%v]=%03X", level, addr))
+		}
+	}
+	for addr, value := range c.Memory {
+		if value != 0 && uint16(addr) != c.PC && uint16(addr) != c.PC+1 {
+			parts = append(parts, fmt.Sprintf("mem[%03X]=%02X", addr, value))
+		}
+	}
+	for key, held := range c.Keys {
+		if held {
+			parts = append(parts, fmt.Sprintf("key %X held", key))
+		}
+	}
+	lit := 0
+	for _, pixel := range c.Pixels {
+		if pixel {
+			lit++
+		}
+	}
+	if lit > 0 {
+		parts = append(parts, fmt.Sprintf("%v pixels lit", lit))
+	}
+	parts = append(parts, fmt.Sprintf("seed %v", c.Seed))
+	return strings.Join(parts, ", ")
+}
+
+// Number of random cases to check for each quirk profile.
+const diffCases = 20000
+
+func TestDifferential(t *testing.T) {
+	for _, name := range QuirkProfileNames() {
+		quirks := QuirkProfiles[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < diffCases; i++ {
+				c := randomDiffCase(r)
+				if len(runDiffCase(c, quirks)) == 0 {
+					continue
+				}
+				c = minimizeDiffCase(c, quirks)
+				t.Fatalf("Case %v differs from the reference model.\nReproducer: %v\nDifferences:\n\t%v\n",
+					i, c, strings.Join(runDiffCase(c, quirks), "\n\t"))
+			}
+		})
+	}
+}
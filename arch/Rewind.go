@@ -0,0 +1,116 @@
+package arch
+
+import (
+	"encoding/binary"
+)
+
+/**
+ * Datatype to describe a rewind buffer: a ring of the states of recent
+ * frames. Only the newest state is kept whole. Every older state is kept
+ * as a delta from the state after it, which is small because little
+ * changes between frames, and lets the oldest delta be dropped freely.
+ */
+type Rewind struct {
+	Capacity int      // Maximum number of frames kept.
+	deltas   [][]byte // Ring buffer; deltas[i] turns a state into the one before it.
+	start    int      // Index of the oldest delta.
+	count    int
+	latest   []byte // The newest state, marshaled.
+}
+
+func MakeRewind(seconds float64) *Rewind {
+	r := Rewind{}
+	r.Capacity = int(seconds * FrameRate)
+	r.deltas = make([][]byte, r.Capacity)
+	return &r
+}
+
+// Frames returns how many frames can currently be rewound.
+func (r *Rewind) Frames() int {
+	return r.count
+}
+
+// Push records the current state. It is called at the end of every frame.
+func (r *Rewind) Push(c8 *Chip8) {
+	if r.Capacity == 0 {
+		return
+	}
+	state, _ := c8.SaveState().MarshalBinary()
+	if r.latest != nil {
+		delta := encodeDelta(state, r.latest)
+		if r.count == r.Capacity { // Full, so drop the oldest frame.
+			r.start = (r.start + 1) % r.Capacity
+			r.count--
+		}
+		r.deltas[(r.start+r.count)%r.Capacity] = delta
+		r.count++
+	}
+	r.latest = state
+}
+
+// Clear forgets every recorded frame.
+func (r *Rewind) Clear() {
+	r.deltas = make([][]byte, r.Capacity)
+	r.start, r.count, r.latest = 0, 0, nil
+}
+
+// Back restores the state from one frame earlier, returning false
+// if there is nothing left to rewind. Emulation continues from there.
+func (r *Rewind) Back(c8 *Chip8) bool {
+	if r.count == 0 {
+		return false
+	}
+	newest := (r.start + r.count - 1) % r.Capacity
+	r.latest = applyDelta(r.latest, r.deltas[newest])
+	r.deltas[newest] = nil
+	r.count--
+
+	state := State{}
+	state.UnmarshalBinary(r.latest)
+	c8.LoadState(state)
+	return true
+}
+
+// Encodes the difference from one state to another as runs of unchanged
+// bytes and changed bytes. Changed bytes are stored XORed with the
+// original, so the same delta can be applied in either direction.
+func encodeDelta(from, to []byte) []byte {
+	delta := []byte{}
+	for pos := 0; pos < len(from); {
+		unchanged := pos
+		for unchanged < len(from) && from[unchanged] == to[unchanged] {
+			unchanged++
+		}
+		changed := unchanged
+		for changed < len(from) && from[changed] != to[changed] {
+			changed++
+		}
+
+		delta = binary.AppendUvarint(delta, uint64(unchanged-pos))
+		delta = binary.AppendUvarint(delta, uint64(changed-unchanged))
+		for index := unchanged; index < changed; index++ {
+			delta = append(delta, from[index]^to[index])
+		}
+		pos = changed
+	}
+	return delta
+}
+
+func applyDelta(from, delta []byte) []byte {
+	to := append([]byte{}, from...)
+	pos := 0
+	for len(delta) > 0 {
+		unchanged, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		changed, n := binary.Uvarint(delta)
+		delta = delta[n:]
+
+		pos += int(unchanged)
+		for index := 0; index < int(changed); index++ {
+			to[pos] ^= delta[index]
+			pos++
+		}
+		delta = delta[changed:]
+	}
+	return to
+}
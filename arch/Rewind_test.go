@@ -0,0 +1,88 @@
+package arch
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStateMarshal(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.Registers[5] = 0x42
+	c8.IndexReg = 0x345
+	c8.Stack[0], c8.SP = 0x202, 1
+	c8.Screen.XorPixel(3, 7)
+
+	data, _ := c8.SaveState().MarshalBinary()
+	if len(data) != StateSize {
+		t.Fatalf("State was %v bytes, expected %v!\n", len(data), StateSize)
+	}
+	state := State{}
+	if err := state.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Could not unmarshal state! Error was: %v\n", err)
+	}
+	if state != c8.SaveState() {
+		t.Errorf("State did not survive marshaling!\n")
+	}
+
+	c8.SP = 17
+	data, _ = c8.SaveState().MarshalBinary()
+	if err := state.UnmarshalBinary(data); err == nil {
+		t.Errorf("State with SP past the stack was accepted!\n")
+	}
+	c8.SP, c8.PC = 0, 0xFFF
+	data, _ = c8.SaveState().MarshalBinary()
+	if err := state.UnmarshalBinary(data); err == nil {
+		t.Errorf("State with PC past memory was accepted!\n")
+	}
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	older := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	newer := []byte{1, 2, 9, 9, 5, 6, 7, 0}
+
+	delta := encodeDelta(newer, older)
+	if result := applyDelta(newer, delta); !bytes.Equal(result, older) {
+		t.Errorf("Delta produced %v, expected %v!\n", result, older)
+	}
+	if result := applyDelta(older, delta); !bytes.Equal(result, newer) {
+		t.Errorf("Reversed delta produced %v, expected %v!\n", result, newer)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.Rewind = MakeRewind(2.0 / FrameRate) // Only keep two frames.
+	loadProgram(c8, []uint16{
+		0x7001, // 200: Add 1 to V0.
+		0x1200, // 202: Loop forever.
+	})
+
+	c8.Rewind.Push(c8)
+	history := []uint8{}
+	for frame := 0; frame < 4; frame++ {
+		history = append(history, c8.Registers[0])
+		for cycle := 0; cycle < 10; cycle++ {
+			c8.EmulateCycle()
+		}
+		c8.Rewind.Push(c8)
+	}
+
+	for back := 1; back <= 2; back++ {
+		if !c8.Rewind.Back(c8) {
+			t.Fatalf("Could not rewind %v frames!\n", back)
+		}
+		if expected := history[len(history)-back]; c8.Registers[0] != expected {
+			t.Errorf("V0 was %v after rewinding %v frames, expected %v!\n",
+				c8.Registers[0], back, expected)
+		}
+	}
+	if c8.Rewind.Back(c8) {
+		t.Errorf("Rewound further than the buffer should allow!\n")
+	}
+
+	// Emulation should continue from the restored state.
+	c8.EmulateCycle()
+	if c8.PC != 0x202 || c8.Registers[0] != history[2]+1 {
+		t.Errorf("Emulation did not continue from the rewound state!\n")
+	}
+}
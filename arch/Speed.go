@@ -0,0 +1,87 @@
+package arch
+
+import (
+	"jugonz/chip8/gfx"
+	"strconv"
+)
+
+const (
+	DefaultFastForward = 4.0  // Speed while fast-forwarding, unless set otherwise.
+	SlowMotionSpeed    = 0.25 // Speed in slow motion.
+)
+
+// Speed returns how many frames are emulated for every real frame.
+// The timers tick every cycle and a frame is a fixed number of cycles, so
+// the timers, sound and keypad all scale with speed and games behave the same.
+func (c8 *Chip8) Speed() float64 {
+	switch {
+	case c8.FastForwarding || c8.fastForwardHeld:
+		if c8.FastForward <= 0 {
+			return DefaultFastForward
+		}
+		return c8.FastForward
+	case c8.SlowMotion:
+		return SlowMotionSpeed
+	}
+	return 1
+}
+
+// AdvanceFrame pauses the game, then runs exactly one frame if it was
+// already paused, so that games can be stepped through a frame at a time.
+func (c8 *Chip8) AdvanceFrame() {
+	if !c8.Paused {
+		c8.Paused = true
+		return
+	}
+	c8.EmulateFrame()
+	c8.DrawScreen()
+}
+
+// Status describes how the game is running, if not at normal speed.
+func (c8 *Chip8) Status() string {
+	if c8.Menu != nil && c8.Menu.Open {
+		return "Menu"
+	}
+	if c8.Paused {
+		return "Paused"
+	}
+	if speed := c8.Speed(); speed != 1 {
+		return strconv.FormatFloat(speed, 'g', -1, 64) + "x"
+	}
+	return ""
+}
+
+// Runs the frames that are due this real frame, at the current speed.
+// In slow motion, some real frames have no frames due.
+func (c8 *Chip8) emulateAtSpeed() {
+	c8.frameCredit += c8.Speed()
+	if c8.frameCredit < 1 {
+		c8.SetKeys() // Keep the window responsive.
+	}
+	for ; c8.frameCredit >= 1; c8.frameCredit-- {
+		c8.EmulateFrame()
+	}
+	c8.DrawScreen() // Once, however many frames ran.
+}
+
+// Handles the pause and speed hotkeys.
+func (c8 *Chip8) handleSpeedHotkeys() {
+	if c8.Controller.HotkeyPressed(gfx.HotkeyPause) {
+		c8.Paused = !c8.Paused
+	}
+	if c8.Controller.HotkeyPressed(gfx.HotkeyFrameAdvance) {
+		c8.AdvanceFrame()
+	}
+	if c8.Controller.HotkeyPressed(gfx.HotkeySlowMotion) {
+		c8.SlowMotion = !c8.SlowMotion
+	}
+	c8.fastForwardHeld = c8.Controller.HotkeyHeld(gfx.HotkeyFastForward)
+}
+
+// Shows the status on screen when it changes.
+func (c8 *Chip8) showStatus() {
+	if status := c8.Status(); status != c8.shownStatus {
+		c8.Screen.SetStatus(status)
+		c8.shownStatus = status
+	}
+}
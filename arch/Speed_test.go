@@ -0,0 +1,58 @@
+package arch
+
+import (
+	"jugonz/chip8/gfx"
+	"testing"
+)
+
+func TestSpeeds(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.LoadROM([]byte{0x12, 0x00}) // Loop forever.
+	perFrame := uint64(c8.CyclesPerFrame())
+
+	tests := []struct {
+		name           string
+		fastForward    float64
+		fastForwarding bool
+		slowMotion     bool
+		realFrames     int
+		frames         uint64
+		status         string
+	}{
+		{"normal", 0, false, false, 4, 4, ""},
+		{"fast", 0, true, false, 2, 2 * DefaultFastForward, "4x"},
+		{"faster", 10, true, true, 2, 20, "10x"},
+		{"slow", 0, false, true, 8, 2, "0.25x"},
+	}
+	for _, test := range tests {
+		c8.Cycle = 0
+		c8.FastForward = test.fastForward
+		c8.FastForwarding = test.fastForwarding
+		c8.SlowMotion = test.slowMotion
+		for frame := 0; frame < test.realFrames; frame++ {
+			c8.emulateAtSpeed()
+		}
+		if c8.Cycle != test.frames*perFrame {
+			t.Errorf("%v: expected %v frames, ran %v cycles\n", test.name, test.frames, c8.Cycle)
+		}
+		c8.showStatus()
+		if status := c8.Screen.(*gfx.Headless).Status; status != test.status {
+			t.Errorf("%v: expected status %q, got %q\n", test.name, test.status, status)
+		}
+	}
+}
+
+func TestAdvanceFrame(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.LoadROM([]byte{0x12, 0x00})
+
+	c8.AdvanceFrame() // Only pauses.
+	if !c8.Paused || c8.Cycle != 0 || c8.Status() != "Paused" {
+		t.Errorf("Advancing while running should pause, without running\n")
+	}
+	c8.AdvanceFrame()
+	c8.AdvanceFrame()
+	if !c8.Paused || c8.Cycle != 2*uint64(c8.CyclesPerFrame()) {
+		t.Errorf("Expected two frames while paused, ran %v cycles\n", c8.Cycle)
+	}
+}
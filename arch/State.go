@@ -0,0 +1,122 @@
+package arch
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/**
+ * Datatype to describe a snapshot of everything a running Chip8 game
+ * depends on, so that it can be restored later. It is only meaningful
+ * between cycles, so per-cycle values like Opcode are not included.
+ */
+type State struct {
+	Memory     [4096]uint8
+	Registers  [16]uint8
+	IndexReg   uint16
+	PC         uint16
+	DelayTimer uint8
+	SoundTimer uint8
+	Stack      [16]uint16
+	SP         uint16
+	Pixels     [ScreenWidth * ScreenHeight]bool // Row by row.
+}
+
+// Size of a State after MarshalBinary.
+const StateSize = 4096 + 16 + 2 + 2 + 1 + 1 + 16*2 + 2 + ScreenWidth*ScreenHeight/8
+
+func (c8 *Chip8) SaveState() State {
+	s := State{}
+	s.Memory = c8.Memory
+	s.Registers = c8.Registers
+	s.IndexReg = c8.IndexReg
+	s.PC = c8.PC
+	s.DelayTimer = c8.DelayTimer
+	s.SoundTimer = c8.SoundTimer
+	s.Stack = c8.Stack
+	s.SP = c8.SP
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			s.Pixels[y*ScreenWidth+x] = c8.Screen.GetPixel(uint16(x), uint16(y))
+		}
+	}
+	return s
+}
+
+func (c8 *Chip8) LoadState(s State) {
+	c8.Memory = s.Memory
+	c8.Registers = s.Registers
+	c8.IndexReg = s.IndexReg
+	c8.PC = s.PC
+	c8.DelayTimer = s.DelayTimer
+	c8.SoundTimer = s.SoundTimer
+	c8.Stack = s.Stack
+	c8.SP = s.SP
+
+	c8.Screen.ClearScreen()
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			if s.Pixels[y*ScreenWidth+x] {
+				c8.Screen.XorPixel(uint16(x), uint16(y))
+			}
+		}
+	}
+	c8.DrawFlag = true // The screen needs redrawing.
+}
+
+// MarshalBinary packs the state into StateSize bytes,
+// with the pixels stored as one bit each.
+func (s State) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, StateSize)
+	out = append(out, s.Memory[:]...)
+	out = append(out, s.Registers[:]...)
+	out = binary.BigEndian.AppendUint16(out, s.IndexReg)
+	out = binary.BigEndian.AppendUint16(out, s.PC)
+	out = append(out, s.DelayTimer, s.SoundTimer)
+	for _, addr := range s.Stack {
+		out = binary.BigEndian.AppendUint16(out, addr)
+	}
+	out = binary.BigEndian.AppendUint16(out, s.SP)
+
+	pixels := make([]byte, len(s.Pixels)/8)
+	for index, on := range s.Pixels {
+		if on {
+			pixels[index/8] |= 0x80 >> (index % 8)
+		}
+	}
+	return append(out, pixels...), nil
+}
+
+func (s *State) UnmarshalBinary(data []byte) error {
+	if len(data) != StateSize {
+		return fmt.Errorf("state is %v bytes, expected %v", len(data), StateSize)
+	}
+	pos := 0
+	next := func(n int) []byte {
+		pos += n
+		return data[pos-n : pos]
+	}
+
+	copy(s.Memory[:], next(len(s.Memory)))
+	copy(s.Registers[:], next(len(s.Registers)))
+	s.IndexReg = binary.BigEndian.Uint16(next(2))
+	s.PC = binary.BigEndian.Uint16(next(2))
+	s.DelayTimer = next(1)[0]
+	s.SoundTimer = next(1)[0]
+	for index := range s.Stack {
+		s.Stack[index] = binary.BigEndian.Uint16(next(2))
+	}
+	s.SP = binary.BigEndian.Uint16(next(2))
+	if int(s.SP) > len(s.Stack) {
+		return fmt.Errorf("state has SP %v, but the stack only holds %v", s.SP, len(s.Stack))
+	}
+	if int(s.PC)+1 >= len(s.Memory) {
+		return fmt.Errorf("state has PC %X, past the end of memory", s.PC)
+	}
+
+	pixels := next(len(s.Pixels) / 8)
+	for index := range s.Pixels {
+		s.Pixels[index] = pixels[index/8]&(0x80>>(index%8)) != 0
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package arch
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * Datatype to describe a watchpoint: a location, or a range of memory,
+ * that the debugger breaks on when an instruction reads or writes it.
+ */
+type Watchpoint struct {
+	Loc    Location
+	Length uint16 // Number of bytes watched, for memory ranges.
+	Mode   WatchMode
+}
+
+type WatchMode string
+
+const (
+	WatchRead   WatchMode = "read"
+	WatchWrite  WatchMode = "write"
+	WatchChange WatchMode = "change" // Writes that change the value.
+	WatchAccess WatchMode = "access" // Reads or writes.
+)
+
+type AccessKind int
+
+const (
+	AccessRead AccessKind = iota
+	AccessWrite
+)
+
+// A single access that hit a watchpoint.
+type WatchHit struct {
+	Num      int // Number of the watchpoint, starting at 1.
+	Loc      Location
+	Kind     AccessKind
+	Old, New uint16
+	Cycle    uint64 // Cycle in which the access happened.
+	PC       uint16
+	Opcode   Opcode
+}
+
+// ParseWatchpoint parses a location as for ParseLocation, or a range of
+// memory like "300-30F", and a mode of "read", "write", "change" or "access".
+func ParseWatchpoint(spec string, mode string) (Watchpoint, error) {
+	w := Watchpoint{Length: 1, Mode: WatchMode(mode)}
+	switch w.Mode {
+	case WatchRead, WatchWrite, WatchChange, WatchAccess:
+	default:
+		return w, fmt.Errorf("%q is not read, write, change or access", mode)
+	}
+
+	if startSpec, endSpec, found := strings.Cut(spec, "-"); found {
+		start, err := ParseAddress(startSpec)
+		if err != nil {
+			return w, err
+		}
+		end, err := ParseAddress(endSpec)
+		if err != nil {
+			return w, err
+		}
+		if end < start {
+			return w, fmt.Errorf("range %q ends before it starts", spec)
+		}
+		w.Loc, w.Length = Location{LocMemory, start}, end-start+1
+		return w, nil
+	}
+
+	loc, err := ParseLocation(spec)
+	w.Loc = loc
+	return w, err
+}
+
+// Matches returns true if an access should trigger the watchpoint.
+func (w Watchpoint) Matches(loc Location, kind AccessKind, old, new uint16) bool {
+	if loc.Kind != w.Loc.Kind || loc.Addr < w.Loc.Addr || loc.Addr >= w.Loc.Addr+w.Length {
+		return false
+	}
+	switch w.Mode {
+	case WatchRead:
+		return kind == AccessRead
+	case WatchWrite:
+		return kind == AccessWrite
+	case WatchAccess:
+		return true
+	default:
+		return kind == AccessWrite && old != new
+	}
+}
+
+func (w Watchpoint) String() string {
+	if w.Length > 1 {
+		return fmt.Sprintf("%v-%03X (%v)", w.Loc, w.Loc.Addr+w.Length-1, w.Mode)
+	}
+	return fmt.Sprintf("%v (%v)", w.Loc, w.Mode)
+}
+
+func (hit WatchHit) String() string {
+	access := fmt.Sprintf("%v read (value %v)", hit.Loc, hit.Old)
+	if hit.Kind == AccessWrite {
+		access = fmt.Sprintf("%v written (%v -> %v)", hit.Loc, hit.Old, hit.New)
+	}
+	return fmt.Sprintf("Watchpoint %v: %v by %03X: %04X %v",
+		hit.Num, access, hit.PC, hit.Opcode.Value, Decode(hit.Opcode).Name)
+}
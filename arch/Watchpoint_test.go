@@ -0,0 +1,52 @@
+package arch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWatchpoints(t *testing.T) {
+	c8 := MakeChip8(false)
+	c8.History = MakeHistory()
+	out := bytes.Buffer{}
+	c8.Debugger = MakeDebugger(strings.NewReader(""), &out)
+	d := c8.Debugger
+	loadProgram(c8, []uint16{
+		0xA300, // 200: Set I to 300.
+		0x6005, // 202: Set V0 to 5.
+		0xF033, // 204: Store V0 as BCD at 300-302.
+		0x7001, // 206: Add 1 to V0.
+		0x1204, // 208: Loop to 204.
+	})
+
+	d.Exec(c8, "watch 300-302 change")
+	d.Exec(c8, "watch V0 read")
+	d.Exec(c8, "step 10")
+	if c8.Cycle != 3 || len(d.Hits) != 2 {
+		t.Fatalf("Step stopped at cycle %v with hits %v, expected cycle 3 with 2 hits!\n", c8.Cycle, d.Hits)
+	}
+	if hit := d.Hits[0]; hit.Num != 2 || hit.PC != 0x204 || hit.Loc.Kind != LocRegister {
+		t.Errorf("First hit should be V0 read at 204, was %v\n", hit)
+	}
+	if hit := d.Hits[1]; hit.Num != 1 || hit.Loc.Addr != 0x302 || hit.New != 5 {
+		t.Errorf("Second hit should be 302 changing to 5, was %v\n", hit)
+	}
+
+	d.Exec(c8, "unwatch 2")
+	c8.Paused = false
+	d.resuming = true
+	for cycle := 0; cycle < 20 && !c8.Paused; cycle++ {
+		if !d.ShouldBreak(c8) {
+			c8.EmulateCycle()
+		}
+	}
+	if !c8.Paused || c8.PC != 0x206 || c8.Memory[0x302] != 6 {
+		t.Errorf("Running did not stop after the next change! PC was %03X\n", c8.PC)
+	}
+
+	d.Exec(c8, "reverse-continue")
+	if c8.Cycle != 3 || c8.Memory[0x302] != 5 {
+		t.Errorf("Reverse continue ended at cycle %v, expected 3!\n", c8.Cycle)
+	}
+}
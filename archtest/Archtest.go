@@ -0,0 +1,49 @@
+// Package archtest has helpers for tests that build ROMs from opcodes, and
+// for testing servers that control a Chip8 from other goroutines.
+package archtest
+
+import (
+	"jugonz/chip8/arch"
+	"testing"
+	"time"
+)
+
+// Rom converts opcodes to the bytes of a ROM.
+func Rom(program []uint16) []byte {
+	rom := []byte{}
+	for _, op := range program {
+		rom = append(rom, uint8(op>>8), uint8(op))
+	}
+	return rom
+}
+
+// Load puts opcodes into memory, where a ROM would be loaded.
+func Load(c8 *arch.Chip8, program []uint16) {
+	copy(c8.Memory[0x200:], Rom(program))
+}
+
+// Run runs a Chip8 in the background like arch.Chip8.Run does, taking
+// tasks and emulating frames while it is not paused, and pausing if the
+// game faults, until the test ends.
+func Run(t *testing.T, c8 *arch.Chip8) {
+	if c8.Tasks == nil {
+		c8.Tasks = make(chan func(c8 *arch.Chip8))
+	}
+	stop := make(chan bool)
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			c8.PauseOnFault(func() {
+				c8.RunTasks()
+				if !c8.Paused {
+					c8.EmulateFrame()
+				}
+			})
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+// Package batch runs many games or configurations at once, each on its own
+// headless Chip8 in its own goroutine, and reports how each run ended.
+// Runs are deterministic, so the state hashes from one batch can be
+// compared against another to catch changes in behavior.
+package batch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"jugonz/chip8/arch"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/**
+ * Datatype to describe a manifest: a list of runs, kept as JSON like
+ *
+ *	{"runs": [
+ *		{"name": "brix", "rom": "c8games/BRIX", "frames": 600, "seed": 1},
+ *		{"rom": "hack.ch8", "patches": ["fix.ips"]}
+ *	]}
+ *
+ * Paths are relative to the manifest.
+ */
+type Manifest struct {
+	Runs []Run `json:"runs"`
+}
+
+/**
+ * Datatype to describe a single run of a game.
+ */
+type Run struct {
+	Name    string   `json:"name"` // Defaults to the ROM's file name.
+	ROM     string   `json:"rom"`
+	Patches []string `json:"patches"`
+	Frames  int      `json:"frames"` // Defaults to DefaultFrames.
+	Seed    int64    `json:"seed"`   // For random numbers.
+}
+
+// Ten seconds of gameplay.
+const DefaultFrames = 10 * arch.FrameRate
+
+/**
+ * Datatype to describe how a run ended.
+ */
+type Result struct {
+	Name   string `json:"name"`
+	ROM    string `json:"rom"`
+	Cycles uint64 `json:"cycles"`
+	Hash   string `json:"hash,omitempty"`  // SHA-256 of the final state, if the game loaded.
+	Error  string `json:"error,omitempty"` // Why the run stopped early, if it did.
+}
+
+func LoadManifest(filePath string) (*Manifest, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	m := Manifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%v: %v", filePath, err)
+	}
+
+	dir := filepath.Dir(filePath)
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	for index := range m.Runs {
+		run := &m.Runs[index]
+		if run.ROM == "" {
+			return nil, fmt.Errorf("%v: run %v has no ROM", filePath, index+1)
+		}
+		if run.Name == "" {
+			run.Name = filepath.Base(run.ROM)
+		}
+		if run.Frames == 0 {
+			run.Frames = DefaultFrames
+		}
+		run.ROM = resolve(run.ROM)
+		for patchNum, patchPath := range run.Patches {
+			run.Patches[patchNum] = resolve(patchPath)
+		}
+	}
+	return &m, nil
+}
+
+// ExecuteAll runs every run, using up to workers goroutines at once
+// (but at least one), and returns their results in the same order.
+func ExecuteAll(runs []Run, workers int) []Result {
+	workers = max(workers, 1)
+	results := make([]Result, len(runs))
+	next := make(chan int)
+	wait := sync.WaitGroup{}
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for index := range next {
+				results[index] = runs[index].Execute()
+			}
+		}()
+	}
+	for index := range runs {
+		next <- index
+	}
+	close(next)
+	wait.Wait()
+	return results
+}
+
+// Execute plays the game for the run's frames on a new machine.
+func (run Run) Execute() (result Result) {
+	result = Result{Name: run.Name, ROM: run.ROM}
+	c8 := arch.MakeChip8(false)
+	c8.Mute = true
+	c8.Rando = rand.New(rand.NewSource(run.Seed))
+
+	loaded := false
+	var err error
+	defer func() {
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Cycles = c8.Cycle
+		if loaded {
+			state, _ := c8.SaveState().MarshalBinary()
+			hash := sha256.Sum256(state)
+			result.Hash = hex.EncodeToString(hash[:])
+		}
+	}()
+	defer arch.CatchFault(&err)
+	if err = c8.LoadGame(run.ROM, run.Patches...); err != nil {
+		return result
+	}
+	loaded = true
+	for frame := 0; frame < run.Frames; frame++ {
+		c8.EmulateFrame()
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, manifest string) *Manifest {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "crash.ch8"), []byte{0x00, 0x00}, 0644)
+	path := filepath.Join(dir, "manifest.json")
+	os.WriteFile(path, []byte(manifest), 0644)
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("Could not load manifest! Error was: %v\n", err)
+	}
+	return m
+}
+
+func TestExecuteAll(t *testing.T) {
+	brix, _ := filepath.Abs("../c8games/BRIX")
+	m := writeManifest(t, `{"runs": [
+		{"name": "first", "rom": "`+brix+`", "frames": 30, "seed": 7},
+		{"name": "second", "rom": "`+brix+`", "frames": 30, "seed": 7},
+		{"rom": "`+brix+`", "frames": 30, "seed": 8},
+		{"rom": "missing.ch8"},
+		{"rom": "crash.ch8"}
+	]}`)
+	if m.Runs[2].Name != "BRIX" || m.Runs[3].Frames != DefaultFrames {
+		t.Errorf("Defaults were not filled in: %+v\n", m.Runs)
+	}
+
+	results := ExecuteAll(m.Runs, 3)
+	if len(results) != 5 || results[0].Name != "first" || results[4].Name != "crash.ch8" {
+		t.Fatalf("Results were out of order: %+v\n", results)
+	}
+	if results[0].Error != "" || results[0].Cycles == 0 || len(results[0].Hash) != 64 {
+		t.Errorf("First run was %+v\n", results[0])
+	}
+	if results[0].Hash != results[1].Hash || results[0].Cycles != results[1].Cycles {
+		t.Errorf("Identical runs ended differently: %+v and %+v\n", results[0], results[1])
+	}
+	if results[0].Hash == results[2].Hash {
+		t.Errorf("Runs with different seeds ended the same\n")
+	}
+	if results[3].Error == "" || results[3].Hash != "" {
+		t.Errorf("Missing ROM gave %+v\n", results[3])
+	}
+	if !strings.Contains(results[4].Error, "Unimplemented") || results[4].Cycles != 0 || results[4].Hash == "" {
+		t.Errorf("Crashing ROM gave %+v\n", results[4])
+	}
+
+	// With no workers, runs still execute instead of blocking forever.
+	if results := ExecuteAll(m.Runs[3:], 0); len(results) != 2 || results[0].Error == "" {
+		t.Errorf("Running with no workers gave %+v\n", results)
+	}
+}
@@ -0,0 +1,169 @@
+// Package conformance checks the interpreter against test ROMs, such as
+// the community flags, quirks and opcode tests. A test ROM runs without
+// a window until it halts by jumping to itself, and then its screen is
+// checked against what was expected.
+package conformance
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"jugonz/chip8/arch"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+/**
+ * Datatype to describe the outcome of one test ROM.
+ */
+type Result struct {
+	Name      string
+	Passed    bool
+	Unchecked bool // True if the ROM halted, but had no expected screen to check.
+	Cycles    uint64
+	Text      string // What the screen says, in the built-in font.
+	Detail    string // How the test was checked, or why it failed.
+}
+
+// Expected screens are kept next to each test ROM, with these extensions.
+const (
+	ImageExt = ".png" // An image of the whole screen, lit pixels white.
+	TextExt  = ".txt" // The text on the screen, as read by ReadText.
+)
+
+// DefaultMaxCycles is about a minute of emulation.
+const DefaultMaxCycles = 60 * 60 * 180
+
+// Halted checks whether the machine is stuck jumping to itself, which is
+// how test ROMs say they're done.
+func Halted(c8 *arch.Chip8) bool {
+	if int(c8.PC)+1 >= len(c8.Memory) {
+		return false
+	}
+	op := arch.MakeOpcode(uint16(c8.Memory[c8.PC])<<8 | uint16(c8.Memory[c8.PC+1]))
+	return arch.Decode(op) == &arch.InstrJump && op.Literal == c8.PC
+}
+
+// RunTest runs a test ROM with some interpreter's quirks until it halts,
+// then checks its screen against the ROM's expected image or text.
+// Without either, the test is unchecked, which isn't a pass: test ROMs
+// halt on their failure screens too.
+func RunTest(romPath string, maxCycles uint64, quirks arch.Quirks) (result Result) {
+	result = Result{Name: filepath.Base(romPath)}
+	c8 := arch.MakeChip8(false)
+	c8.Mute = true
+	c8.Quirks = quirks
+	var err error
+	defer func() {
+		if err != nil {
+			result.Passed = false
+			result.Detail = err.Error()
+		}
+		result.Cycles = c8.Cycle
+	}()
+	defer arch.CatchFault(&err)
+
+	if err = c8.LoadGame(romPath); err != nil {
+		return result
+	}
+	for !Halted(c8) {
+		if c8.Cycle >= maxCycles {
+			result.Detail = fmt.Sprintf("did not halt within %v cycles", maxCycles)
+			result.Text = ReadText(c8)
+			return result
+		}
+		c8.ExecuteCycle()
+	}
+	result.Text = ReadText(c8)
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+	if !hasExpectation(base) {
+		result.Unchecked = true
+		result.Detail = fmt.Sprintf("halted, but there is no %v or %v to check against",
+			filepath.Base(base+ImageExt), filepath.Base(base+TextExt))
+		return result
+	}
+	result.Passed, result.Detail = check(c8, base, result.Text)
+	return result
+}
+
+func hasExpectation(base string) bool {
+	for _, ext := range []string{ImageExt, TextExt} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks a halted machine against the expected output at base plus
+// ImageExt or TextExt.
+func check(c8 *arch.Chip8, base string, text string) (bool, string) {
+	if file, err := os.Open(base + ImageExt); err == nil {
+		defer file.Close()
+		expected, err := png.Decode(file)
+		if err != nil {
+			return false, fmt.Sprintf("could not read %v: %v", base+ImageExt, err)
+		}
+		if count := diffScreen(c8, expected); count > 0 {
+			return false, fmt.Sprintf("%v pixels differ from %v", count, filepath.Base(base+ImageExt))
+		}
+		return true, "matches " + filepath.Base(base+ImageExt)
+	}
+
+	if data, err := os.ReadFile(base + TextExt); err == nil {
+		if expected := strings.TrimSpace(string(data)); expected != text {
+			return false, fmt.Sprintf("screen says %q, expected %q", text, expected)
+		}
+		return true, "matches " + filepath.Base(base+TextExt)
+	}
+	return false, "no expected screen"
+}
+
+// Counts pixels that differ between the screen and an image of it.
+func diffScreen(c8 *arch.Chip8, expected image.Image) int {
+	if expected.Bounds() != image.Rect(0, 0, arch.ScreenWidth, arch.ScreenHeight) {
+		return arch.ScreenWidth * arch.ScreenHeight
+	}
+	count := 0
+	for y := 0; y < arch.ScreenHeight; y++ {
+		for x := 0; x < arch.ScreenWidth; x++ {
+			want := color.GrayModel.Convert(expected.At(x, y)).(color.Gray).Y > 127
+			if want != c8.Screen.GetPixel(uint16(x), uint16(y)) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// PrintTable prints a line for each result, then a summary.
+func PrintTable(w io.Writer, results []Result) {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "TEST\tRESULT\tCYCLES\tDETAIL\n")
+	passed, unchecked := 0, 0
+	for _, result := range results {
+		outcome := "FAIL"
+		if result.Passed {
+			outcome = "pass"
+			passed++
+		} else if result.Unchecked {
+			outcome = "unchecked"
+			unchecked++
+		}
+		detail := result.Detail
+		if result.Text != "" && !strings.HasPrefix(detail, "screen says") {
+			detail += fmt.Sprintf(" (screen says %q)", result.Text)
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\n", result.Name, outcome, result.Cycles, detail)
+	}
+	table.Flush()
+	fmt.Fprintf(w, "%v of %v tests passed", passed, len(results))
+	if unchecked > 0 {
+		fmt.Fprintf(w, ", and %v could not be checked", unchecked)
+	}
+	fmt.Fprintf(w, ".\n")
+}
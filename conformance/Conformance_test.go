@@ -0,0 +1,116 @@
+package conformance
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"jugonz/chip8/arch"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a test ROM to a temporary directory, returning its path.
+func writeROM(t *testing.T, program []uint16) string {
+	rom := []byte{}
+	for _, op := range program {
+		rom = append(rom, uint8(op>>8), uint8(op))
+	}
+	romPath := filepath.Join(t.TempDir(), "test.ch8")
+	os.WriteFile(romPath, rom, 0644)
+	return romPath
+}
+
+// Draws "1A" on one line and "7 7" on the next, then halts.
+var textProgram = []uint16{
+	0x6001, // 200: V0 = 1.
+	0x610A, // 202: V1 = A.
+	0xF029, // 204: I = glyph for V0.
+	0x6205, // 206: x = 5.
+	0x6302, // 208: y = 2.
+	0xD235, // 20A: Draw.
+	0xF129, // 20C: I = glyph for V1.
+	0x620A, // 20E: x = 10.
+	0xD235, // 210: Draw.
+	0x6007, // 212: V0 = 7.
+	0xF029, // 214: I = glyph for V0.
+	0x6205, // 216: x = 5.
+	0x630A, // 218: y = 10.
+	0xD235, // 21A: Draw.
+	0x6214, // 21C: x = 20.
+	0xD235, // 21E: Draw.
+	0x1220, // 220: Halt.
+}
+
+func TestReadText(t *testing.T) {
+	romPath := writeROM(t, textProgram)
+	result := RunTest(romPath, DefaultMaxCycles, arch.Quirks{})
+	if result.Passed || !result.Unchecked || result.Cycles != 16 {
+		t.Errorf("Test ROM gave %+v\n", result)
+	}
+	if result.Text != "1A\n7 7" {
+		t.Errorf("Screen was read as %q\n", result.Text)
+	}
+}
+
+func TestExpectations(t *testing.T) {
+	romPath := writeROM(t, textProgram)
+	base := strings.TrimSuffix(romPath, ".ch8")
+
+	os.WriteFile(base+TextExt, []byte("1A\n7 8\n"), 0644)
+	if result := RunTest(romPath, DefaultMaxCycles, arch.Quirks{}); result.Passed || !strings.Contains(result.Detail, "expected") {
+		t.Errorf("Wrong text gave %+v\n", result)
+	}
+	os.WriteFile(base+TextExt, []byte("1A\n7 7\n"), 0644)
+	if result := RunTest(romPath, DefaultMaxCycles, arch.Quirks{}); !result.Passed {
+		t.Errorf("Right text gave %+v\n", result)
+	}
+
+	// Images take precedence over text.
+	img := image.NewGray(image.Rect(0, 0, 64, 32))
+	img.SetGray(0, 0, color.Gray{255})
+	file, _ := os.Create(base + ImageExt)
+	png.Encode(file, img)
+	file.Close()
+	if result := RunTest(romPath, DefaultMaxCycles, arch.Quirks{}); result.Passed || !strings.HasPrefix(result.Detail, "39 pixels differ") {
+		t.Errorf("Wrong image gave %+v\n", result)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	if result := RunTest(writeROM(t, []uint16{0x1202, 0x1200}), 1000, arch.Quirks{}); result.Passed || result.Cycles != 1000 {
+		t.Errorf("ROM that never halts gave %+v\n", result)
+	}
+	if result := RunTest(writeROM(t, []uint16{0x0123}), 1000, arch.Quirks{}); result.Passed || result.Detail == "" {
+		t.Errorf("ROM that crashes gave %+v\n", result)
+	}
+	if result := RunTest(filepath.Join(t.TempDir(), "missing.ch8"), 1000, arch.Quirks{}); result.Passed {
+		t.Errorf("Missing ROM gave %+v\n", result)
+	}
+}
+
+func TestQuirks(t *testing.T) {
+	// V0 = 1, V1 = 3, V0 = V1 >> 1 (or V0 >> 1), then show V0 and halt.
+	program := []uint16{0x6001, 0x6103, 0x8016, 0xF029, 0x6205, 0xD225, 0x120C}
+	romPath := writeROM(t, program)
+	os.WriteFile(strings.TrimSuffix(romPath, ".ch8")+TextExt, []byte("1"), 0644)
+
+	vip := arch.QuirkProfiles["vip"]
+	if result := RunTest(romPath, 1000, vip); !result.Passed {
+		t.Errorf("Shifting VY gave %+v\n", result)
+	}
+	schip := arch.QuirkProfiles["schip"]
+	if result := RunTest(romPath, 1000, schip); result.Passed || result.Text != "0" {
+		t.Errorf("Shifting VX gave %+v\n", result)
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	out := &strings.Builder{}
+	PrintTable(out, []Result{{Name: "a", Passed: true}, {Name: "b", Unchecked: true}, {Name: "c"}})
+	if !strings.Contains(out.String(), "b     unchecked") ||
+		!strings.HasSuffix(out.String(), "1 of 3 tests passed, and 1 could not be checked.\n") {
+		t.Errorf("Table was:\n%v\n", out.String())
+	}
+}
@@ -0,0 +1,105 @@
+package conformance
+
+import (
+	"jugonz/chip8/arch"
+	"sort"
+	"strings"
+)
+
+// Glyph sizes in the built-in font.
+const (
+	glyphWidth  = 4
+	glyphHeight = 5
+)
+
+// A glyph found on the screen.
+type glyph struct {
+	X, Y int
+	Char byte
+}
+
+// ReadText finds characters of the built-in font on the screen, and
+// returns them as lines of text from top to bottom. A glyph only counts
+// if nothing else is lit right next to it, so sprites that happen to
+// contain a glyph's shape aren't read as text. Gaps wider than a
+// glyph become spaces.
+func ReadText(c8 *arch.Chip8) string {
+	lit := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= arch.ScreenWidth || y >= arch.ScreenHeight {
+			return false
+		}
+		return c8.Screen.GetPixel(uint16(x), uint16(y))
+	}
+
+	found := []glyph{}
+	for y := 0; y+glyphHeight <= arch.ScreenHeight; y++ {
+		for x := 0; x+glyphWidth <= arch.ScreenWidth; x++ {
+			if char, ok := matchGlyph(c8, lit, x, y); ok {
+				found = append(found, glyph{x, y, char})
+			}
+		}
+	}
+
+	// Group glyphs into lines, allowing for text that isn't quite level.
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Y != found[j].Y {
+			return found[i].Y < found[j].Y
+		}
+		return found[i].X < found[j].X
+	})
+	lines := [][]glyph{}
+	for _, g := range found {
+		last := len(lines) - 1
+		if last >= 0 && g.Y-lines[last][0].Y < glyphHeight {
+			lines[last] = append(lines[last], g)
+		} else {
+			lines = append(lines, []glyph{g})
+		}
+	}
+
+	text := []string{}
+	for _, line := range lines {
+		sort.Slice(line, func(i, j int) bool { return line[i].X < line[j].X })
+		row := strings.Builder{}
+		for index, g := range line {
+			if index > 0 && g.X-line[index-1].X > 2*glyphWidth+1 {
+				row.WriteByte(' ')
+			}
+			row.WriteByte(g.Char)
+		}
+		text = append(text, row.String())
+	}
+	return strings.Join(text, "\n")
+}
+
+// Checks for a glyph with its top left corner at x, y.
+func matchGlyph(c8 *arch.Chip8, lit func(x, y int) bool, x, y int) (byte, bool) {
+	// Nothing may be lit in the border around the glyph.
+	for dx := -1; dx <= glyphWidth; dx++ {
+		if lit(x+dx, y-1) || lit(x+dx, y+glyphHeight) {
+			return 0, false
+		}
+	}
+	for dy := 0; dy < glyphHeight; dy++ {
+		if lit(x-1, y+dy) || lit(x+glyphWidth, y+dy) {
+			return 0, false
+		}
+	}
+
+	for char := 0; char < 16; char++ {
+		matches := true
+		for dy := 0; dy < glyphHeight && matches; dy++ {
+			row := c8.Fontset[char*glyphHeight+dy]
+			for dx := 0; dx < glyphWidth; dx++ {
+				if lit(x+dx, y+dy) != (row&(0x80>>dx) != 0) {
+					matches = false
+					break
+				}
+			}
+		}
+		if matches {
+			return "0123456789ABCDEF"[char], true
+		}
+	}
+	return 0, false
+}
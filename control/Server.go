@@ -0,0 +1,584 @@
+// Package control lets scripts drive a running Chip8 over a socket, using
+// JSON-RPC 2.0 with one message per line. Every method runs between
+// cycles through Chip8.Do, so it never races with the Run loop.
+//
+// For example, from a shell:
+//
+//	echo '{"jsonrpc":"2.0","id":1,"method":"step","params":{"cycles":10}}' | nc localhost 6502
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"jugonz/chip8/arch"
+	"jugonz/chip8/gfx"
+	"net"
+	"os"
+	"strings"
+)
+
+/**
+ * Datatype to describe a control server for one Chip8. Any number of
+ * clients may be connected at once.
+ */
+type Server struct {
+	C8 *arch.Chip8
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"` // Missing for notifications, which get no response.
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+/**
+ * Datatype to describe a JSON-RPC error.
+ */
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes from the JSON-RPC specification.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	ServerError    = -32000 // For anything that went wrong running a method.
+)
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func invalidParams(format string, args ...any) *Error {
+	return &Error{InvalidParams, fmt.Sprintf(format, args...)}
+}
+
+// A method decodes its own params and returns a result for the client.
+type method func(s *Server, params json.RawMessage) (any, error)
+
+var methods = map[string]method{
+	"status":         status,
+	"pause":          pause,
+	"resume":         resume,
+	"advanceFrame":   advanceFrame,
+	"setSpeed":       setSpeed,
+	"step":           step,
+	"readMemory":     readMemory,
+	"writeMemory":    writeMemory,
+	"getRegisters":   getRegisters,
+	"setRegisters":   setRegisters,
+	"pressKey":       pressKey,
+	"releaseKey":     releaseKey,
+	"getFramebuffer": getFramebuffer,
+	"screenshot":     screenshot,
+	"saveState":      saveState,
+	"loadState":      loadState,
+	"loadRom":        loadRom,
+}
+
+func MakeServer(c8 *arch.Chip8) *Server {
+	return &Server{c8}
+}
+
+// Listen listens on a Unix socket if addr starts with "unix:",
+// or on TCP otherwise.
+func Listen(addr string) (net.Listener, error) {
+	if path, found := strings.CutPrefix(addr, "unix:"); found {
+		os.Remove(path) // A socket left over from before can't be reused.
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Serve accepts clients until the listener is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn answers requests from a single client until it disconnects.
+func (s *Server) ServeConn(conn io.ReadWriter) error {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, 1<<20) // States are sent whole.
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		reply := s.handle([]byte(line))
+		if reply == nil {
+			continue
+		}
+		if err := encoder.Encode(reply); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Handles a request, returning nil if it was a notification.
+func (s *Server) handle(line []byte) *response {
+	req := request{}
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &response{Version: "2.0", ID: json.RawMessage("null"),
+			Error: &Error{ParseError, err.Error()}}
+	}
+	reply := &response{Version: "2.0", ID: req.ID}
+	if req.ID == nil {
+		reply.ID = json.RawMessage("null")
+	}
+
+	m, found := methods[req.Method]
+	switch {
+	case req.Version != "2.0" || req.Method == "":
+		reply.Error = &Error{InvalidRequest, "not a JSON-RPC 2.0 request"}
+	case !found:
+		reply.Error = &Error{MethodNotFound, fmt.Sprintf("there is no method %q", req.Method)}
+	default:
+		result, err := m(s, req.Params)
+		if rpcErr, ok := err.(*Error); ok {
+			reply.Error = rpcErr
+		} else if err != nil {
+			reply.Error = &Error{ServerError, err.Error()}
+		} else if result == nil {
+			result = true // A result is required, even if there's nothing to say.
+		}
+		reply.Result = result
+	}
+
+	// Notifications never get a response, even if they fail.
+	if req.ID == nil && (reply.Error == nil || reply.Error.Code != InvalidRequest) {
+		return nil
+	}
+	return reply
+}
+
+// Decodes params into v, which holds the defaults for anything missing.
+func decode(params json.RawMessage, v any) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return invalidParams("%v", err)
+	}
+	return nil
+}
+
+// The state of the machine, returned by methods that change it.
+type Status struct {
+	Paused bool    `json:"paused"`
+	Cycle  uint64  `json:"cycle"`
+	PC     uint16  `json:"pc"`
+	Speed  float64 `json:"speed"`           // Multiple of normal speed while running.
+	Fault  string  `json:"fault,omitempty"` // Why the machine paused, if the game faulted.
+}
+
+func makeStatus(c8 *arch.Chip8) Status {
+	status := Status{c8.Paused, c8.Cycle, c8.PC, c8.Speed(), ""}
+	if c8.Fault != nil {
+		status.Fault = c8.Fault.Error()
+	}
+	return status
+}
+
+func status(s *Server, params json.RawMessage) (any, error) {
+	result := Status{}
+	s.C8.Do(func(c8 *arch.Chip8) { result = makeStatus(c8) })
+	return result, nil
+}
+
+func pause(s *Server, params json.RawMessage) (any, error) {
+	result := Status{}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		c8.Paused = true
+		result = makeStatus(c8)
+	})
+	return result, nil
+}
+
+func resume(s *Server, params json.RawMessage) (any, error) {
+	result := Status{}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		c8.Paused = false
+		result = makeStatus(c8)
+	})
+	return result, nil
+}
+
+// Pauses, or emulates one frame if already paused.
+func advanceFrame(s *Server, params json.RawMessage) (any, error) {
+	result := Status{}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		c8.AdvanceFrame()
+		result = makeStatus(c8)
+	})
+	return result, nil
+}
+
+// Turns fast-forward or slow motion on or off, and sets the fast-forward
+// multiple. Settings that are left out stay as they are.
+func setSpeed(s *Server, params json.RawMessage) (any, error) {
+	p := struct {
+		FastForward      *bool    `json:"fastForward"`
+		FastForwardSpeed *float64 `json:"fastForwardSpeed"`
+		SlowMotion       *bool    `json:"slowMotion"`
+	}{}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.FastForwardSpeed != nil && *p.FastForwardSpeed <= 0 {
+		return nil, invalidParams("fast-forward speed must be positive, not %v", *p.FastForwardSpeed)
+	}
+
+	result := Status{}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		if p.FastForward != nil {
+			c8.FastForwarding = *p.FastForward
+		}
+		if p.FastForwardSpeed != nil {
+			c8.FastForward = *p.FastForwardSpeed
+		}
+		if p.SlowMotion != nil {
+			c8.SlowMotion = *p.SlowMotion
+		}
+		result = makeStatus(c8)
+	})
+	return result, nil
+}
+
+// Most cycles a single step can ask for, so that one request can't hold
+// up the emulator for long. It's about a minute and a half of emulation.
+const MaxStepCycles = 1000000
+
+// Pauses, then emulates a number of cycles (1 by default). A fault stops
+// the step early, and is returned as the error.
+func step(s *Server, params json.RawMessage) (any, error) {
+	p := struct {
+		Cycles int `json:"cycles"`
+	}{1}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Cycles < 0 || p.Cycles > MaxStepCycles {
+		return nil, invalidParams("can't step %v cycles (at most %v at a time)", p.Cycles, MaxStepCycles)
+	}
+
+	result := Status{}
+	var err error
+	s.C8.Do(func(c8 *arch.Chip8) {
+		defer c8.DrawScreen()
+		defer arch.CatchFault(&err)
+		c8.Paused = true
+		for cycle := 0; cycle < p.Cycles; cycle++ {
+			c8.ExecuteCycle()
+		}
+		result = makeStatus(c8)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Checks that a span of memory exists.
+func checkMemory(c8 *arch.Chip8, addr, length int) error {
+	if addr < 0 || length < 0 || addr+length > len(c8.Memory) {
+		return invalidParams("%v bytes at 0x%X are not all in memory", length, addr)
+	}
+	return nil
+}
+
+// Memory is sent as a string of hex digits.
+func readMemory(s *Server, params json.RawMessage) (any, error) {
+	p := struct {
+		Address int `json:"address"`
+		Length  int `json:"length"`
+	}{Length: 1}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if err := checkMemory(s.C8, p.Address, p.Length); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, p.Length)
+	s.C8.Do(func(c8 *arch.Chip8) { copy(data, c8.Memory[p.Address:]) })
+	return map[string]string{"data": hex.EncodeToString(data)}, nil
+}
+
+func writeMemory(s *Server, params json.RawMessage) (any, error) {
+	p := struct {
+		Address int    `json:"address"`
+		Data    string `json:"data"`
+	}{}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(p.Data)
+	if err != nil {
+		return nil, invalidParams("data is not hex: %v", err)
+	}
+	if err := checkMemory(s.C8, p.Address, len(data)); err != nil {
+		return nil, err
+	}
+
+	s.C8.Do(func(c8 *arch.Chip8) {
+		copy(c8.Memory[p.Address:], data)
+		diverge(c8)
+	})
+	return nil, nil
+}
+
+// Called after changing the machine from outside the program.
+func diverge(c8 *arch.Chip8) {
+	if c8.History != nil {
+		c8.History.Diverge(c8)
+	}
+}
+
+/**
+ * Datatype to describe the registers, as sent to clients.
+ */
+type Registers struct {
+	V     [16]uint8  `json:"v"`
+	I     uint16     `json:"i"`
+	PC    uint16     `json:"pc"`
+	SP    uint16     `json:"sp"`
+	DT    uint8      `json:"dt"`
+	ST    uint8      `json:"st"`
+	Stack [16]uint16 `json:"stack"`
+}
+
+func getRegisters(s *Server, params json.RawMessage) (any, error) {
+	regs := Registers{}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		regs = Registers{c8.Registers, c8.IndexReg, c8.PC, c8.SP,
+			c8.DelayTimer, c8.SoundTimer, c8.Stack}
+	})
+	return regs, nil
+}
+
+// Sets registers by name, like {"V3": 5, "I": 768, "PC": 512}.
+func setRegisters(s *Server, params json.RawMessage) (any, error) {
+	values := map[string]uint16{}
+	if err := decode(params, &values); err != nil {
+		return nil, err
+	}
+	locs := map[string]arch.Location{}
+	for name, value := range values {
+		switch strings.ToUpper(name) {
+		case "PC":
+			if int(value)+1 >= len(s.C8.Memory) {
+				return nil, invalidParams("PC must be at most 0x%X", len(s.C8.Memory)-2)
+			}
+		case "SP":
+			if int(value) > len(s.C8.Stack) {
+				return nil, invalidParams("SP must be at most %v", len(s.C8.Stack))
+			}
+		default:
+			loc, err := arch.ParseLocation(name)
+			if err != nil || loc.Kind == arch.LocMemory {
+				return nil, invalidParams("%q is not a register", name)
+			}
+			locs[name] = loc
+		}
+	}
+
+	s.C8.Do(func(c8 *arch.Chip8) {
+		for name, value := range values {
+			switch strings.ToUpper(name) {
+			case "PC":
+				c8.PC = value
+			case "SP":
+				c8.SP = value
+			default:
+				c8.Set(locs[name], value)
+			}
+		}
+		diverge(c8)
+	})
+	return nil, nil
+}
+
+type keyParams struct {
+	Key *int `json:"key"`
+}
+
+// Keys stay held down until they are released.
+func pressKey(s *Server, params json.RawMessage) (any, error) {
+	return nil, setKey(s, params, true)
+}
+
+func releaseKey(s *Server, params json.RawMessage) (any, error) {
+	return nil, setKey(s, params, false)
+}
+
+func setKey(s *Server, params json.RawMessage, held bool) error {
+	p := keyParams{}
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	if p.Key == nil || *p.Key < 0 || *p.Key > 0xF {
+		return invalidParams("key must be from 0 to 15")
+	}
+	s.C8.Do(func(c8 *arch.Chip8) { c8.HeldKeys[*p.Key] = held })
+	return nil
+}
+
+// The framebuffer is sent as rows of '0' and '1' characters.
+func getFramebuffer(s *Server, params json.RawMessage) (any, error) {
+	rows := make([]string, arch.ScreenHeight)
+	s.C8.Do(func(c8 *arch.Chip8) {
+		for y := range rows {
+			row := make([]byte, arch.ScreenWidth)
+			for x := range row {
+				row[x] = '0'
+				if c8.Screen.GetPixel(uint16(x), uint16(y)) {
+					row[x] = '1'
+				}
+			}
+			rows[y] = string(row)
+		}
+	})
+	return map[string]any{"width": arch.ScreenWidth, "height": arch.ScreenHeight, "rows": rows}, nil
+}
+
+// Returns a PNG of the screen as it's shown, in its palette, scaled up
+// by a whole factor (1 by default) with a scaler (nearest by default).
+func screenshot(s *Server, params json.RawMessage) (any, error) {
+	p := struct {
+		Path   string `json:"path"` // Saved to this file, if given.
+		Scale  int    `json:"scale"`
+		Scaler string `json:"scaler"`
+	}{Scale: 1, Scaler: "nearest"}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Scale < 1 || p.Scale > maxScreenshotScale {
+		return nil, invalidParams("scale must be from 1 to %v, not %v", maxScreenshotScale, p.Scale)
+	}
+	scaler, err := gfx.ParseScaler(p.Scaler)
+	if err != nil {
+		return nil, invalidParams("%v", err)
+	}
+	var img *image.RGBA
+	s.C8.Do(func(c8 *arch.Chip8) {
+		if imager, ok := c8.Screen.(gfx.Imager); ok {
+			img = imager.Image()
+		}
+	})
+	if img == nil {
+		return nil, errors.New("this screen can't take screenshots")
+	}
+	data := bytes.Buffer{}
+	png.Encode(&data, scaler.Upscale(img, p.Scale))
+
+	if p.Path != "" {
+		return nil, os.WriteFile(p.Path, data.Bytes(), 0644)
+	}
+	return map[string]string{"png": base64.StdEncoding.EncodeToString(data.Bytes())}, nil
+}
+
+// Large enough to fill a 4K display.
+const maxScreenshotScale = 64
+
+type stateParams struct {
+	Path  string `json:"path"`  // Saved to or loaded from this file, if given.
+	State string `json:"state"` // Otherwise, sent in base64.
+}
+
+func saveState(s *Server, params json.RawMessage) (any, error) {
+	p := stateParams{}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	state := arch.State{}
+	s.C8.Do(func(c8 *arch.Chip8) { state = c8.SaveState() })
+	data, _ := state.MarshalBinary()
+
+	if p.Path != "" {
+		return nil, os.WriteFile(p.Path, data, 0644)
+	}
+	return map[string]string{"state": base64.StdEncoding.EncodeToString(data)}, nil
+}
+
+func loadState(s *Server, params json.RawMessage) (any, error) {
+	p := stateParams{}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	var data []byte
+	var err error
+	if p.Path != "" {
+		data, err = os.ReadFile(p.Path)
+	} else if data, err = base64.StdEncoding.DecodeString(p.State); err != nil {
+		return nil, invalidParams("state is not base64: %v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := arch.State{}
+	if err := state.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		c8.LoadState(state)
+		if c8.History != nil {
+			c8.History.Reset()
+		}
+	})
+	return nil, nil
+}
+
+// Resets the machine and loads a new game, keeping it paused if it was.
+func loadRom(s *Server, params json.RawMessage) (any, error) {
+	p := struct {
+		Path string `json:"path"`
+	}{}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Path == "" {
+		return nil, invalidParams("no ROM path given")
+	}
+
+	// Read the game first, so that a bad one leaves the old game running.
+	rom, err := arch.ReadGame(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		c8.Reset()
+		err = c8.LoadROM(rom)
+	})
+	return nil, err
+}
@@ -0,0 +1,262 @@
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"jugonz/chip8/arch"
+	"jugonz/chip8/archtest"
+	"jugonz/chip8/gfx"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A minimal script, for talking to the server over a pipe.
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	id     int
+}
+
+// Calls a method and decodes its result into result, returning any error.
+func (c *client) call(method string, params any, result any) *Error {
+	c.t.Helper()
+	c.id++
+	data, _ := json.Marshal(params)
+	fmt.Fprintf(c.conn, `{"jsonrpc":"2.0","id":%v,"method":%q,"params":%s}`+"\n", c.id, method, data)
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatalf("No response to %v! Error was: %v\n", method, err)
+	}
+	reply := struct {
+		ID     int
+		Result json.RawMessage
+		Error  *Error
+	}{}
+	json.Unmarshal(line, &reply)
+	if reply.ID != c.id {
+		c.t.Fatalf("Response to %v had id %v, expected %v\n", method, reply.ID, c.id)
+	}
+	if reply.Error == nil && result != nil {
+		json.Unmarshal(reply.Result, result)
+	}
+	return reply.Error
+}
+
+// Calls a method that must succeed.
+func (c *client) must(method string, params any, result any) {
+	c.t.Helper()
+	if err := c.call(method, params, result); err != nil {
+		c.t.Fatalf("%v failed: %v\n", method, err.Message)
+	}
+}
+
+// Starts a server for a Chip8 that runs in the background like Run does,
+// and connects a client to it.
+func startServer(t *testing.T, program []uint16) (*arch.Chip8, *client) {
+	c8 := arch.MakeChip8(false)
+	archtest.Load(c8, program)
+	c8.Paused = true
+	archtest.Run(t, c8)
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	go MakeServer(c8).ServeConn(serverConn)
+	return c8, &client{t: t, conn: clientConn, reader: bufio.NewReader(clientConn)}
+}
+
+func TestStepKeysAndFramebuffer(t *testing.T) {
+	_, c := startServer(t, []uint16{
+		0xA20A, // 200: Point I at the sprite.
+		0xD011, // 202: Draw it at V0, V1.
+		0xE09E, // 204: Skip the loop if key V0 is pressed.
+		0x1204, // 206: Loop.
+		0x1208, // 208: Done.
+		0xF000, // 20A: Sprite.
+	})
+
+	status := Status{}
+	c.must("step", map[string]int{"cycles": 3}, &status)
+	if !status.Paused || status.Cycle != 3 || status.PC != 0x206 {
+		t.Errorf("Status after 3 cycles was %+v\n", status)
+	}
+	screen := struct {
+		Width, Height int
+		Rows          []string
+	}{}
+	c.must("getFramebuffer", nil, &screen)
+	if screen.Width != 64 || len(screen.Rows) != 32 || screen.Rows[0] != "1111"+strings.Repeat("0", 60) {
+		t.Errorf("Framebuffer was %v by %v, starting %q\n", screen.Width, screen.Height, screen.Rows[0])
+	}
+
+	c.must("pressKey", map[string]int{"key": 0}, nil)
+	c.must("step", map[string]int{"cycles": 2}, &status)
+	if status.PC != 0x208 {
+		t.Errorf("Key press was not seen, PC is %03X\n", status.PC)
+	}
+	if err := c.call("pressKey", map[string]int{"key": 16}, nil); err == nil || err.Code != InvalidParams {
+		t.Errorf("Pressing key 16 gave %+v\n", err)
+	}
+	c.must("resume", nil, &status)
+	if status.Paused {
+		t.Errorf("Still paused after resuming\n")
+	}
+}
+
+func TestSpeed(t *testing.T) {
+	c8, c := startServer(t, []uint16{0x1200})
+
+	status := Status{}
+	c.must("setSpeed", map[string]any{"fastForward": true, "fastForwardSpeed": 8}, &status)
+	if status.Speed != 8 {
+		t.Errorf("Speed while fast-forwarding was %v\n", status.Speed)
+	}
+	c.must("setSpeed", map[string]bool{"fastForward": false, "slowMotion": true}, &status)
+	if status.Speed != arch.SlowMotionSpeed || c8.FastForward != 8 {
+		t.Errorf("Speed in slow motion was %v\n", status.Speed)
+	}
+	if err := c.call("setSpeed", map[string]int{"fastForwardSpeed": 0}, nil); err == nil || err.Code != InvalidParams {
+		t.Errorf("Setting a speed of 0 gave %+v\n", err)
+	}
+
+	c.must("advanceFrame", nil, &status) // Already paused, so this runs a frame.
+	c.must("advanceFrame", nil, &status)
+	if !status.Paused || status.Cycle != 2*uint64(c8.CyclesPerFrame()) {
+		t.Errorf("Status after advancing a frame was %+v\n", status)
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	c8, c := startServer(t, []uint16{0x1200})
+	c8.Screen.XorPixel(1, 0)
+	c8.Screen.(*gfx.Headless).Palette = gfx.Palettes["amber"]
+
+	shot := map[string]string{}
+	c.must("screenshot", nil, &shot)
+	data, _ := base64.StdEncoding.DecodeString(shot["png"])
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Screenshot was not a PNG! Error was: %v\n", err)
+	}
+	if img.Bounds().Dx() != 64 || img.At(0, 0) != gfx.Palettes["amber"][0] || img.At(1, 0) != gfx.Palettes["amber"][1] {
+		t.Errorf("Screenshot was %v, with pixels %v and %v\n", img.Bounds(), img.At(0, 0), img.At(1, 0))
+	}
+
+	c.must("screenshot", map[string]any{"scale": 4, "scaler": "epx"}, &shot)
+	data, _ = base64.StdEncoding.DecodeString(shot["png"])
+	if img, _ := png.Decode(bytes.NewReader(data)); img == nil || img.Bounds().Dx() != 256 {
+		t.Errorf("Scaled screenshot was not 256 pixels wide\n")
+	}
+	if err := c.call("screenshot", map[string]string{"scaler": "blurry"}, nil); err == nil || err.Code != InvalidParams {
+		t.Errorf("Taking a screenshot with an unknown scaler gave %+v\n", err)
+	}
+}
+
+func TestRegistersMemoryAndStates(t *testing.T) {
+	c8, c := startServer(t, []uint16{0x1200})
+
+	c.must("setRegisters", map[string]int{"V3": 5, "I": 0x300, "pc": 0x202}, nil)
+	regs := Registers{}
+	c.must("getRegisters", nil, &regs)
+	if regs.V[3] != 5 || regs.I != 0x300 || regs.PC != 0x202 {
+		t.Errorf("Registers were %+v\n", regs)
+	}
+	for _, bad := range []map[string]int{{"300": 1}, {"PC": 0xFFF}, {"SP": 17}} {
+		if err := c.call("setRegisters", bad, nil); err == nil || err.Code != InvalidParams {
+			t.Errorf("Setting %v gave %+v\n", bad, err)
+		}
+	}
+
+	c.must("writeMemory", map[string]any{"address": 0x300, "data": "a1b2"}, nil)
+	state := map[string]string{}
+	c.must("saveState", nil, &state)
+	c.must("writeMemory", map[string]any{"address": 0x300, "data": "0000"}, nil)
+	c.must("loadState", state, nil)
+	memory := map[string]string{}
+	c.must("readMemory", map[string]int{"address": 0x2FF, "length": 4}, &memory)
+	if memory["data"] != "00a1b200" {
+		t.Errorf("Memory after loading a state was %v\n", memory["data"])
+	}
+	if err := c.call("readMemory", map[string]int{"address": 0xFFF, "length": 2}, nil); err == nil {
+		t.Errorf("Reading past the end of memory should fail\n")
+	}
+
+	romPath := filepath.Join(t.TempDir(), "test.ch8")
+	os.WriteFile(romPath, []byte{0x6A, 0x42}, 0644)
+	bigPath := filepath.Join(t.TempDir(), "big.ch8")
+	os.WriteFile(bigPath, make([]byte, arch.MaxROMSize+1), 0644)
+	for _, path := range []string{romPath + ".missing", bigPath} {
+		if err := c.call("loadRom", map[string]string{"path": path}, nil); err == nil || err.Code != ServerError {
+			t.Errorf("Loading %v gave %+v\n", filepath.Base(path), err)
+		}
+	}
+	c.must("getRegisters", nil, &regs)
+	if regs.V[3] != 5 {
+		t.Errorf("Failing to load a ROM reset the machine: %+v\n", regs)
+	}
+
+	coverage := arch.MakeCoverage()
+	c8.Do(func(c8 *arch.Chip8) {
+		c8.Coverage = coverage
+		c8.Coverage.Mark(0x200, arch.CoverExecuted)
+		c8.Cheats = arch.MakeCheats()
+		c8.Cheats.Freeze(arch.Location{Kind: arch.LocMemory, Addr: 0x300}, 1)
+	})
+	c.must("loadRom", map[string]string{"path": romPath}, nil)
+	c.must("getRegisters", nil, &regs)
+	if regs.V[3] != 0 || regs.PC != 0x200 || c8.RomSize != 2 {
+		t.Errorf("Loading a ROM did not reset the machine: %+v\n", regs)
+	}
+	c8.Do(func(c8 *arch.Chip8) {
+		if c8.Coverage == coverage || c8.Coverage.Flags[0x200] != 0 || c8.Cheats.Active() {
+			t.Errorf("Loading a ROM kept the old game's coverage or cheats\n")
+		}
+	})
+}
+
+func TestProtocolErrors(t *testing.T) {
+	_, c := startServer(t, []uint16{0x1200})
+
+	// Notifications get no response, so the next response is for the call.
+	fmt.Fprintf(c.conn, `{"jsonrpc":"2.0","method":"pause"}`+"\n")
+	if err := c.call("frobnicate", nil, nil); err == nil || err.Code != MethodNotFound {
+		t.Errorf("Calling an unknown method gave %+v\n", err)
+	}
+	if err := c.call("step", map[string]int{"cycles": -1}, nil); err == nil || err.Code != InvalidParams {
+		t.Errorf("Stepping backwards gave %+v\n", err)
+	}
+	if err := c.call("step", []int{1}, nil); err == nil || err.Code != InvalidParams {
+		t.Errorf("Positional params gave %+v\n", err)
+	}
+	if err := c.call("step", map[string]int{"cycles": MaxStepCycles + 1}, nil); err == nil || err.Code != InvalidParams {
+		t.Errorf("Stepping too far gave %+v\n", err)
+	}
+}
+
+func TestStepFault(t *testing.T) {
+	_, c := startServer(t, []uint16{0x6001, 0x0123})
+	err := c.call("step", map[string]int{"cycles": 5}, nil)
+	if err == nil || err.Code != ServerError || !strings.Contains(err.Message, "Unimplemented") {
+		t.Errorf("Stepping into machine code gave %+v\n", err)
+	}
+	status := Status{}
+	c.must("status", nil, &status) // Still running.
+
+	c.must("resume", nil, &status)
+	for start := time.Now(); !status.Paused && time.Since(start) < 5*time.Second; {
+		c.must("status", nil, &status)
+	}
+	if !status.Paused || !strings.Contains(status.Fault, "Unimplemented") {
+		t.Errorf("Running into machine code gave %+v\n", status)
+	}
+}
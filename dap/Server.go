@@ -0,0 +1,642 @@
+// Package dap lets editors such as VS Code debug Chip8 programs through
+// the Debug Adapter Protocol, over stdio or a local socket. Breakpoints are
+// placed on source lines using an assembler's source map, or on lines of
+// the ROM's disassembly when it has none. Stepping, breakpoints and
+// expressions use the arch package's debugger, so they behave exactly as
+// they do in the debugger console.
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"jugonz/chip8/arch"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Datatype to describe a debug adapter for one Chip8. Everything that
+ * touches the machine goes through Chip8.Do, so it is safe while Run is
+ * emulating.
+ */
+type Server struct {
+	C8          *arch.Chip8
+	Debugger    *arch.Debugger
+	Source      *SourceMap
+	out         io.Writer
+	lock        sync.Mutex // Guards out and seq, since tracepoints print from Run.
+	seq         int
+	launched    bool
+	stopOnEntry bool
+	running     bool                // True while continuing, until the machine stops.
+	reason      string              // Why the machine will stop next, if known.
+	breakpoints map[string][]uint16 // Addresses of breakpoints set in each source.
+}
+
+// How often to check whether a running machine has stopped.
+const pollInterval = 10 * time.Millisecond
+
+// The disassembly is the only source that isn't a file.
+const disassemblyReference = 1
+
+// Protocol messages. Requests have a command and arguments,
+// responses have the rest, and events have an event and body.
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"` // Always sent in responses.
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       any             `json:"body,omitempty"`
+}
+
+// Fields of request arguments. Each request only uses a few.
+type arguments struct {
+	Program            string             `json:"program"`
+	SourceMap          string             `json:"sourceMap"`
+	StopOnEntry        bool               `json:"stopOnEntry"`
+	Source             source             `json:"source"`
+	Breakpoints        []sourceBreakpoint `json:"breakpoints"`
+	SourceReference    int                `json:"sourceReference"`
+	VariablesReference int                `json:"variablesReference"`
+	Name               string             `json:"name"`
+	Value              string             `json:"value"`
+	Expression         string             `json:"expression"`
+	MemoryReference    string             `json:"memoryReference"`
+	Offset             int                `json:"offset"`
+	Count              int                `json:"count"`
+	Data               string             `json:"data"`
+}
+
+type source struct {
+	Name            string `json:"name,omitempty"`
+	Path            string `json:"path,omitempty"`
+	SourceReference int    `json:"sourceReference,omitempty"`
+}
+
+type sourceBreakpoint struct {
+	Line         int    `json:"line"`
+	Condition    string `json:"condition"`
+	HitCondition string `json:"hitCondition"`
+	LogMessage   string `json:"logMessage"`
+}
+
+// MakeServer makes a debug adapter that controls c8 through its debugger,
+// creating one if there is none. It must be called before c8 starts running.
+func MakeServer(c8 *arch.Chip8) *Server {
+	s := Server{C8: c8}
+	if c8.Debugger == nil {
+		c8.Debugger = arch.MakeDebugger(nil, outputWriter{&s})
+	}
+	s.Debugger = c8.Debugger
+	s.breakpoints = make(map[string][]uint16)
+	return &s
+}
+
+// Sends anything the debugger prints, such as tracepoints, to the editor.
+type outputWriter struct {
+	s *Server
+}
+
+func (w outputWriter) Write(data []byte) (int, error) {
+	w.s.event("output", map[string]any{"category": "console", "output": string(data)})
+	return len(data), nil
+}
+
+// Serve talks to a single editor until it disconnects.
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.lock.Lock()
+	s.out = out
+	s.lock.Unlock()
+	requests := make(chan message)
+	errs := make(chan error, 1)
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			request, err := readMessage(reader)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case request := <-requests:
+			if quit := s.handle(request); quit {
+				return nil
+			}
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-poll.C:
+			if !s.running {
+				continue
+			}
+			paused := false
+			s.C8.Do(func(c8 *arch.Chip8) { paused = c8.Paused })
+			if paused {
+				s.stopped()
+			}
+		}
+	}
+}
+
+// Terminated tells the editor that the program has ended.
+func (s *Server) Terminated() {
+	s.event("terminated", nil)
+}
+
+func readMessage(reader *bufio.Reader) (message, error) {
+	length := -1
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return message{}, err
+		}
+		header = strings.TrimSpace(header)
+		if header == "" {
+			break
+		}
+		if name, value, found := strings.Cut(header, ":"); found && name == "Content-Length" {
+			length, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	if length < 0 {
+		return message{}, fmt.Errorf("message has no Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return message{}, err
+	}
+	msg := message{}
+	return msg, json.Unmarshal(body, &msg)
+}
+
+func (s *Server) send(msg message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.out == nil {
+		return // No editor has connected yet.
+	}
+	s.seq++
+	msg.Seq = s.seq
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(s.out, "Content-Length: %v\r\n\r\n%s", len(body), body)
+}
+
+func (s *Server) event(name string, body any) {
+	s.send(message{Type: "event", Event: name, Body: body})
+}
+
+// Handles a request, returning true if the session is over.
+func (s *Server) handle(request message) bool {
+	args := arguments{}
+	if len(request.Arguments) > 0 {
+		json.Unmarshal(request.Arguments, &args)
+	}
+	body, err := s.dispatch(request.Command, args)
+
+	success := err == nil
+	reply := message{Type: "response", RequestSeq: request.Seq, Command: request.Command,
+		Success: &success, Body: body}
+	if err != nil {
+		reply.Message = err.Error()
+	}
+	s.send(reply)
+
+	// Some requests are followed by events.
+	switch {
+	case err != nil:
+	case request.Command == "disconnect" || request.Command == "terminate":
+		s.Terminated()
+		return true
+	case request.Command == "launch":
+		s.event("initialized", nil)
+	case request.Command == "configurationDone" && s.stopOnEntry:
+		s.reason = "entry"
+		s.stopped()
+	case s.reason != "" && !s.running:
+		s.stopped() // Stepped without running.
+	}
+	return false
+}
+
+func (s *Server) dispatch(command string, args arguments) (any, error) {
+	c8 := s.C8
+	switch command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest":  true,
+			"supportsConditionalBreakpoints":    true,
+			"supportsHitConditionalBreakpoints": true,
+			"supportsLogPoints":                 true,
+			"supportsEvaluateForHovers":         true,
+			"supportsSetVariable":               true,
+			"supportsReadMemoryRequest":         true,
+			"supportsWriteMemoryRequest":        true,
+			"supportsTerminateRequest":          true,
+			"supportsStepBack":                  c8.History != nil,
+		}, nil
+	case "launch":
+		return nil, s.launch(args)
+	case "configurationDone":
+		if !s.launched {
+			return nil, fmt.Errorf("launch a program first")
+		}
+		if !s.stopOnEntry {
+			s.resume("")
+		}
+		return nil, nil
+	case "setBreakpoints":
+		return s.setBreakpoints(args)
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": 1, "name": "Chip8"}}}, nil
+	case "stackTrace":
+		frames := []map[string]any{}
+		c8.Do(func(c8 *arch.Chip8) { frames = s.stackTrace(c8) })
+		return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		return map[string]any{"scopes": []map[string]any{
+			{"name": "Registers", "variablesReference": 1, "expensive": false},
+			{"name": "Stack", "variablesReference": 2, "expensive": false},
+		}}, nil
+	case "variables":
+		variables := []map[string]any{}
+		c8.Do(func(c8 *arch.Chip8) { variables = s.variables(c8, args.VariablesReference) })
+		return map[string]any{"variables": variables}, nil
+	case "setVariable":
+		return s.setVariable(args)
+	case "evaluate":
+		expr, err := arch.ParseExpr(args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		value := 0
+		c8.Do(func(c8 *arch.Chip8) { value, err = expr.Eval(c8) })
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"result": fmt.Sprintf("%v (0x%X)", value, value), "variablesReference": 0}, nil
+	case "readMemory", "writeMemory":
+		return s.memory(command, args)
+	case "source":
+		if args.SourceReference != disassemblyReference {
+			return nil, fmt.Errorf("unknown source")
+		}
+		text := ""
+		c8.Do(func(c8 *arch.Chip8) { text = DisassemblyText(c8) })
+		return map[string]any{"content": text, "mimeType": "text/plain"}, nil
+	case "continue":
+		s.resume("")
+		return map[string]bool{"allThreadsContinued": true}, nil
+	case "next":
+		stepped, err := false, error(nil)
+		c8.Do(func(c8 *arch.Chip8) {
+			defer arch.CatchFault(&err)
+			stepped = s.Debugger.StepOver(c8)
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.reason, s.running = "step", !stepped
+		return nil, nil
+	case "stepIn":
+		var err error
+		c8.Do(func(c8 *arch.Chip8) {
+			defer arch.CatchFault(&err)
+			c8.Paused = true
+			c8.EmulateCycle()
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.reason = "step"
+		return nil, nil
+	case "stepOut":
+		var err error
+		c8.Do(func(c8 *arch.Chip8) { err = s.Debugger.StepOut(c8) })
+		if err == nil {
+			s.reason, s.running = "step", true
+		}
+		return nil, err
+	case "stepBack", "reverseContinue":
+		hit, err := true, error(nil)
+		c8.Do(func(c8 *arch.Chip8) {
+			if command == "stepBack" {
+				err = s.Debugger.ReverseStep(c8, 1)
+			} else {
+				hit, err = s.Debugger.ReverseContinue(c8)
+			}
+		})
+		if command == "stepBack" || !hit {
+			s.reason = "step"
+		} else {
+			s.reason = s.stopReason()
+		}
+		s.running = false
+		return nil, err
+	case "pause":
+		c8.Do(func(c8 *arch.Chip8) { c8.Paused = true })
+		s.reason = "pause"
+		return nil, nil
+	case "disconnect", "terminate":
+		c8.Do(func(c8 *arch.Chip8) { c8.Stop = true })
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%v is not supported", command)
+}
+
+// Continues emulation, stopping for the given reason if it is known.
+func (s *Server) resume(reason string) {
+	s.C8.Do(func(c8 *arch.Chip8) { s.Debugger.Continue(c8) })
+	s.reason, s.running = reason, true
+}
+
+// Tells the editor that the machine stopped.
+func (s *Server) stopped() {
+	reason := s.reason
+	if reason == "" {
+		reason = s.stopReason()
+	}
+	s.reason, s.running = "", false
+	body := map[string]any{"reason": reason, "threadId": 1, "allThreadsStopped": true}
+	if reason == "exception" {
+		s.C8.Do(func(c8 *arch.Chip8) {
+			if c8.Fault != nil {
+				body["text"] = c8.Fault.Error()
+			}
+		})
+	}
+	s.event("stopped", body)
+}
+
+// Works out why the machine stopped by itself.
+func (s *Server) stopReason() string {
+	reason := "pause"
+	s.C8.Do(func(c8 *arch.Chip8) {
+		if c8.Fault != nil {
+			reason = "exception"
+		} else if s.Debugger.RecentHits(c8) != nil {
+			reason = "data breakpoint"
+		} else if s.Debugger.Breakpoints[c8.PC] != nil {
+			reason = "breakpoint"
+		}
+	})
+	return reason
+}
+
+func (s *Server) launch(args arguments) error {
+	if s.launched {
+		return fmt.Errorf("a program is already running")
+	}
+	if args.Program == "" {
+		return fmt.Errorf("no program to launch")
+	}
+
+	var err error
+	s.C8.Do(func(c8 *arch.Chip8) {
+		c8.Paused = true
+		err = c8.LoadGame(args.Program)
+	})
+	if err != nil {
+		return err
+	}
+
+	mapPath := args.SourceMap
+	if mapPath == "" {
+		if _, statErr := os.Stat(SourceMapPath(args.Program)); statErr == nil {
+			mapPath = SourceMapPath(args.Program)
+		}
+	}
+	if mapPath != "" {
+		if s.Source, err = LoadSourceMap(mapPath); err != nil {
+			return err
+		}
+	} else {
+		s.Source = Disassembly(s.C8.RomSize)
+	}
+	s.launched, s.stopOnEntry = true, args.StopOnEntry
+	return nil
+}
+
+// Finds the key of a source in the source map.
+func (s *Server) sourceFile(src source) string {
+	if src.SourceReference == disassemblyReference || src.Path == "" {
+		return ""
+	}
+	path, _ := filepath.Abs(src.Path)
+	return filepath.Clean(path)
+}
+
+func (s *Server) describeSource(file string) source {
+	if file == "" {
+		return source{Name: "ROM disassembly", SourceReference: disassemblyReference}
+	}
+	return source{Name: filepath.Base(file), Path: file}
+}
+
+func (s *Server) setBreakpoints(args arguments) (any, error) {
+	if s.Source == nil {
+		return nil, fmt.Errorf("launch a program first")
+	}
+	file := s.sourceFile(args.Source)
+	results := []map[string]any{}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		for _, addr := range s.breakpoints[file] {
+			delete(s.Debugger.Breakpoints, addr)
+		}
+		s.breakpoints[file] = nil
+
+		for _, spec := range args.Breakpoints {
+			result := map[string]any{"verified": false, "line": spec.Line}
+			results = append(results, result)
+			addr, found := s.Source.Addrs[SourceLine{file, spec.Line}]
+			if !found {
+				result["message"] = "No code was generated for this line."
+				continue
+			}
+
+			bp := &arch.Breakpoint{Addr: addr, Message: spec.LogMessage}
+			if spec.Condition != "" {
+				cond, err := arch.ParseExpr(spec.Condition)
+				if err != nil {
+					result["message"] = err.Error()
+					continue
+				}
+				bp.Cond = cond
+			}
+			if spec.HitCondition != "" {
+				count, err := strconv.Atoi(spec.HitCondition)
+				if err != nil || count < 1 {
+					result["message"] = "The hit count must be a positive number."
+					continue
+				}
+				bp.Ignore = count - 1
+			}
+			s.Debugger.Breakpoints[addr] = bp
+			s.breakpoints[file] = append(s.breakpoints[file], addr)
+			result["verified"] = true
+		}
+	})
+	return map[string]any{"breakpoints": results}, nil
+}
+
+// Lists the current instruction, then the call that led to each
+// subroutine on the stack. Subroutines are named after their address.
+func (s *Server) stackTrace(c8 *arch.Chip8) []map[string]any {
+	frames := []map[string]any{}
+	addrs := []uint16{c8.PC}
+	for index := int(c8.SP) - 1; index >= 0; index-- {
+		addrs = append(addrs, c8.Stack[index])
+	}
+
+	for depth, addr := range addrs {
+		name := "main"
+		if depth < int(c8.SP) {
+			call := c8.Stack[int(c8.SP)-1-depth]
+			name = fmt.Sprintf("sub_%03X", c8.OpcodeAt(call).Literal)
+		}
+		frame := map[string]any{
+			"id": depth, "name": name, "line": 0, "column": 0,
+			"instructionPointerReference": fmt.Sprintf("0x%03X", addr),
+		}
+		if s.Source != nil {
+			if loc, found := s.Source.Find(addr); found {
+				frame["source"], frame["line"], frame["column"] = s.describeSource(loc.File), loc.Line, 1
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func (s *Server) variables(c8 *arch.Chip8, reference int) []map[string]any {
+	variables := []map[string]any{}
+	add := func(name string, value uint16, memory bool) {
+		variable := map[string]any{
+			"name": name, "value": fmt.Sprintf("0x%02X (%v)", value, value), "variablesReference": 0,
+		}
+		if memory {
+			variable["memoryReference"] = fmt.Sprintf("0x%03X", value)
+		}
+		variables = append(variables, variable)
+	}
+
+	switch reference {
+	case 1:
+		for reg, value := range c8.Registers {
+			add(fmt.Sprintf("V%X", reg), uint16(value), false)
+		}
+		add("I", c8.IndexReg, true)
+		add("PC", c8.PC, true)
+		add("SP", c8.SP, false)
+		add("DT", uint16(c8.DelayTimer), false)
+		add("ST", uint16(c8.SoundTimer), false)
+	case 2:
+		for index := int(c8.SP) - 1; index >= 0; index-- {
+			add(fmt.Sprintf("[%v]", index), c8.Stack[index], true)
+		}
+	}
+	return variables
+}
+
+func (s *Server) setVariable(args arguments) (any, error) {
+	value, err := arch.ParseValue(args.Value)
+	if err != nil {
+		return nil, err
+	}
+	var loc arch.Location
+	switch {
+	case args.Name == "PC" && int(value)+1 >= len(s.C8.Memory):
+		return nil, fmt.Errorf("PC must be at most 0x%X", len(s.C8.Memory)-2)
+	case args.Name == "SP" && int(value) > len(s.C8.Stack):
+		return nil, fmt.Errorf("SP must be at most %v", len(s.C8.Stack))
+	case args.Name != "PC" && args.Name != "SP":
+		if loc, err = arch.ParseLocation(args.Name); err != nil || args.VariablesReference != 1 {
+			return nil, fmt.Errorf("%v can't be changed", args.Name)
+		}
+	}
+
+	s.C8.Do(func(c8 *arch.Chip8) {
+		switch args.Name {
+		case "PC":
+			c8.PC = value
+		case "SP":
+			c8.SP = value
+		default:
+			c8.Set(loc, value)
+			value = c8.Get(loc) // It may have been truncated.
+		}
+		if c8.History != nil {
+			c8.History.Diverge(c8)
+		}
+	})
+	return map[string]any{"value": fmt.Sprintf("0x%02X (%v)", value, value)}, nil
+}
+
+func (s *Server) memory(command string, args arguments) (any, error) {
+	base, err := strconv.ParseUint(args.MemoryReference, 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a memory reference", args.MemoryReference)
+	}
+	addr := int(base) + args.Offset
+	if addr < 0 || addr >= len(s.C8.Memory) {
+		return nil, fmt.Errorf("0x%X is not in memory", addr)
+	}
+
+	if command == "readMemory" {
+		count := args.Count
+		if count < 0 {
+			return nil, fmt.Errorf("cannot read %v bytes", count)
+		}
+		if addr+count > len(s.C8.Memory) {
+			count = len(s.C8.Memory) - addr
+		}
+		data := make([]byte, count)
+		s.C8.Do(func(c8 *arch.Chip8) { copy(data, c8.Memory[addr:]) })
+		return map[string]any{
+			"address":         fmt.Sprintf("0x%03X", addr),
+			"data":            base64.StdEncoding.EncodeToString(data),
+			"unreadableBytes": args.Count - count,
+		}, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+	if addr+len(data) > len(s.C8.Memory) {
+		return nil, fmt.Errorf("writing %v bytes at 0x%X would run past the end of memory", len(data), addr)
+	}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		copy(c8.Memory[addr:], data)
+		if c8.History != nil {
+			c8.History.Diverge(c8)
+		}
+	})
+	return map[string]any{"bytesWritten": len(data)}, nil
+}
@@ -0,0 +1,203 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"jugonz/chip8/arch"
+	"jugonz/chip8/archtest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A minimal editor, for talking to the server over pipes.
+type client struct {
+	t      *testing.T
+	out    io.Writer
+	reader *bufio.Reader
+	seq    int
+}
+
+func (c *client) send(command string, args any) {
+	c.seq++
+	data, _ := json.Marshal(args)
+	body, _ := json.Marshal(message{Seq: c.seq, Type: "request", Command: command, Arguments: data})
+	fmt.Fprintf(c.out, "Content-Length: %v\r\n\r\n%s", len(body), body)
+}
+
+// Reads the next message, which must be the named response or event,
+// and returns its body. Output from the debugger may come at any time,
+// so it is skipped.
+func (c *client) expect(name string) map[string]any {
+	c.t.Helper()
+	msg, err := readMessage(c.reader)
+	for err == nil && msg.Event == "output" {
+		msg, err = readMessage(c.reader)
+	}
+	if err != nil {
+		c.t.Fatalf("Expected %v, got error %v!\n", name, err)
+	}
+	if msg.Command != name && msg.Event != name {
+		c.t.Fatalf("Expected %v, got %+v\n", name, msg)
+	}
+	if msg.Success != nil && !*msg.Success {
+		c.t.Fatalf("%v failed: %v\n", name, msg.Message)
+	}
+	body, _ := msg.Body.(map[string]any)
+	return body
+}
+
+func (c *client) request(command string, args any) map[string]any {
+	c.t.Helper()
+	c.send(command, args)
+	return c.expect(command)
+}
+
+// Starts a server for a Chip8 that runs in the background like Run does,
+// with a client connected to it, and writes a ROM for it to launch.
+func startServer(t *testing.T, program []uint16) (*arch.Chip8, *client, string) {
+	romPath := filepath.Join(t.TempDir(), "test.ch8")
+	if err := os.WriteFile(romPath, archtest.Rom(program), 0644); err != nil {
+		t.Fatalf("Could not write ROM! Error was: %v\n", err)
+	}
+
+	c8 := arch.MakeChip8(false)
+	c8.History = arch.MakeHistory()
+	server := MakeServer(c8)
+	archtest.Run(t, c8)
+
+	toServer, fromClient := io.Pipe()
+	fromServer, toClient := io.Pipe()
+	t.Cleanup(func() { fromClient.Close() })
+	go server.Serve(toServer, toClient)
+	return c8, &client{t: t, out: fromClient, reader: bufio.NewReader(fromServer)}, romPath
+}
+
+func TestLaunchAndBreakpoints(t *testing.T) {
+	_, c, romPath := startServer(t, []uint16{
+		0x6005, // 200: Set V0 to 5.
+		0x7001, // 202: Add 1 to V0.
+		0x1204, // 204: Loop.
+	})
+
+	if body := c.request("initialize", map[string]any{}); body["supportsStepBack"] != true {
+		t.Errorf("Capabilities were %v\n", body)
+	}
+	c.request("launch", map[string]any{"program": romPath, "stopOnEntry": true})
+	c.expect("initialized")
+
+	body := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"sourceReference": 1},
+		"breakpoints": []map[string]any{{"line": 3}, {"line": 9}},
+	})
+	bps := body["breakpoints"].([]any)
+	if bps[0].(map[string]any)["verified"] != true || bps[1].(map[string]any)["verified"] != false {
+		t.Errorf("Breakpoints were %v\n", bps)
+	}
+	c.request("configurationDone", nil)
+	if body := c.expect("stopped"); body["reason"] != "entry" {
+		t.Errorf("Stopped on entry for %v\n", body["reason"])
+	}
+
+	c.request("continue", map[string]any{"threadId": 1})
+	if body := c.expect("stopped"); body["reason"] != "breakpoint" {
+		t.Errorf("Stopped at the breakpoint for %v\n", body["reason"])
+	}
+	frames := c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	if frame := frames[0].(map[string]any); frame["line"] != 3.0 || frame["instructionPointerReference"] != "0x204" {
+		t.Errorf("Top frame was %v\n", frame)
+	}
+
+	vars := c.request("variables", map[string]any{"variablesReference": 1})["variables"].([]any)
+	if v0 := vars[0].(map[string]any); v0["name"] != "V0" || v0["value"] != "0x06 (6)" {
+		t.Errorf("V0 was %v\n", v0)
+	}
+	if result := c.request("evaluate", map[string]any{"expression": "V0 * 2"})["result"]; result != "12 (0xC)" {
+		t.Errorf("Evaluated V0 * 2 as %v\n", result)
+	}
+
+	c.request("stepBack", map[string]any{"threadId": 1})
+	c.expect("stopped")
+	frames = c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	if line := frames[0].(map[string]any)["line"]; line != 2.0 {
+		t.Errorf("Stepped back to line %v, expected 2\n", line)
+	}
+
+	c.request("disconnect", nil)
+	c.expect("terminated")
+}
+
+func TestMemoryAndVariables(t *testing.T) {
+	c8, c, romPath := startServer(t, []uint16{0xA300, 0x1202})
+	c.request("initialize", map[string]any{})
+	c.request("launch", map[string]any{"program": romPath, "stopOnEntry": true})
+	c.expect("initialized")
+	c.request("configurationDone", nil)
+	c.expect("stopped")
+
+	c.request("writeMemory", map[string]any{"memoryReference": "0x300", "offset": 1, "data": "q7zN"})
+	body := c.request("readMemory", map[string]any{"memoryReference": "0x300", "count": 4})
+	if body["data"] != "AKu8zQ==" || body["address"] != "0x300" {
+		t.Errorf("Memory read was %v\n", body)
+	}
+
+	c.request("setVariable", map[string]any{"variablesReference": 1, "name": "VA", "value": "0x42"})
+	c.request("next", map[string]any{"threadId": 1})
+	if body := c.expect("stopped"); body["reason"] != "step" {
+		t.Errorf("Stopped after next for %v\n", body["reason"])
+	}
+	vars := c.request("variables", map[string]any{"variablesReference": 1})["variables"].([]any)
+	for _, v := range vars {
+		v := v.(map[string]any)
+		if v["name"] == "I" && (v["value"] != "0x300 (768)" || v["memoryReference"] != "0x300") {
+			t.Errorf("I was %v\n", v)
+		}
+	}
+	va := uint8(0)
+	c8.Do(func(c8 *arch.Chip8) { va = c8.Registers[0xA] })
+	if va != 0x42 {
+		t.Errorf("VA was %X after setting it\n", va)
+	}
+
+	c.send("launch", map[string]any{"program": romPath})
+	if msg, _ := readMessage(c.reader); *msg.Success || !strings.Contains(msg.Message, "already") {
+		t.Errorf("Launching twice gave %+v\n", msg)
+	}
+}
+
+func TestStepFaultsAndBadReads(t *testing.T) {
+	_, c, romPath := startServer(t, []uint16{0x0123})
+	c.request("initialize", map[string]any{})
+	c.request("launch", map[string]any{"program": romPath, "stopOnEntry": true})
+	c.expect("initialized")
+	c.request("configurationDone", nil)
+	c.expect("stopped")
+
+	for name, value := range map[string]string{"PC": "0xFFF", "SP": "17"} {
+		c.send("setVariable", map[string]any{"variablesReference": 1, "name": name, "value": value})
+		if msg, _ := readMessage(c.reader); *msg.Success {
+			t.Errorf("Setting %v to %v gave %+v\n", name, value, msg)
+		}
+	}
+	c.request("setVariable", map[string]any{"variablesReference": 1, "name": "SP", "value": "16"})
+	c.request("stackTrace", map[string]any{"threadId": 1})
+	c.request("setVariable", map[string]any{"variablesReference": 1, "name": "SP", "value": "0"})
+
+	c.send("readMemory", map[string]any{"memoryReference": "0x300", "count": -1})
+	if msg, _ := readMessage(c.reader); *msg.Success {
+		t.Errorf("Reading -1 bytes gave %+v\n", msg)
+	}
+	for _, command := range []string{"stepIn", "next"} {
+		c.send(command, map[string]any{"threadId": 1})
+		if msg, _ := readMessage(c.reader); *msg.Success || !strings.Contains(msg.Message, "Unimplemented") {
+			t.Errorf("Stepping into machine code with %v gave %+v\n", command, msg)
+		}
+	}
+	c.request("continue", map[string]any{"threadId": 1})
+	if body := c.expect("stopped"); body["reason"] != "exception" || !strings.Contains(body["text"].(string), "Unimplemented") {
+		t.Errorf("Continuing into machine code stopped with %v\n", body)
+	}
+}
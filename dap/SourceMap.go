@@ -0,0 +1,113 @@
+package dap
+
+import (
+	"bufio"
+	"fmt"
+	"jugonz/chip8/arch"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Datatype to describe a source map, which ties ROM addresses to the
+ * source lines an assembler built them from. Map files have one
+ * instruction per line: its address in hex, the source file (relative to
+ * the map file) and the line number, for example:
+ *
+ *	# Comments start with a hash.
+ *	200 game.8o 12
+ *	202 game.8o 13
+ *
+ * ROMs without a map are debugged using their disassembly instead.
+ */
+type SourceMap struct {
+	Addrs map[SourceLine]uint16 // First address generated for each line.
+	Lines map[uint16]SourceLine
+}
+
+type SourceLine struct {
+	File string // Absolute path, or "" for the disassembly.
+	Line int    // Starting at 1.
+}
+
+// SourceMapPath returns where the source map for a ROM is kept.
+func SourceMapPath(romPath string) string {
+	return romPath + ".map"
+}
+
+func LoadSourceMap(filePath string) (*SourceMap, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &SourceMap{make(map[SourceLine]uint16), make(map[uint16]SourceLine)}
+	dir := filepath.Dir(filePath)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%v:%v: expected \"address file line\"", filePath, lineNum)
+		}
+		addr, err := arch.ParseAddress(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", filePath, lineNum, err)
+		}
+		line, err := strconv.Atoi(fields[2])
+		if err != nil || line < 1 {
+			return nil, fmt.Errorf("%v:%v: %q is not a line number", filePath, lineNum, fields[2])
+		}
+		source := fields[1]
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(dir, source)
+		}
+
+		loc := SourceLine{filepath.Clean(source), line}
+		if existing, found := m.Addrs[loc]; !found || addr < existing {
+			m.Addrs[loc] = addr
+		}
+		m.Lines[addr] = loc
+	}
+	return m, scanner.Err()
+}
+
+// Disassembly maps each instruction of a ROM to a line of its disassembly.
+func Disassembly(romSize int) *SourceMap {
+	m := &SourceMap{make(map[SourceLine]uint16), make(map[uint16]SourceLine)}
+	for offset := 0; offset < romSize; offset += 2 {
+		loc := SourceLine{"", offset/2 + 1}
+		m.Addrs[loc] = uint16(0x200 + offset)
+		m.Lines[uint16(0x200+offset)] = loc
+	}
+	return m
+}
+
+// DisassemblyText is the text of the disassembly that Disassembly maps to.
+func DisassemblyText(c8 *arch.Chip8) string {
+	text := strings.Builder{}
+	for offset := 0; offset < c8.RomSize; offset += 2 {
+		addr := 0x200 + offset
+		op := arch.MakeOpcode(uint16(c8.Memory[addr]) << 8)
+		if addr+1 < len(c8.Memory) {
+			op = arch.MakeOpcode(op.Value | uint16(c8.Memory[addr+1]))
+		}
+		fmt.Fprintf(&text, "%03X: %04X  %v\n", addr, op.Value, arch.Decode(op).Name)
+	}
+	return text.String()
+}
+
+// Find returns the source line for an address. Odd addresses, in the
+// middle of an instruction, belong to the instruction before them.
+func (m *SourceMap) Find(addr uint16) (SourceLine, bool) {
+	if loc, found := m.Lines[addr]; found {
+		return loc, true
+	}
+	loc, found := m.Lines[addr-1]
+	return loc, found
+}
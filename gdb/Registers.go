@@ -0,0 +1,108 @@
+package gdb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"jugonz/chip8/arch"
+	"strings"
+)
+
+// GDB has no Chip8 architecture, and drops target descriptions naming one
+// it doesn't know, so they name i386, which every GDB build knows.
+// Registers are sent in its byte order, little-endian.
+const Architecture = "i386"
+
+/**
+ * Datatype to describe a register, as seen by a debugger frontend.
+ * Registers are numbered by their position in the registers table.
+ */
+type Register struct {
+	Name string
+	Size int    // In bytes.
+	Type string // GDB type, for the target description.
+	Max  uint16 // Largest value the register may be set to.
+	Get  func(c8 *arch.Chip8) uint16
+	Set  func(c8 *arch.Chip8, value uint16)
+}
+
+// The register set: V0-VF, then I, PC, SP and the timers.
+var registers = makeRegisters()
+
+func makeRegisters() []Register {
+	regs := []Register{}
+	for reg := 0; reg < 16; reg++ {
+		reg := reg
+		regs = append(regs, Register{
+			Name: fmt.Sprintf("v%x", reg), Size: 1, Type: "uint8", Max: 0xFF,
+			Get: func(c8 *arch.Chip8) uint16 { return uint16(c8.Registers[reg]) },
+			Set: func(c8 *arch.Chip8, value uint16) { c8.Registers[reg] = uint8(value) },
+		})
+	}
+	return append(regs,
+		Register{
+			Name: "i", Size: 2, Type: "data_ptr", Max: 0xFFFF,
+			Get: func(c8 *arch.Chip8) uint16 { return c8.IndexReg },
+			Set: func(c8 *arch.Chip8, value uint16) { c8.IndexReg = value },
+		},
+		Register{
+			Name: "pc", Size: 2, Type: "code_ptr", Max: 0xFFE, // The last whole instruction.
+			Get: func(c8 *arch.Chip8) uint16 { return c8.PC },
+			Set: func(c8 *arch.Chip8, value uint16) { c8.PC = value },
+		},
+		Register{
+			Name: "sp", Size: 2, Type: "uint16", Max: 16, // A full stack.
+			Get: func(c8 *arch.Chip8) uint16 { return c8.SP },
+			Set: func(c8 *arch.Chip8, value uint16) { c8.SP = value },
+		},
+		Register{
+			Name: "dt", Size: 1, Type: "uint8", Max: 0xFF,
+			Get: func(c8 *arch.Chip8) uint16 { return uint16(c8.DelayTimer) },
+			Set: func(c8 *arch.Chip8, value uint16) { c8.DelayTimer = uint8(value) },
+		},
+		Register{
+			Name: "st", Size: 1, Type: "uint8", Max: 0xFF,
+			Get: func(c8 *arch.Chip8) uint16 { return uint16(c8.SoundTimer) },
+			Set: func(c8 *arch.Chip8, value uint16) { c8.SoundTimer = uint8(value) },
+		},
+	)
+}
+
+// Registers are sent little-endian, as GDB reads them for Architecture.
+func encodeRegister(reg Register, value uint16) string {
+	bytes := make([]byte, reg.Size)
+	for index := range bytes {
+		bytes[index] = byte(value >> (8 * index))
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// decodeRegister reads a register's value as encodeRegister writes it,
+// which must be exactly the register's size.
+func decodeRegister(reg Register, data string) (uint16, bool) {
+	bytes, err := hex.DecodeString(data)
+	if err != nil || len(bytes) != reg.Size {
+		return 0, false
+	}
+	value := uint16(0)
+	for index, b := range bytes {
+		value |= uint16(b) << (8 * index)
+	}
+	return value, true
+}
+
+// TargetXML describes the register set for GDB's qXfer:features:read.
+func TargetXML() string {
+	xml := strings.Builder{}
+	xml.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <architecture>` + Architecture + `</architecture>
+  <feature name="org.chip8.core">
+`)
+	for num, reg := range registers {
+		fmt.Fprintf(&xml, "    <reg name=\"%v\" bitsize=\"%v\" type=\"%v\" regnum=\"%v\"/>\n",
+			reg.Name, reg.Size*8, reg.Type, num)
+	}
+	xml.WriteString("  </feature>\n</target>\n")
+	return xml.String()
+}
@@ -0,0 +1,510 @@
+// Package gdb lets GDB, and other debugger frontends that speak the GDB
+// Remote Serial Protocol, debug a running Chip8 over TCP. The registers
+// are V0-VF, I, PC, SP and the timers, as described by TargetXML, and the
+// address space is the Chip8's memory. Breakpoints, watchpoints and
+// stepping use the arch package's debugger, so they behave exactly as
+// they do in the debugger console.
+package gdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"jugonz/chip8/arch"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Datatype to describe a GDB remote protocol server for one Chip8.
+ * Clients are served one at a time. Everything that touches the machine
+ * goes through Chip8.Do, so it is safe while Run is emulating.
+ */
+type Server struct {
+	C8       *arch.Chip8
+	Debugger *arch.Debugger
+	conn     io.Writer
+	noAck    bool // True once the client turns off acknowledgements.
+	running  bool // True while continuing, until the machine stops.
+}
+
+// How often to check whether a running machine has stopped.
+const pollInterval = 10 * time.Millisecond
+
+// MakeServer makes a server that controls c8 through its debugger,
+// creating one without a console if there is none. It must be called
+// before c8 starts running.
+func MakeServer(c8 *arch.Chip8) *Server {
+	if c8.Debugger == nil {
+		c8.Debugger = arch.MakeDebugger(nil, io.Discard)
+	}
+	return &Server{C8: c8, Debugger: c8.Debugger}
+}
+
+// Serve accepts clients from listener until it is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		s.ServeConn(conn)
+		conn.Close()
+	}
+}
+
+// Something that arrived from the client.
+type event struct {
+	packet    string
+	bad       bool // True if the checksum didn't match.
+	interrupt bool // True if the client pressed Ctrl-C.
+	err       error
+}
+
+// ServeConn talks to a single client until it detaches or disconnects.
+func (s *Server) ServeConn(conn io.ReadWriter) error {
+	s.conn, s.noAck, s.running = conn, false, false
+	events := make(chan event)
+	done := make(chan bool)
+	defer close(done)
+	go readEvents(conn, events, done)
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case ev := <-events:
+			switch {
+			case ev.err == io.EOF:
+				return nil
+			case ev.err != nil:
+				return ev.err
+			case ev.interrupt:
+				if s.running {
+					s.C8.Do(func(c8 *arch.Chip8) { c8.Paused = true })
+					s.running = false
+					s.send("S02") // SIGINT
+				}
+			case ev.bad:
+				s.write("-") // Ask for it again.
+			default:
+				if !s.noAck {
+					s.write("+")
+				}
+				if quit := s.handle(ev.packet); quit {
+					return nil
+				}
+			}
+		case <-poll.C:
+			if !s.running {
+				continue
+			}
+			paused := false
+			s.C8.Do(func(c8 *arch.Chip8) { paused = c8.Paused })
+			if paused {
+				s.running = false
+				s.send(s.stopReply())
+			}
+		}
+	}
+}
+
+// Reads packets and interrupts from the client, until done is closed.
+func readEvents(r io.Reader, events chan<- event, done <-chan bool) {
+	reader := bufio.NewReader(r)
+	send := func(ev event) bool {
+		select {
+		case events <- ev:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	for {
+		char, err := reader.ReadByte()
+		if err != nil {
+			send(event{err: err})
+			return
+		}
+		switch char {
+		case 0x03:
+			if !send(event{interrupt: true}) {
+				return
+			}
+		case '$':
+			data, err := reader.ReadString('#')
+			sum := make([]byte, 2)
+			if err == nil {
+				_, err = io.ReadFull(reader, sum)
+			}
+			if err != nil {
+				send(event{err: err})
+				return
+			}
+			data = strings.TrimSuffix(data, "#")
+			bad := fmt.Sprintf("%02x", checksum(data)) != strings.ToLower(string(sum))
+			if !send(event{packet: data, bad: bad}) {
+				return
+			}
+		}
+		// Acknowledgements ('+' and '-') are ignored, since we never resend.
+	}
+}
+
+func checksum(data string) uint8 {
+	sum := uint8(0)
+	for index := 0; index < len(data); index++ {
+		sum += data[index]
+	}
+	return sum
+}
+
+func (s *Server) write(data string) {
+	io.WriteString(s.conn, data)
+}
+
+// Sends a packet, escaping the characters the protocol reserves.
+func (s *Server) send(data string) {
+	escaped := strings.Builder{}
+	for index := 0; index < len(data); index++ {
+		if char := data[index]; strings.IndexByte("$#}*", char) >= 0 {
+			escaped.WriteByte('}')
+			escaped.WriteByte(char ^ 0x20)
+		} else {
+			escaped.WriteByte(char)
+		}
+	}
+	s.write(fmt.Sprintf("$%v#%02x", escaped.String(), checksum(escaped.String())))
+}
+
+// Handles a packet, returning true if the session is over.
+func (s *Server) handle(packet string) bool {
+	if packet == "" {
+		s.send("")
+		return false
+	}
+	switch packet[0] {
+	case '?':
+		s.send(s.stopReply())
+	case 'q', 'Q':
+		s.send(s.query(packet))
+		if packet == "QStartNoAckMode" {
+			s.noAck = true // That reply was still acknowledged, but no more.
+		}
+	case 'H', 'T':
+		s.send("OK") // There is only one thread.
+	case 'g':
+		reply := strings.Builder{}
+		s.C8.Do(func(c8 *arch.Chip8) {
+			for _, reg := range registers {
+				reply.WriteString(encodeRegister(reg, reg.Get(c8)))
+			}
+		})
+		s.send(reply.String())
+	case 'G':
+		s.send(s.writeRegisters(packet[1:]))
+	case 'p':
+		num, err := strconv.ParseUint(packet[1:], 16, 8)
+		if err != nil || int(num) >= len(registers) {
+			s.send("E01")
+			break
+		}
+		value := uint16(0)
+		s.C8.Do(func(c8 *arch.Chip8) { value = registers[num].Get(c8) })
+		s.send(encodeRegister(registers[num], value))
+	case 'P':
+		s.send(s.writeRegister(packet[1:]))
+	case 'm':
+		s.send(s.readMemory(packet[1:]))
+	case 'M':
+		s.send(s.writeMemory(packet[1:]))
+	case 'c', 's':
+		if len(packet) > 1 {
+			addr, err := strconv.ParseUint(packet[1:], 16, 16)
+			if err != nil {
+				s.send("E01")
+				break
+			}
+			s.C8.Do(func(c8 *arch.Chip8) {
+				c8.PC = uint16(addr)
+				if c8.History != nil {
+					c8.History.Diverge(c8) // The old future started from another PC.
+				}
+			})
+		}
+		if packet[0] == 'c' {
+			s.C8.Do(func(c8 *arch.Chip8) { s.Debugger.Continue(c8) })
+			s.running = true // The stop reply is sent once it stops.
+		} else {
+			var err error
+			s.C8.Do(func(c8 *arch.Chip8) {
+				defer arch.CatchFault(&err)
+				c8.Paused = true
+				c8.EmulateCycle()
+			})
+			if fault := (*arch.Fault)(nil); errors.As(err, &fault) {
+				s.send(faultReply(fault))
+				break
+			}
+			s.send(s.stopReply())
+		}
+	case 'b':
+		s.send(s.reverse(packet))
+	case 'Z', 'z':
+		s.send(s.breakpoint(packet))
+	case 'D':
+		s.C8.Do(func(c8 *arch.Chip8) { s.Debugger.Continue(c8) })
+		s.send("OK")
+		return true
+	case 'k':
+		return true
+	default:
+		s.send("") // Unsupported.
+	}
+	return false
+}
+
+func (s *Server) query(packet string) string {
+	name, args, _ := strings.Cut(packet, ":")
+	switch name {
+	case "qSupported":
+		features := "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+;swbreak+;hwbreak+"
+		if s.C8.History != nil {
+			features += ";ReverseStep+;ReverseContinue+"
+		}
+		return features
+	case "QStartNoAckMode":
+		return "OK"
+	case "qAttached":
+		return "1"
+	case "qC":
+		return "QC1"
+	case "qfThreadInfo":
+		return "m1"
+	case "qsThreadInfo":
+		return "l"
+	case "qXfer":
+		// Only "features:read:target.xml:OFFSET,LENGTH" is supported.
+		object, annex, found := strings.Cut(args, ":read:")
+		file, window, _ := strings.Cut(annex, ":")
+		offset, length, ok := parsePair(window)
+		if !found || object != "features" || file != "target.xml" || !ok {
+			return "E00"
+		}
+		xml := TargetXML()
+		if offset >= len(xml) {
+			return "l"
+		}
+		if offset+length >= len(xml) {
+			return "l" + xml[offset:]
+		}
+		return "m" + xml[offset:offset+length]
+	}
+	return ""
+}
+
+// Parses "A,B" in hex.
+func parsePair(s string) (int, int, bool) {
+	first, second, found := strings.Cut(s, ",")
+	a, errA := strconv.ParseUint(first, 16, 32)
+	b, errB := strconv.ParseUint(second, 16, 32)
+	return int(a), int(b), found && errA == nil && errB == nil
+}
+
+// Builds a stop reply giving the reason the machine last stopped.
+// Reports a fault as the signal a real machine would raise for it:
+// SIGILL for instructions that can't run, and SIGSEGV for bad addresses.
+func faultReply(fault *arch.Fault) string {
+	switch fault.Kind {
+	case arch.FaultUnknownInstruction, arch.FaultMachineCode, arch.FaultKey:
+		return "S04" // SIGILL
+	}
+	return "S0b" // SIGSEGV
+}
+
+func (s *Server) stopReply() string {
+	reply := "S05" // SIGTRAP
+	s.C8.Do(func(c8 *arch.Chip8) {
+		if c8.Fault != nil {
+			reply = faultReply(c8.Fault)
+			return
+		}
+		for _, hit := range s.Debugger.RecentHits(c8) {
+			if hit.Loc.Kind != arch.LocMemory || hit.Num > len(s.Debugger.Watchpoints) {
+				continue
+			}
+			kind := "awatch"
+			switch s.Debugger.Watchpoints[hit.Num-1].Mode {
+			case arch.WatchRead:
+				kind = "rwatch"
+			case arch.WatchWrite, arch.WatchChange:
+				kind = "watch"
+			}
+			reply = fmt.Sprintf("T05%v:%x;", kind, hit.Loc.Addr)
+			return
+		}
+		if s.Debugger.Breakpoints[c8.PC] != nil {
+			reply = "T05swbreak:;"
+		}
+	})
+	return reply
+}
+
+func (s *Server) writeRegisters(data string) string {
+	values := []uint16{}
+	for _, reg := range registers {
+		if len(data) < reg.Size*2 {
+			return "E01"
+		}
+		value, ok := decodeRegister(reg, data[:reg.Size*2])
+		if !ok || value > reg.Max {
+			return "E01"
+		}
+		values = append(values, value)
+		data = data[reg.Size*2:]
+	}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		for num, reg := range registers {
+			reg.Set(c8, values[num])
+		}
+		s.changed(c8)
+	})
+	return "OK"
+}
+
+func (s *Server) writeRegister(data string) string {
+	numSpec, valueSpec, found := strings.Cut(data, "=")
+	num, err := strconv.ParseUint(numSpec, 16, 8)
+	if !found || err != nil || int(num) >= len(registers) {
+		return "E01"
+	}
+	value, ok := decodeRegister(registers[num], valueSpec)
+	if !ok || value > registers[num].Max {
+		return "E01"
+	}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		registers[num].Set(c8, value)
+		s.changed(c8)
+	})
+	return "OK"
+}
+
+func (s *Server) readMemory(data string) string {
+	addr, length, ok := parsePair(data)
+	if !ok || addr >= len(s.C8.Memory) {
+		return "E01"
+	}
+	reply := strings.Builder{}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		for index := addr; index < addr+length && index < len(c8.Memory); index++ {
+			fmt.Fprintf(&reply, "%02x", c8.Memory[index])
+		}
+	})
+	return reply.String()
+}
+
+func (s *Server) writeMemory(data string) string {
+	header, bytes, found := strings.Cut(data, ":")
+	addr, length, ok := parsePair(header)
+	if !found || !ok || addr+length > len(s.C8.Memory) || len(bytes) != length*2 {
+		return "E01"
+	}
+	values := []uint8{}
+	for index := 0; index < length; index++ {
+		value, err := strconv.ParseUint(bytes[index*2:index*2+2], 16, 8)
+		if err != nil {
+			return "E01"
+		}
+		values = append(values, uint8(value))
+	}
+	s.C8.Do(func(c8 *arch.Chip8) {
+		copy(c8.Memory[addr:], values)
+		s.changed(c8)
+	})
+	return "OK"
+}
+
+// Keeps time travel consistent after the client changes the machine.
+func (s *Server) changed(c8 *arch.Chip8) {
+	if c8.History != nil {
+		c8.History.Diverge(c8)
+	}
+}
+
+// Handles reverse execution: "bs" (step) and "bc" (continue).
+func (s *Server) reverse(packet string) string {
+	var err error
+	hit := true
+	s.C8.Do(func(c8 *arch.Chip8) {
+		switch packet {
+		case "bs":
+			err = s.Debugger.ReverseStep(c8, 1)
+		case "bc":
+			hit, err = s.Debugger.ReverseContinue(c8)
+		}
+	})
+	switch {
+	case packet != "bs" && packet != "bc":
+		return ""
+	case err != nil:
+		return "E01"
+	case !hit:
+		return "T05replaylog:begin;"
+	}
+	return s.stopReply()
+}
+
+// Handles "Z" (insert) and "z" (remove) packets of the form TYPE,ADDR,KIND.
+// Types are 0 and 1 for breakpoints, and 2, 3 and 4 for write, read and
+// access watchpoints, where KIND is the number of bytes watched.
+func (s *Server) breakpoint(packet string) string {
+	fields := strings.Split(packet[1:], ",")
+	if len(fields) < 3 {
+		return "E01"
+	}
+	addr, errAddr := strconv.ParseUint(fields[1], 16, 16)
+	kind, errKind := strconv.ParseUint(strings.Split(fields[2], ";")[0], 16, 16)
+	if errAddr != nil || errKind != nil || int(addr) >= len(s.C8.Memory) {
+		return "E01"
+	}
+	insert := packet[0] == 'Z'
+
+	modes := map[string]arch.WatchMode{"2": arch.WatchWrite, "3": arch.WatchRead, "4": arch.WatchAccess}
+	switch fields[0] {
+	case "0", "1":
+		s.C8.Do(func(c8 *arch.Chip8) {
+			if insert {
+				s.Debugger.Breakpoints[uint16(addr)] = &arch.Breakpoint{Addr: uint16(addr)}
+			} else {
+				delete(s.Debugger.Breakpoints, uint16(addr))
+			}
+		})
+	case "2", "3", "4":
+		w := arch.Watchpoint{
+			Loc:    arch.Location{Kind: arch.LocMemory, Addr: uint16(addr)},
+			Length: max(uint16(kind), 1), // Kind is the length in bytes, but may be 0.
+			Mode:   modes[fields[0]],
+		}
+		s.C8.Do(func(c8 *arch.Chip8) {
+			if insert {
+				s.Debugger.Watchpoints = append(s.Debugger.Watchpoints, w)
+				return
+			}
+			for index, existing := range s.Debugger.Watchpoints {
+				if existing == w {
+					s.Debugger.Watchpoints = append(s.Debugger.Watchpoints[:index],
+						s.Debugger.Watchpoints[index+1:]...)
+					s.Debugger.Hits = nil // Their numbers are out of date.
+					break
+				}
+			}
+		})
+	default:
+		return ""
+	}
+	return "OK"
+}
@@ -0,0 +1,209 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"jugonz/chip8/arch"
+	"jugonz/chip8/archtest"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A minimal GDB client, for talking to the server over localhost.
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Sends a packet without waiting for a reply, as for "c".
+func (c *client) send(packet string) {
+	fmt.Fprintf(c.conn, "$%v#%02x", packet, checksum(packet))
+	if ack, _ := c.reader.ReadByte(); ack != '+' {
+		c.t.Fatalf("Packet %q was not acknowledged, got %q!\n", packet, ack)
+	}
+}
+
+func (c *client) request(packet string) string {
+	c.send(packet)
+	return c.reply()
+}
+
+func (c *client) reply() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if start, err := c.reader.ReadByte(); err != nil || start != '$' {
+		c.t.Fatalf("Expected a packet, got %q (error %v)!\n", start, err)
+	}
+	data, _ := c.reader.ReadString('#')
+	c.reader.Discard(2) // Checksum.
+	c.conn.Write([]byte("+"))
+	return strings.TrimSuffix(data, "#")
+}
+
+// Starts a server for a Chip8 that runs in the background like Run does,
+// and connects a client to it.
+func startServer(t *testing.T, program []uint16) (*arch.Chip8, *client) {
+	c8 := arch.MakeChip8(false)
+	archtest.Load(c8, program)
+	server := MakeServer(c8)
+	c8.Paused = true
+	archtest.Run(t, c8)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen! Error was: %v\n", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Could not connect! Error was: %v\n", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return c8, &client{t, conn, bufio.NewReader(conn)}
+}
+
+func TestRegistersAndMemory(t *testing.T) {
+	_, c := startServer(t, []uint16{0x6A42, 0xA123})
+
+	if reply := c.request("qSupported:swbreak+"); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Errorf("qSupported reply was %q\n", reply)
+	}
+	xml := c.request("qXfer:features:read:target.xml:0,1000")
+	if !strings.HasPrefix(xml, "l<?xml") || !strings.Contains(xml, `<reg name="pc" bitsize="16" type="code_ptr" regnum="17"/>`) {
+		t.Errorf("Target description was %q\n", xml)
+	}
+	if reply := c.request("s"); reply != "S05" {
+		t.Errorf("Step reply was %q\n", reply)
+	}
+	c.request("s")
+
+	// V0-VF, then I, PC, SP, DT and ST.
+	expected := strings.Repeat("00", 10) + "42" + strings.Repeat("00", 5) + "2301" + "0402" + "0000" + "00" + "00"
+	if reply := c.request("g"); reply != expected {
+		t.Errorf("Registers were %q, expected %q\n", reply, expected)
+	}
+	if reply := c.request("P11=0003"); reply != "OK" {
+		t.Errorf("Writing PC failed with %q\n", reply)
+	}
+	if reply := c.request("p11"); reply != "0003" {
+		t.Errorf("PC was %q after writing it\n", reply)
+	}
+	for _, packet := range []string{"P11=ff0f", "P12=1100", "P0=100", "P10=01"} {
+		if reply := c.request(packet); reply != "E01" {
+			t.Errorf("Writing an out of range register with %v gave %q\n", packet, reply)
+		}
+	}
+
+	if !strings.Contains(xml, "<architecture>"+Architecture+"</architecture>") {
+		t.Errorf("Target description has no architecture: %q\n", xml)
+	}
+
+	if reply := c.request("M300,3:a1b2c3"); reply != "OK" {
+		t.Errorf("Writing memory failed with %q\n", reply)
+	}
+	if reply := c.request("m2ff,5"); reply != "00a1b2c300" {
+		t.Errorf("Memory was %q\n", reply)
+	}
+	if reply := c.request("m1000,1"); reply != "E01" {
+		t.Errorf("Reading past the end of memory gave %q\n", reply)
+	}
+}
+
+// GDB sends registers in the byte order of the target description's
+// architecture, low byte first, so I=0x0ABC is "bc0a".
+func TestRegistersRoundTrip(t *testing.T) {
+	c8, c := startServer(t, []uint16{0x1200})
+
+	gdbRegisters := "0102030405060708090a0b0c0d0e0f10" + "bc0a" + "4603" + "0200" + "3c" + "05"
+	if reply := c.request("G" + gdbRegisters); reply != "OK" {
+		t.Fatalf("Writing registers failed with %q\n", reply)
+	}
+	c8.Do(func(c8 *arch.Chip8) {
+		if c8.Registers[0] != 1 || c8.Registers[0xF] != 0x10 || c8.IndexReg != 0xABC ||
+			c8.PC != 0x346 || c8.SP != 2 || c8.DelayTimer != 0x3C || c8.SoundTimer != 5 {
+			t.Errorf("Registers were V0=%X VF=%X I=%X PC=%X SP=%X DT=%X ST=%X\n", c8.Registers[0], c8.Registers[0xF],
+				c8.IndexReg, c8.PC, c8.SP, c8.DelayTimer, c8.SoundTimer)
+		}
+	})
+	if reply := c.request("g"); reply != gdbRegisters {
+		t.Errorf("Registers were read back as %q, expected %q\n", reply, gdbRegisters)
+	}
+	if reply := c.request("p10"); reply != "bc0a" {
+		t.Errorf("I was read back as %q\n", reply)
+	}
+}
+
+func TestBreakpointsAndWatchpoints(t *testing.T) {
+	c8, c := startServer(t, []uint16{
+		0x7001, // 200: Add 1 to V0.
+		0xA300, // 202: Set I to 300.
+		0xF055, // 204: Save V0 at 300.
+		0x1200, // 206: Loop.
+	})
+
+	c.request("Z0,206,2")
+	c.send("c")
+	if reply := c.reply(); reply != "T05swbreak:;" {
+		t.Errorf("Breakpoint stop reply was %q\n", reply)
+	}
+	if reply := c.request("p11"); reply != "0602" {
+		t.Errorf("Stopped at PC %q, expected 0206\n", reply)
+	}
+
+	c.request("z0,206,2")
+	c.request("Z2,300,1")
+	c.send("c")
+	if reply := c.reply(); reply != "T05watch:300;" {
+		t.Errorf("Watchpoint stop reply was %q\n", reply)
+	}
+	if reply := c.request("p0"); reply != "02" {
+		t.Errorf("V0 was %q at the second write, expected 02\n", reply)
+	}
+
+	c.request("z2,300,1")
+	c.send("c")
+	time.Sleep(20 * time.Millisecond)
+	c.conn.Write([]byte{0x03})
+	if reply := c.reply(); reply != "S02" {
+		t.Errorf("Interrupt stop reply was %q\n", reply)
+	}
+	if reply := c.request("D"); reply != "OK" {
+		t.Errorf("Detach reply was %q\n", reply)
+	}
+	paused := true
+	c8.Do(func(c8 *arch.Chip8) { paused = c8.Paused })
+	if paused {
+		t.Errorf("Detaching should resume emulation!\n")
+	}
+}
+
+func TestStepFaultsAndZeroLengthWatchpoints(t *testing.T) {
+	_, c := startServer(t, []uint16{
+		0xA300, // 200: Set I to 300.
+		0xF055, // 202: Save V0 at 300.
+		0x0123, // 204: Machine code.
+	})
+
+	if reply := c.request("Z2,300,0"); reply != "OK" {
+		t.Errorf("Setting a watchpoint gave %q\n", reply)
+	}
+	c.send("c")
+	if reply := c.reply(); reply != "T05watch:300;" {
+		t.Errorf("Zero-length watchpoint stop reply was %q\n", reply)
+	}
+	c.request("z2,300,0")
+	if reply := c.request("s"); reply != "S04" {
+		t.Errorf("Stepping into machine code gave %q\n", reply)
+	}
+	if reply := c.request("s202"); reply != "S05" {
+		t.Errorf("Stepping from a new PC gave %q\n", reply)
+	}
+	c.send("c")
+	if reply := c.reply(); reply != "S04" {
+		t.Errorf("Continuing into machine code gave %q\n", reply)
+	}
+}
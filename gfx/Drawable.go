@@ -1,9 +1,19 @@
 package gfx
 
+import (
+	"image"
+)
+
 type Drawable interface {
 	Draw()
 	XorPixel(x, y uint16)
 	GetPixel(x, y uint16) bool
 	InBounds(x, y uint16) bool
 	ClearScreen()
+	SetStatus(status string) // Show how the emulator is running, like "Paused", or "" for nothing.
+}
+
+// Screens that can show what they look like, for screenshots.
+type Imager interface {
+	Image() *image.RGBA // One image pixel per screen pixel, in the screen's palette.
 }
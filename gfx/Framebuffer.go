@@ -0,0 +1,43 @@
+package gfx
+
+/**
+ * Datatype to describe the pixels of a monochrome display, without any
+ * way of showing them. Screens embed one to implement most of Drawable.
+ */
+type Framebuffer struct {
+	ResWidth  int
+	ResHeight int
+	Pixels    [][]bool // Column by column, so Pixels[x][y].
+}
+
+func MakeFramebuffer(resWidth int, resHeight int) Framebuffer {
+	f := Framebuffer{}
+	f.ResWidth = resWidth
+	f.ResHeight = resHeight
+
+	f.Pixels = make([][]bool, f.ResWidth)
+	for col := range f.Pixels {
+		f.Pixels[col] = make([]bool, f.ResHeight)
+	}
+	return f
+}
+
+func (f *Framebuffer) ClearScreen() {
+	for xLine := 0; xLine < f.ResWidth; xLine++ {
+		for yLine := 0; yLine < f.ResHeight; yLine++ {
+			f.Pixels[xLine][yLine] = false
+		}
+	}
+}
+
+func (f *Framebuffer) XorPixel(x, y uint16) {
+	f.Pixels[x][y] = f.Pixels[x][y] != true
+}
+
+func (f *Framebuffer) GetPixel(x, y uint16) bool {
+	return f.Pixels[x][y]
+}
+
+func (f *Framebuffer) InBounds(x, y uint16) bool {
+	return int(x) < f.ResWidth && int(y) < f.ResHeight
+}
@@ -0,0 +1,60 @@
+package gfx
+
+import (
+	"image"
+)
+
+/**
+ * Datatype to describe a screen and keypad with no window behind them,
+ * for running games from code. Keys are pressed by setting Keyboard.
+ */
+type Headless struct {
+	Framebuffer
+	Keyboard [16]bool // True if key pressed.
+	Frames   int      // Number of times the screen was drawn.
+	Status   string   // Last status shown.
+	Palette  Palette  // Colors for Image.
+}
+
+func MakeHeadless(resWidth int, resHeight int) *Headless {
+	return &Headless{Framebuffer: MakeFramebuffer(resWidth, resHeight),
+		Palette: Palettes[DefaultPalette]}
+}
+
+/**
+ * Methods to implement the Drawable interface.
+ */
+func (h *Headless) Draw() {
+	h.Frames++
+}
+
+func (h *Headless) SetStatus(status string) {
+	h.Status = status
+}
+
+func (h *Headless) Image() *image.RGBA {
+	return Render(&h.Framebuffer, nil, h.Palette)
+}
+
+/**
+ * Methods to implement the Interactible interface.
+ */
+func (h *Headless) SetKeys() {}
+
+func (h *Headless) KeyPressed(key uint8) bool {
+	return h.Keyboard[key]
+}
+
+func (h *Headless) HotkeyPressed(hotkey Hotkey) bool {
+	return false
+}
+
+func (h *Headless) HotkeyHeld(hotkey Hotkey) bool {
+	return false
+}
+
+func (h *Headless) ShouldClose() bool {
+	return false
+}
+
+func (h *Headless) Quit() {}
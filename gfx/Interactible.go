@@ -2,7 +2,36 @@ package gfx
 
 type Interactible interface {
 	SetKeys()
-	KeyPressed(key uint8) bool // Return whether the key number has been pressed.
+	KeyPressed(key uint8) bool        // Return whether the key number has been pressed.
+	HotkeyPressed(hotkey Hotkey) bool // Return whether the hotkey was pressed since the last call.
+	HotkeyHeld(hotkey Hotkey) bool    // Return whether the hotkey is held down right now.
 	ShouldClose() bool
 	Quit()
 }
+
+/**
+ * Emulator controls that are bound to keys outside of the Chip8 keypad.
+ */
+type Hotkey int
+
+const (
+	HotkeyCheat1 Hotkey = iota // Toggle cheats 1 through 8.
+	HotkeyCheat2
+	HotkeyCheat3
+	HotkeyCheat4
+	HotkeyCheat5
+	HotkeyCheat6
+	HotkeyCheat7
+	HotkeyCheat8
+	HotkeySearchStart     // Start a new memory search.
+	HotkeySearchDecreased // Keep search results that decreased.
+	HotkeySearchIncreased // Keep search results that increased.
+	HotkeySearchUnchanged // Keep search results that didn't change.
+	HotkeyRewind          // Play the game backwards while held.
+	HotkeyPause           // Pause or resume the game.
+	HotkeyFrameAdvance    // Pause, or run one frame if already paused.
+	HotkeyFastForward     // Run faster while held.
+	HotkeySlowMotion      // Turn slow motion on or off.
+	HotkeyMenu            // Open or close the menu of games.
+	NumHotkeys
+)
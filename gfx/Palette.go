@@ -0,0 +1,167 @@
+package gfx
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Datatype to describe the colors a screen is shown in: first for pixels
+ * that are off, then for pixels that are on. Screens have a single plane,
+ * so there are no colors for XO-CHIP's second plane.
+ */
+type Palette []color.RGBA
+
+const DefaultPalette = "mono"
+
+// Built-in palettes, by name.
+var Palettes = map[string]Palette{
+	"mono":          {rgb(0x000000), rgb(0xFFFFFF)},
+	"green":         {rgb(0x061206), rgb(0x33FF66)}, // P1 phosphor.
+	"amber":         {rgb(0x140A00), rgb(0xFFB000)}, // P3 phosphor.
+	"high-contrast": {rgb(0x000000), rgb(0xFFFF00)},
+	"inverted":      {rgb(0xFFFFFF), rgb(0x000000)},
+	"colorblind":    {rgb(0x000000), rgb(0xE69F00)}, // Okabe-Ito colors.
+	"octo":          {rgb(0x996600), rgb(0xFFCC00)},
+}
+
+func rgb(hex uint32) color.RGBA {
+	return color.RGBA{uint8(hex >> 16), uint8(hex >> 8), uint8(hex), 255}
+}
+
+// ParseColor reads a color written as #RRGGBB.
+func ParseColor(s string) (color.RGBA, error) {
+	digits, found := strings.CutPrefix(s, "#")
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if !found || len(digits) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("color %q is not #RRGGBB", s)
+	}
+	return rgb(uint32(value)), nil
+}
+
+// PaletteNames lists the built-in palettes, in order.
+func PaletteNames() []string {
+	names := []string{}
+	for name := range Palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Shade returns the color of a pixel from its brightness, between the
+// off color (0) and the on color (1).
+func (p Palette) Shade(brightness float64) color.RGBA {
+	off, on := p[0], p[1]
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*brightness + 0.5)
+	}
+	return color.RGBA{mix(off.R, on.R), mix(off.G, on.G), mix(off.B, on.B), 255}
+}
+
+// Palettes are kept in JSON as lists of colors, like ["#000000", "#FFFFFF"].
+func (p *Palette) UnmarshalJSON(data []byte) error {
+	colors := []string{}
+	if err := json.Unmarshal(data, &colors); err != nil {
+		return err
+	}
+	if len(colors) != 2 {
+		return fmt.Errorf("palette has %v colors, not 2", len(colors))
+	}
+	*p = Palette{}
+	for _, s := range colors {
+		c, err := ParseColor(s)
+		if err != nil {
+			return err
+		}
+		*p = append(*p, c)
+	}
+	return nil
+}
+
+// Render draws a screen into an image, one image pixel per screen pixel.
+// Brightness comes from persistence, and may be nil to show the pixels as
+// they are.
+func Render(f *Framebuffer, brightness [][]float64, p Palette) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, f.ResWidth, f.ResHeight))
+	for x, col := range f.Pixels {
+		for y, lit := range col {
+			shade := 0.0
+			if brightness != nil {
+				shade = brightness[x][y]
+			} else if lit {
+				shade = 1
+			}
+			img.SetRGBA(x, y, p.Shade(shade))
+		}
+	}
+	return img
+}
+
+/**
+ * Datatype to describe a palette config file: extra palettes, and which
+ * palette each ROM is shown in, kept as JSON like
+ *
+ *	{"palettes": {"mine": ["#102030", "#F0E0D0"]},
+ *	 "roms": {"BRIX": "amber", "PONG": "mine"}}
+ *
+ * ROMs are named by file name, or by the SHA-1 of their contents in hex.
+ */
+type PaletteConfig struct {
+	Palettes map[string]Palette `json:"palettes"`
+	ROMs     map[string]string  `json:"roms"`
+}
+
+func LoadPaletteConfig(filePath string) (*PaletteConfig, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	c := PaletteConfig{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%v: %v", filePath, err)
+	}
+	for rom, name := range c.ROMs {
+		if _, ok := c.Palette(name); !ok {
+			return nil, fmt.Errorf("%v: ROM %v uses unknown palette %q", filePath, rom, name)
+		}
+	}
+	return &c, nil
+}
+
+// Palette finds a palette by name, in the config or built in.
+// The config may be nil, for only the built-in palettes.
+func (c *PaletteConfig) Palette(name string) (Palette, bool) {
+	if c != nil {
+		if p, ok := c.Palettes[name]; ok {
+			return p, true
+		}
+	}
+	p, ok := Palettes[name]
+	return p, ok
+}
+
+// ForROM returns the name of the palette for a ROM, if it has one.
+func (c *PaletteConfig) ForROM(romPath string, rom []byte) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	hash := sha1.Sum(rom)
+	for _, key := range []string{filepath.Base(romPath), hex.EncodeToString(hash[:])} {
+		for rom, name := range c.ROMs {
+			if strings.EqualFold(rom, key) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,76 @@
+package gfx
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShade(t *testing.T) {
+	p := Palettes["amber"]
+	if p.Shade(0) != p[0] || p.Shade(1) != p[1] {
+		t.Errorf("Shades at 0 and 1 should be the off and on colors\n")
+	}
+	gray := Palettes["mono"].Shade(0.5)
+	if gray != (color.RGBA{128, 128, 128, 255}) {
+		t.Errorf("Half brightness in mono was %v\n", gray)
+	}
+
+	for name, p := range Palettes {
+		if len(p) != 2 {
+			t.Errorf("Palette %v has %v colors, not 2\n", name, len(p))
+		}
+	}
+
+	f := MakeFramebuffer(2, 1)
+	f.XorPixel(1, 0)
+	img := Render(&f, nil, Palettes["green"])
+	if img.RGBAAt(0, 0) != Palettes["green"][0] || img.RGBAAt(1, 0) != Palettes["green"][1] {
+		t.Errorf("Rendered pixels were %v and %v\n", img.RGBAAt(0, 0), img.RGBAAt(1, 0))
+	}
+}
+
+func TestPaletteConfig(t *testing.T) {
+	rom := []byte{0x12, 0x00}
+	hash := sha1.Sum(rom)
+	configPath := filepath.Join(t.TempDir(), "palettes.json")
+	os.WriteFile(configPath, []byte(`{
+		"palettes": {"mine": ["#102030", "#F0E0D0"], "amber": ["#000000", "#FF0000"]},
+		"roms": {"brix": "amber", "`+hex.EncodeToString(hash[:])+`": "mine"}
+	}`), 0644)
+
+	config, err := LoadPaletteConfig(configPath)
+	if err != nil {
+		t.Fatalf("Could not load palettes! Error was: %v\n", err)
+	}
+	if name, _ := config.ForROM("games/BRIX", nil); name != "amber" {
+		t.Errorf("BRIX had palette %q\n", name)
+	}
+	if name, _ := config.ForROM("games/renamed.ch8", rom); name != "mine" {
+		t.Errorf("ROM found by hash had palette %q\n", name)
+	}
+	if _, ok := config.ForROM("games/PONG", []byte{0}); ok {
+		t.Errorf("PONG should have no palette\n")
+	}
+	if amber, _ := config.Palette("amber"); amber[1] != rgb(0xFF0000) {
+		t.Errorf("Palettes in the config should override built-in ones\n")
+	}
+	if _, ok := config.Palette("octo"); !ok {
+		t.Errorf("Built-in palettes should still be found\n")
+	}
+
+	for _, bad := range []string{
+		`{"palettes": {"short": ["#000000"]}}`,
+		`{"palettes": {"planes": ["#000000", "#FFFFFF", "#FF0000", "#00FF00"]}}`,
+		`{"palettes": {"bad": ["#000000", "white"]}}`,
+		`{"roms": {"BRIX": "missing"}}`,
+	} {
+		os.WriteFile(configPath, []byte(bad), 0644)
+		if _, err := LoadPaletteConfig(configPath); err == nil {
+			t.Errorf("Loading %v should fail\n", bad)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package gfx
+
+import (
+	"fmt"
+)
+
+/**
+ * Datatype to describe how long lit pixels stay on the display after
+ * the game turns them off. Games draw by XORing sprites off and back on,
+ * so without persistence, moving sprites flicker.
+ */
+type PersistenceMode int
+
+const (
+	PersistenceOff  PersistenceMode = iota // Show pixels exactly as they are.
+	PersistenceFade                        // Fade pixels out over a number of frames, like a phosphor.
+	PersistenceOr                          // Show pixels lit in either of the last two frames.
+)
+
+var persistenceNames = map[string]PersistenceMode{
+	"off":  PersistenceOff,
+	"fade": PersistenceFade,
+	"or":   PersistenceOr,
+}
+
+func ParsePersistenceMode(name string) (PersistenceMode, error) {
+	mode, ok := persistenceNames[name]
+	if !ok {
+		return PersistenceOff, fmt.Errorf("unknown persistence %q (choose off, fade or or)", name)
+	}
+	return mode, nil
+}
+
+/**
+ * Datatype to describe a display filter that turns a Framebuffer into
+ * the brightness of each pixel, with persistence. It only reads the
+ * Framebuffer, so the game never sees its effects.
+ */
+type Persistence struct {
+	Mode       PersistenceMode
+	FadeFrames int         // Frames a pixel takes to fade out, in PersistenceFade mode.
+	Brightness [][]float64 // From 0 (off) to 1 (lit), column by column like Pixels.
+	previous   [][]bool    // Pixels in the last frame, for PersistenceOr mode.
+	settled    bool        // True if Brightness matches the pixels exactly.
+}
+
+func MakePersistence(mode PersistenceMode, fadeFrames int, resWidth int, resHeight int) *Persistence {
+	p := Persistence{Mode: mode, FadeFrames: max(fadeFrames, 1)}
+	p.Brightness = make([][]float64, resWidth)
+	p.previous = make([][]bool, resWidth)
+	for col := range p.Brightness {
+		p.Brightness[col] = make([]float64, resHeight)
+		p.previous[col] = make([]bool, resHeight)
+	}
+	return &p
+}
+
+// Apply works out the brightness of every pixel for a new frame.
+func (p *Persistence) Apply(f *Framebuffer) [][]float64 {
+	p.settled = true
+	fade := 1 / float64(p.FadeFrames)
+	for x, col := range f.Pixels {
+		for y, lit := range col {
+			exact, brightness := 0.0, 0.0
+			switch {
+			case lit:
+				exact, brightness = 1, 1
+			case p.Mode == PersistenceFade:
+				brightness = max(p.Brightness[x][y]-fade, 0)
+			case p.Mode == PersistenceOr && p.previous[x][y]:
+				brightness = 1
+			}
+			p.Brightness[x][y] = brightness
+			p.previous[x][y] = lit
+			p.settled = p.settled && brightness == exact
+		}
+	}
+	return p.Brightness
+}
+
+// Settled returns whether the last frame showed the pixels as they are,
+// so that the display won't change until the game draws again.
+func (p *Persistence) Settled() bool {
+	return p.settled
+}
@@ -0,0 +1,53 @@
+package gfx
+
+import (
+	"testing"
+)
+
+// Applies persistence over a series of frames for a single pixel,
+// returning its brightness in each.
+func brightnesses(p *Persistence, frames ...bool) []float64 {
+	f := MakeFramebuffer(1, 1)
+	result := []float64{}
+	for _, lit := range frames {
+		f.Pixels[0][0] = lit
+		result = append(result, p.Apply(&f)[0][0])
+	}
+	return result
+}
+
+func TestPersistence(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        *Persistence
+		expected []float64
+	}{
+		{"off", MakePersistence(PersistenceOff, 4, 1, 1), []float64{1, 0, 0, 0, 0, 1}},
+		{"fade", MakePersistence(PersistenceFade, 4, 1, 1), []float64{1, 0.75, 0.5, 0.25, 0, 1}},
+		{"or", MakePersistence(PersistenceOr, 4, 1, 1), []float64{1, 1, 0, 0, 0, 1}},
+	}
+	for _, test := range tests {
+		actual := brightnesses(test.p, true, false, false, false, false, true)
+		for frame := range actual {
+			if actual[frame] != test.expected[frame] {
+				t.Errorf("%v: expected brightnesses %v, got %v\n", test.name, test.expected, actual)
+				break
+			}
+		}
+		if !test.p.Settled() {
+			t.Errorf("%v: not settled with the pixel lit\n", test.name)
+		}
+	}
+}
+
+func TestPersistenceLeavesPixels(t *testing.T) {
+	f := MakeFramebuffer(2, 1)
+	p := MakePersistence(PersistenceFade, 2, 2, 1)
+	f.XorPixel(0, 0)
+	p.Apply(&f)
+	f.XorPixel(0, 0)
+	p.Apply(&f)
+	if f.GetPixel(0, 0) || p.Settled() || p.Brightness[0][0] != 0.5 {
+		t.Errorf("Fading changed the pixels, or didn't fade: %v\n", p.Brightness)
+	}
+}
@@ -0,0 +1,159 @@
+package gfx
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+)
+
+/**
+ * Datatype to describe a pixel-art upscaler, for turning a rendered
+ * screen into a larger image for the window or a screenshot.
+ */
+type Scaler int
+
+const (
+	ScaleNearest Scaler = iota // Blocky, with every pixel the same size.
+	ScaleEPX                   // Scale2x/EPX, which rounds off diagonal edges.
+	ScaleHQ                    // Like EPX, but blends edges smoothly, in the style of hqx.
+)
+
+var scalerNames = map[string]Scaler{
+	"nearest": ScaleNearest,
+	"epx":     ScaleEPX,
+	"scale2x": ScaleEPX,
+	"hq":      ScaleHQ,
+}
+
+func ParseScaler(name string) (Scaler, error) {
+	scaler, ok := scalerNames[name]
+	if !ok {
+		names := []string{}
+		for name := range scalerNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return ScaleNearest, fmt.Errorf("unknown scaler %q (choose from %v)", name, names)
+	}
+	return scaler, nil
+}
+
+// Upscale makes an image factor times larger in each direction.
+// EPX and HQ work by doubling, so other factors are made up with nearest.
+func (s Scaler) Upscale(src *image.RGBA, factor int) *image.RGBA {
+	width, height := src.Bounds().Dx()*factor, src.Bounds().Dy()*factor
+	img := src
+	if s != ScaleNearest {
+		for doubled := 2; doubled <= factor; doubled *= 2 {
+			img = scale2x(img, s == ScaleHQ)
+		}
+	}
+	return resize(img, width, height)
+}
+
+// Fit upscales an image by the largest whole factor that fits in a
+// width by height area, and letterboxes it in the middle, so that pixels
+// stay square and evenly sized. It returns the area's image, and where
+// in it the screen went.
+func (s Scaler) Fit(src *image.RGBA, width, height int, background color.RGBA) (*image.RGBA, image.Rectangle) {
+	factor, _ := FitRect(src.Bounds().Size(), width, height)
+	return Letterbox(s.Upscale(src, factor), width, height, background)
+}
+
+// FitRect finds the largest whole factor that an image of some size can
+// be scaled up by to fit in a width by height area, and where it goes
+// when centered there. An image too big for the area keeps a factor of 1,
+// and hangs over its edges.
+func FitRect(size image.Point, width, height int) (int, image.Rectangle) {
+	factor := max(min(width/size.X, height/size.Y), 1)
+	scaled := size.Mul(factor)
+	at := image.Pt((width-scaled.X)/2, (height-scaled.Y)/2)
+	return factor, image.Rectangle{at, at.Add(scaled)}
+}
+
+// Letterbox centers an image in a width by height area, filling the rest
+// with a background color, and cropping the image if it doesn't fit.
+func Letterbox(src *image.RGBA, width, height int, background color.RGBA) (*image.RGBA, image.Rectangle) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for index := 0; index < len(img.Pix); index += 4 {
+		img.Pix[index] = background.R
+		img.Pix[index+1] = background.G
+		img.Pix[index+2] = background.B
+		img.Pix[index+3] = background.A
+	}
+	size := src.Bounds().Size()
+	at := image.Pt((width-size.X)/2, (height-size.Y)/2)
+	placed := image.Rectangle{at, at.Add(size)}.Intersect(img.Bounds())
+	for y := placed.Min.Y; y < placed.Max.Y; y++ {
+		for x := placed.Min.X; x < placed.Max.X; x++ {
+			img.SetRGBA(x, y, src.RGBAAt(x-at.X+src.Bounds().Min.X, y-at.Y+src.Bounds().Min.Y))
+		}
+	}
+	return img, placed
+}
+
+// Resizes an image to any size by picking the nearest pixel.
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return src
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		srcY := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, src.RGBAAt(bounds.Min.X+x*bounds.Dx()/width, srcY))
+		}
+	}
+	return img
+}
+
+// Doubles an image with the Scale2x/EPX rules: each pixel P becomes four,
+// and a corner takes the color of the two neighbors beside it if they
+// match each other but not the other two neighbors, as at a diagonal edge.
+//
+//	  A         1 2
+//	C P B  ->   3 4
+//	  D
+//
+// With smooth set, corners blend P with that color instead of taking it.
+func scale2x(src *image.RGBA, smooth bool) *image.RGBA {
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*2, bounds.Dy()*2))
+	at := func(x, y int) color.RGBA {
+		x = min(max(x, bounds.Min.X), bounds.Max.X-1)
+		y = min(max(y, bounds.Min.Y), bounds.Max.Y-1)
+		return src.RGBAAt(x, y)
+	}
+	corner := func(p, side1, side2, other1, other2 color.RGBA) color.RGBA {
+		if side1 != side2 || side1 == other1 || side2 == other2 {
+			return p
+		}
+		if smooth {
+			return blend(p, side1)
+		}
+		return side1
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := at(x, y)
+			a, b, c, d := at(x, y-1), at(x+1, y), at(x-1, y), at(x, y+1)
+			outX, outY := (x-bounds.Min.X)*2, (y-bounds.Min.Y)*2
+			img.SetRGBA(outX, outY, corner(p, c, a, d, b))
+			img.SetRGBA(outX+1, outY, corner(p, a, b, c, d))
+			img.SetRGBA(outX, outY+1, corner(p, d, c, b, a))
+			img.SetRGBA(outX+1, outY+1, corner(p, b, d, a, c))
+		}
+	}
+	return img
+}
+
+// Mixes two colors evenly.
+func blend(c1, c2 color.RGBA) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8((int(a) + int(b) + 1) / 2)
+	}
+	return color.RGBA{mix(c1.R, c2.R), mix(c1.G, c2.G), mix(c1.B, c2.B), mix(c1.A, c2.A)}
+}
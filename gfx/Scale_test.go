@@ -0,0 +1,131 @@
+package gfx
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+var (
+	black = rgb(0x000000)
+	white = rgb(0xFFFFFF)
+	gray  = rgb(0x808080)
+)
+
+// Makes an image from rows of '#' (white), '+' (gray) and '.' (black).
+func patternImage(rows ...string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, pixel := range row {
+			switch pixel {
+			case '#':
+				img.SetRGBA(x, y, white)
+			case '+':
+				img.SetRGBA(x, y, gray)
+			default:
+				img.SetRGBA(x, y, black)
+			}
+		}
+	}
+	return img
+}
+
+func patternRows(img *image.RGBA) string {
+	rows := []string{}
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		row := ""
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			switch img.RGBAAt(x, y) {
+			case white:
+				row += "#"
+			case black:
+				row += "."
+			default:
+				row += "+"
+			}
+		}
+		rows = append(rows, row)
+	}
+	return strings.Join(rows, "\n")
+}
+
+func TestUpscale(t *testing.T) {
+	diagonal := patternImage(
+		"#.",
+		".#",
+	)
+	tests := []struct {
+		name     string
+		scaler   Scaler
+		factor   int
+		expected string
+	}{
+		{"nearest", ScaleNearest, 2, "##..\n##..\n..##\n..##"},
+		{"nearest 3x", ScaleNearest, 3, "###...\n###...\n###...\n...###\n...###\n...###"},
+		// Each pixel's corner facing the other is cut off.
+		{"epx", ScaleEPX, 2, "##..\n#.#.\n.#.#\n..##"},
+		{"hq", ScaleHQ, 2, "##..\n#++.\n.++#\n..##"},
+	}
+	for _, test := range tests {
+		actual := patternRows(test.scaler.Upscale(diagonal, test.factor))
+		if actual != test.expected {
+			t.Errorf("%v: expected\n%v\ngot\n%v\n", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestScale2xRoundsCorners(t *testing.T) {
+	block := patternImage(
+		"....",
+		".##.",
+		".##.",
+		"....",
+	)
+	expected := "........\n........\n...##...\n..####..\n..####..\n...##...\n........\n........"
+	if actual := patternRows(ScaleEPX.Upscale(block, 2)); actual != expected {
+		t.Errorf("EPX scaled a square to\n%v\n", actual)
+	}
+	if actual := patternRows(ScaleEPX.Upscale(patternImage("###", "###"), 2)); strings.Contains(actual, ".") {
+		t.Errorf("EPX changed a flat area:\n%v\n", actual)
+	}
+}
+
+func TestFit(t *testing.T) {
+	screen := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	red := color.RGBA{255, 0, 0, 255}
+	img, placed := ScaleNearest.Fit(screen, 640, 480, red)
+
+	// 10x fills the width, leaving bars above and below.
+	if img.Bounds() != image.Rect(0, 0, 640, 480) || placed != image.Rect(0, 80, 640, 400) {
+		t.Errorf("Screen was placed at %v in %v\n", placed, img.Bounds())
+	}
+	if img.RGBAAt(0, 79) != red || img.RGBAAt(0, 80) != (color.RGBA{}) || img.RGBAAt(639, 400) != red {
+		t.Errorf("Letterbox bars are in the wrong place\n")
+	}
+
+	// Too small for even 1x, so the screen is cropped.
+	if _, placed := ScaleNearest.Fit(screen, 32, 32, red); placed != image.Rect(0, 0, 32, 32) {
+		t.Errorf("Cropped screen was placed at %v\n", placed)
+	}
+}
+
+func TestFitRect(t *testing.T) {
+	tests := []struct {
+		width, height int
+		factor        int
+		rect          image.Rectangle
+	}{
+		{640, 320, 10, image.Rect(0, 0, 640, 320)},
+		{1920, 1080, 30, image.Rect(0, 60, 1920, 1020)},
+		{700, 1000, 10, image.Rect(30, 340, 670, 660)},
+		{32, 32, 1, image.Rect(-16, 0, 48, 32)}, // Hangs over the sides.
+	}
+	for _, test := range tests {
+		factor, rect := FitRect(image.Pt(64, 32), test.width, test.height)
+		if factor != test.factor || rect != test.rect {
+			t.Errorf("In %vx%v: expected %vx at %v, got %vx at %v\n",
+				test.width, test.height, test.factor, test.rect, factor, rect)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package window
+
+import (
+	"fmt"
+	gl "github.com/go-gl/gl/v2.1/gl"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Shaders for drawing a texture on a quad. GLSL 1.20 is the oldest that
+// OpenGL 2.1 supports, so these run nearly anywhere, including software
+// renderers like Mesa's llvmpipe.
+const vertexShader = `
+#version 120
+attribute vec2 position;
+attribute vec2 texCoord;
+varying vec2 uv;
+void main() {
+	uv = texCoord;
+	gl_Position = vec4(position, 0.0, 1.0);
+}
+` + "\x00"
+
+const fragmentShader = `
+#version 120
+uniform sampler2D screen;
+varying vec2 uv;
+void main() {
+	gl_FragColor = texture2D(screen, uv);
+}
+` + "\x00"
+
+// A quad filling the viewport, as a triangle strip of x, y, u, v.
+// Images count rows down from the top, so the top of the quad is v = 0.
+var quad = []float32{
+	-1, -1, 0, 1,
+	1, -1, 1, 1,
+	-1, 1, 0, 0,
+	1, 1, 1, 0,
+}
+
+/**
+ * Datatype to describe the OpenGL objects that draw the screen: a texture
+ * holding the screen's image, uploaded whole each time it's presented,
+ * and a quad to draw it on.
+ */
+type renderer struct {
+	program   uint32
+	texture   uint32
+	quad      uint32 // Vertex buffer.
+	position  uint32 // Attribute locations in the program.
+	texCoord  uint32
+	texWidth  int // Size of the texture, to reuse it while that stays the same.
+	texHeight int
+}
+
+// Sets up the renderer, once the window's context is current.
+func makeRenderer() (*renderer, error) {
+	r := renderer{}
+	var err error
+	if r.program, err = linkProgram(vertexShader, fragmentShader); err != nil {
+		return nil, err
+	}
+	r.position = uint32(gl.GetAttribLocation(r.program, gl.Str("position\x00")))
+	r.texCoord = uint32(gl.GetAttribLocation(r.program, gl.Str("texCoord\x00")))
+
+	gl.GenBuffers(1, &r.quad)
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.quad)
+	gl.BufferData(gl.ARRAY_BUFFER, len(quad)*4, gl.Ptr(quad), gl.STATIC_DRAW)
+
+	// Scaling is done in whole pixels, so sample without blurring.
+	gl.GenTextures(1, &r.texture)
+	gl.BindTexture(gl.TEXTURE_2D, r.texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+	gl.UseProgram(r.program)
+	gl.Uniform1i(gl.GetUniformLocation(r.program, gl.Str("screen\x00")), 0)
+	return &r, nil
+}
+
+// Draws an image into part of a width by height window, with the rest
+// filled in by a background color. Areas count rows down from the top.
+func (r *renderer) present(img *image.RGBA, area image.Rectangle, width, height int, background color.RGBA) {
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.ClearColor(float32(background.R)/255, float32(background.G)/255, float32(background.B)/255, 1)
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+
+	// OpenGL counts rows up from the bottom.
+	gl.Viewport(int32(area.Min.X), int32(height-area.Max.Y), int32(area.Dx()), int32(area.Dy()))
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, r.texture)
+	size := img.Bounds().Size()
+	if size.X == r.texWidth && size.Y == r.texHeight {
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(size.X), int32(size.Y),
+			gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	} else {
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(size.X), int32(size.Y), 0,
+			gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+		r.texWidth, r.texHeight = size.X, size.Y
+	}
+
+	gl.UseProgram(r.program)
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.quad)
+	gl.EnableVertexAttribArray(r.position)
+	gl.VertexAttribPointer(r.position, 2, gl.FLOAT, false, 4*4, gl.PtrOffset(0))
+	gl.EnableVertexAttribArray(r.texCoord)
+	gl.VertexAttribPointer(r.texCoord, 2, gl.FLOAT, false, 4*4, gl.PtrOffset(2*4))
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+}
+
+func linkProgram(vertexSource, fragmentSource string) (uint32, error) {
+	vertex, err := compileShader(vertexSource, gl.VERTEX_SHADER)
+	if err != nil {
+		return 0, err
+	}
+	fragment, err := compileShader(fragmentSource, gl.FRAGMENT_SHADER)
+	if err != nil {
+		return 0, err
+	}
+
+	program := gl.CreateProgram()
+	gl.AttachShader(program, vertex)
+	gl.AttachShader(program, fragment)
+	gl.LinkProgram(program)
+	gl.DeleteShader(vertex) // Kept alive by the program.
+	gl.DeleteShader(fragment)
+
+	var status int32
+	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
+	if status == gl.FALSE {
+		var length int32
+		gl.GetProgramiv(program, gl.INFO_LOG_LENGTH, &length)
+		log := strings.Repeat("\x00", int(length)+1)
+		gl.GetProgramInfoLog(program, length, nil, gl.Str(log))
+		return 0, fmt.Errorf("shaders could not be linked: %v", strings.TrimRight(log, "\x00"))
+	}
+	return program, nil
+}
+
+func compileShader(source string, shaderType uint32) (uint32, error) {
+	shader := gl.CreateShader(shaderType)
+	sources, free := gl.Strs(source)
+	gl.ShaderSource(shader, 1, sources, nil)
+	free()
+	gl.CompileShader(shader)
+
+	var status int32
+	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
+	if status == gl.FALSE {
+		var length int32
+		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &length)
+		log := strings.Repeat("\x00", int(length)+1)
+		gl.GetShaderInfoLog(shader, length, nil, gl.Str(log))
+		return 0, fmt.Errorf("shader could not be compiled: %v", strings.TrimRight(log, "\x00"))
+	}
+	return shader, nil
+}
@@ -0,0 +1,268 @@
+// Package window shows a Chip8 screen in a GLFW window, and reads the
+// keypad and hotkeys from the keyboard.
+package window
+
+import (
+	"fmt"
+	gl "github.com/go-gl/gl/v2.1/gl"
+	glfw "github.com/go-gl/glfw/v3.2/glfw"
+	"image"
+	"image/color"
+	"jugonz/chip8/gfx"
+	"time"
+)
+
+// Arrays cannot be const in Go, so the keyboard layout is a var.
+var keyLayout = [16]glfw.Key{
+	glfw.Key0, glfw.Key1, glfw.Key2, glfw.Key3,
+	glfw.Key4, glfw.Key5, glfw.Key6, glfw.Key7,
+	glfw.Key8, glfw.Key9, glfw.KeyA, glfw.KeyB,
+	glfw.KeyC, glfw.KeyD, glfw.KeyE, glfw.KeyF,
+}
+var keyQuit = glfw.KeyEscape
+var keyFullscreen = glfw.KeyEnter
+var hotkeyLayout = [gfx.NumHotkeys]glfw.Key{
+	glfw.KeyF1, glfw.KeyF2, glfw.KeyF3, glfw.KeyF4,
+	glfw.KeyF5, glfw.KeyF6, glfw.KeyF7, glfw.KeyF8,
+	glfw.KeyF9, glfw.KeyF10, glfw.KeyF11, glfw.KeyF12,
+	glfw.KeyBackspace, glfw.KeyP, glfw.KeyN, glfw.KeyTab,
+	glfw.KeyM, glfw.KeyL,
+}
+
+// GLFW is shared by every window, so the first window to open starts it,
+// and the last one to quit stops it. Like all GLFW calls, this must only
+// happen on the main thread.
+var openWindows int
+
+type Screen struct {
+	gfx.Framebuffer
+	Width    int
+	Height   int
+	Title    string
+	Window   glfw.Window
+	Keyboard [16]bool // True if key pressed.
+
+	// Hotkeys pressed since they were last checked, and hotkeys held now.
+	Hotkeys     [gfx.NumHotkeys]bool
+	HotkeysHeld [gfx.NumHotkeys]bool
+
+	Persistence *gfx.Persistence // Keeps pixels lit for a while, if non-nil.
+	Palette     gfx.Palette
+	Scaler      gfx.Scaler // Scales the screen up to fill the window.
+	lastDraw    time.Time
+
+	renderer       *renderer
+	resized        *bool           // Set when the window changes size, shared by copies of the screen.
+	windowed       image.Rectangle // Where the window was before going fullscreen.
+	fullscreenHeld bool
+}
+
+// Color of the bars around the screen when the window is a different shape.
+var letterboxColor = color.RGBA{0, 0, 0, 255}
+
+// Shortest time between frames drawn just to fade pixels out.
+const fadeInterval = time.Second / 60
+
+func MakeScreen(width int, height int, resWidth int, resHeight int,
+	title string) Screen {
+	s := Screen{}
+	s.Framebuffer = gfx.MakeFramebuffer(resWidth, resHeight)
+	s.Width = width
+	s.Height = height
+	s.Title = title
+	s.Palette = gfx.Palettes[gfx.DefaultPalette]
+
+	s.Init()
+	return s
+}
+
+func (s *Screen) Init() {
+	// 1. Initialize GLFW and save window context.
+	// glfw.SetErrorCallback(s.GFXError)
+
+	if openWindows == 0 {
+		glfwiniterr := glfw.Init() // Init GLFW3...
+		if glfwiniterr != nil {
+			panic("GLFW3 failed to initialize!\n")
+		}
+	}
+	openWindows++
+
+	glfw.WindowHint(glfw.Resizable, glfw.True)
+	win, err := glfw.CreateWindow(s.Width, s.Height, s.Title, nil, nil)
+	if err != nil {
+		panic(fmt.Errorf("GLFW could not create window! Error: %v\n", err))
+	}
+
+	win.SetInputMode(glfw.StickyKeysMode, 1) // Turn on sticky keys to avoid callbacks!
+	win.MakeContextCurrent()
+
+	s.Window = *win
+
+	// 2. Initalize OpenGL.
+	err = gl.Init()
+	if err != nil {
+		panic("OpenGL failed to initialize!\n")
+	}
+
+	glfw.SwapInterval(1) // Use videosync. (People say it's good.)
+
+	s.renderer, err = makeRenderer()
+	if err != nil {
+		panic(fmt.Errorf("OpenGL could not set up drawing! Error: %v\n", err))
+	}
+
+	// 3. Redraw whenever the window changes size, so the bars are right.
+	resized := true
+	s.resized = &resized
+	win.SetFramebufferSizeCallback(func(w *glfw.Window, width int, height int) {
+		resized = true
+	})
+}
+
+/**
+ * Methods to implement the Drawable interface.
+ */
+func (s *Screen) Draw() {
+	var brightness [][]float64
+	if s.Persistence != nil {
+		brightness = s.Persistence.Apply(&s.Framebuffer)
+	}
+	s.lastDraw = time.Now()
+
+	width, height := s.Window.GetFramebufferSize()
+	if width <= 0 || height <= 0 {
+		return // Minimized.
+	}
+	*s.resized = false
+
+	// OpenGL scales the screen up, but only by repeating pixels, so other
+	// scalers go first. Either way, the screen lands on the same pixels.
+	screen := gfx.Render(&s.Framebuffer, brightness, s.Palette)
+	factor, area := gfx.FitRect(screen.Bounds().Size(), width, height)
+	if s.Scaler != gfx.ScaleNearest {
+		screen = s.Scaler.Upscale(screen, factor)
+	}
+	s.renderer.present(screen, area, width, height, letterboxColor)
+
+	s.Window.SwapBuffers() // Display what we just drew.
+}
+
+func (s *Screen) Image() *image.RGBA {
+	var brightness [][]float64
+	if s.Persistence != nil {
+		brightness = s.Persistence.Brightness // As last drawn.
+	}
+	return gfx.Render(&s.Framebuffer, brightness, s.Palette)
+}
+
+func (s *Screen) SetStatus(status string) {
+	if status == "" {
+		s.Window.SetTitle(s.Title)
+	} else {
+		s.Window.SetTitle(s.Title + " - " + status)
+	}
+}
+
+/**
+ * Methods to implement the Interactible interface.
+ */
+func (s *Screen) SetKeys() {
+	// Handle input ourselves!
+	glfw.PollEvents()
+	for keyNum, key := range keyLayout {
+		s.ProcessKey(keyNum, key)
+	}
+	for hotkey, key := range hotkeyLayout {
+		s.ProcessHotkey(gfx.Hotkey(hotkey), key)
+	}
+
+	fullscreen := s.Window.GetKey(keyFullscreen) == glfw.Press
+	if fullscreen && !s.fullscreenHeld {
+		s.ToggleFullscreen()
+	}
+	s.fullscreenHeld = fullscreen
+
+	// Keep fading pixels out while the game isn't drawing, and redraw
+	// after the window changes size, even while paused.
+	fading := s.Persistence != nil && !s.Persistence.Settled()
+	if (fading || *s.resized) && time.Since(s.lastDraw) >= fadeInterval {
+		s.Draw()
+	}
+
+	// Special case: if escape key is pressed, just quit.
+	if quitState := s.Window.GetKey(keyQuit); quitState == glfw.Press {
+		s.Window.SetShouldClose(true)
+	}
+}
+
+// ToggleFullscreen switches between a window and the whole of the primary
+// monitor, at the monitor's current resolution.
+func (s *Screen) ToggleFullscreen() {
+	if s.Window.GetMonitor() != nil {
+		s.Window.SetMonitor(nil, s.windowed.Min.X, s.windowed.Min.Y, s.windowed.Dx(), s.windowed.Dy(), 0)
+		return
+	}
+	x, y := s.Window.GetPos()
+	width, height := s.Window.GetSize()
+	s.windowed = image.Rect(x, y, x+width, y+height)
+
+	monitor := glfw.GetPrimaryMonitor()
+	mode := monitor.GetVideoMode()
+	s.Window.SetMonitor(monitor, 0, 0, mode.Width, mode.Height, mode.RefreshRate)
+}
+
+func (s *Screen) ProcessKey(keyNum int, key glfw.Key) {
+	action := s.Window.GetKey(key)
+
+	switch action {
+	case glfw.Press:
+		//fmt.Printf("Key %X pressed!\n", keyNum)
+		s.Keyboard[keyNum] = true
+	case glfw.Release:
+		s.Keyboard[keyNum] = false
+	default:
+		// Ignore key repeat.
+	}
+}
+
+func (s *Screen) ProcessHotkey(hotkey gfx.Hotkey, key glfw.Key) {
+	held := s.Window.GetKey(key) == glfw.Press
+	if held && !s.HotkeysHeld[hotkey] {
+		s.Hotkeys[hotkey] = true // Only count new presses.
+	}
+	s.HotkeysHeld[hotkey] = held
+}
+
+func (s *Screen) KeyPressed(key uint8) bool {
+	return s.Keyboard[key]
+}
+
+func (s *Screen) HotkeyPressed(hotkey gfx.Hotkey) bool {
+	pressed := s.Hotkeys[hotkey]
+	s.Hotkeys[hotkey] = false
+	return pressed
+}
+
+func (s *Screen) HotkeyHeld(hotkey gfx.Hotkey) bool {
+	return s.HotkeysHeld[hotkey]
+}
+
+func (s *Screen) ShouldClose() bool {
+	return s.Window.ShouldClose()
+}
+
+func (s *Screen) Quit() {
+	s.Window.Destroy()
+	openWindows--
+	if openWindows == 0 {
+		glfw.Terminate()
+	}
+}
+
+/**
+ * Utility methods used for internal GLFW state.
+ */
+// func (s *Screen) GFXError(err glfw.ErrorCode, msg string) {
+// 	panic(fmt.Errorf("GLFW Error: %v: %v\n", err, msg))
+// }
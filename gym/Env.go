@@ -0,0 +1,134 @@
+// Package gym runs Chip8 games as reinforcement-learning environments, in
+// the style of OpenAI Gym: Reset starts an episode, and Step presses a key
+// for a few frames and reports the reward. Environments have no window,
+// so any number of them can run at once, and they are deterministic for
+// a given seed and sequence of actions.
+package gym
+
+import (
+	"errors"
+	"fmt"
+	"jugonz/chip8/arch"
+	"math/rand"
+)
+
+/**
+ * Datatype to describe how to score a game. Expressions use the debugger's
+ * syntax, so they can refer to registers and to memory as mem[ADDR].
+ */
+type Game struct {
+	Name  string
+	Score string  // The reward for a step is how much this went up.
+	Done  string  // True when an episode is over.
+	Keys  []uint8 // Keys the game uses, for a small action space.
+}
+
+/**
+ * Datatype to describe what an agent sees: the screen, row by row,
+ * with 1 for lit pixels and 0 for the rest.
+ */
+type Observation [arch.ScreenWidth * arch.ScreenHeight]uint8
+
+// The action that presses no key.
+const NoKey = -1
+
+// Frames emulated per step, unless set otherwise.
+const DefaultFrameSkip = 4
+
+/**
+ * Datatype to describe an environment for one game.
+ */
+type Env struct {
+	C8        *arch.Chip8
+	Game      Game
+	FrameSkip int // Frames emulated per step, with the action's key held.
+	rom       []byte
+	score     *arch.Expr
+	done      *arch.Expr
+	lastScore int
+}
+
+func MakeEnv(rom []byte, game Game) (*Env, error) {
+	score, err := arch.ParseExpr(game.Score)
+	if err != nil {
+		return nil, fmt.Errorf("score for %v: %v", game.Name, err)
+	}
+	done, err := arch.ParseExpr(game.Done)
+	if err != nil {
+		return nil, fmt.Errorf("done for %v: %v", game.Name, err)
+	}
+
+	e := Env{Game: game, FrameSkip: DefaultFrameSkip, rom: rom, score: score, done: done}
+	e.C8 = arch.MakeChip8(false)
+	e.C8.Mute = true
+	return &e, e.C8.LoadROM(rom)
+}
+
+// Actions lists the actions worth taking: NoKey, then the game's keys.
+func (e *Env) Actions() []int {
+	actions := []int{NoKey}
+	for _, key := range e.Game.Keys {
+		actions = append(actions, int(key))
+	}
+	return actions
+}
+
+// Reset starts a new episode. Random numbers come from the seed, so
+// episodes with the same seed and actions play out the same way.
+func (e *Env) Reset(seed int64) (Observation, error) {
+	c8 := e.C8
+	c8.Reset()
+	c8.Rando = rand.New(rand.NewSource(seed))
+	c8.HeldKeys = [16]bool{}
+	if err := c8.LoadROM(e.rom); err != nil {
+		return Observation{}, err
+	}
+
+	score, err := e.score.Eval(c8)
+	e.lastScore = score
+	return e.Observe(), err
+}
+
+// Step holds down the action's key for FrameSkip frames, stopping early
+// if the episode ends. If the game crashes, the episode ends with an error.
+func (e *Env) Step(action int) (obs Observation, reward float64, done bool, err error) {
+	if action < NoKey || action > 0xF {
+		return e.Observe(), 0, false, fmt.Errorf("action %v is not a key", action)
+	}
+	c8 := e.C8
+	c8.HeldKeys = [16]bool{}
+	if action != NoKey {
+		c8.HeldKeys[action] = true
+	}
+
+	defer func() {
+		if fault := (*arch.Fault)(nil); errors.As(err, &fault) {
+			obs, done = e.Observe(), true // The game crashed.
+		}
+	}()
+	defer arch.CatchFault(&err)
+	for frame := 0; frame < e.FrameSkip && !done; frame++ {
+		c8.EmulateFrame()
+		if done, err = e.done.True(c8); err != nil {
+			return e.Observe(), 0, true, err
+		}
+	}
+
+	score, err := e.score.Eval(c8)
+	reward = float64(score - e.lastScore)
+	e.lastScore = score
+	return e.Observe(), reward, done, err
+}
+
+// Observe returns what is on the screen right now.
+func (e *Env) Observe() Observation {
+	obs := Observation{}
+	for y := 0; y < arch.ScreenHeight; y++ {
+		for x := 0; x < arch.ScreenWidth; x++ {
+			if e.C8.Screen.GetPixel(uint16(x), uint16(y)) {
+				obs[y*arch.ScreenWidth+x] = 1
+			}
+		}
+	}
+	return obs
+}
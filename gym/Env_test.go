@@ -0,0 +1,87 @@
+package gym
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func makeBrix(t *testing.T) *Env {
+	rom, err := os.ReadFile("../c8games/BRIX")
+	if err != nil {
+		t.Fatalf("Could not read BRIX! Error was: %v\n", err)
+	}
+	env, err := MakeEnv(rom, Games["BRIX"])
+	if err != nil {
+		t.Fatalf("Could not make environment! Error was: %v\n", err)
+	}
+	return env
+}
+
+// Plays an episode with random actions, returning the total reward,
+// the number of steps and the final observation.
+func play(t *testing.T, env *Env, seed int64) (float64, int, Observation) {
+	obs, err := env.Reset(seed)
+	if err != nil {
+		t.Fatalf("Reset failed! Error was: %v\n", err)
+	}
+	agent := rand.New(rand.NewSource(seed))
+	actions := env.Actions()
+	total := 0.0
+	for steps := 1; steps <= 20000; steps++ {
+		obs, reward, done, err := env.Step(actions[agent.Intn(len(actions))])
+		if err != nil {
+			t.Fatalf("Step failed! Error was: %v\n", err)
+		}
+		total += reward
+		if done {
+			return total, steps, obs
+		}
+	}
+	t.Fatalf("Episode did not end\n")
+	return total, 0, obs
+}
+
+func TestBrixEpisode(t *testing.T) {
+	env := makeBrix(t)
+	total, steps, _ := play(t, env, 1)
+	if total <= 0 {
+		t.Errorf("Random play scored %v in %v steps, expected some bricks\n", total, steps)
+	}
+	if lives := env.C8.Registers[0xE]; lives != 0 {
+		t.Errorf("Episode ended with %v lives left\n", lives)
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	first, second := makeBrix(t), makeBrix(t)
+	total1, steps1, obs1 := play(t, first, 42)
+	total2, steps2, obs2 := play(t, second, 42)
+	if total1 != total2 || steps1 != steps2 || obs1 != obs2 {
+		t.Errorf("Same seed gave %v in %v steps, then %v in %v steps\n", total1, steps1, total2, steps2)
+	}
+
+	// Instances are independent, and can be reused.
+	total3, steps3, _ := play(t, first, 42)
+	if total3 != total1 || steps3 != steps1 {
+		t.Errorf("Replaying seed 42 gave %v in %v steps, expected %v in %v\n", total3, steps3, total1, steps1)
+	}
+}
+
+func TestFrameSkipAndCrashes(t *testing.T) {
+	env := makeBrix(t)
+	env.Reset(0)
+	env.FrameSkip = 3
+	env.Step(NoKey)
+	if cycles := uint64(3 * env.C8.CyclesPerFrame()); env.C8.Cycle != cycles {
+		t.Errorf("3 frames took %v cycles, expected %v\n", env.C8.Cycle, cycles)
+	}
+	if _, _, _, err := env.Step(16); err == nil {
+		t.Errorf("Pressing key 16 should fail\n")
+	}
+
+	env.C8.PC = 0x314 // Zeroes, which are not instructions.
+	if _, _, done, err := env.Step(NoKey); !done || err == nil {
+		t.Errorf("Crashing should end the episode with an error, got done %v, error %v\n", done, err)
+	}
+}
@@ -0,0 +1,24 @@
+package gym
+
+// Scoring for games from c8games, by ROM name. Most games keep their
+// score in binary-coded decimal, as written for display by FX33.
+var Games = map[string]Game{
+	// Score is BCD at 314. Losing the last ball or clearing every brick
+	// leaves the game spinning at 2DE.
+	"BRIX": {
+		Name:  "BRIX",
+		Score: "mem[0x314]*100 + mem[0x315]*10 + mem[0x316]",
+		Done:  "PC == 0x2DE",
+		Keys:  []uint8{0x4, 0x6},
+	},
+
+	// The agent plays the left paddle. Scores are BCD at 2F2: the tens
+	// digit is the right player's and the ones digit is the left player's.
+	// The display overflows at 10, so episodes end at 9.
+	"PONG": {
+		Name:  "PONG",
+		Score: "mem[0x2F4] - mem[0x2F3]",
+		Done:  "mem[0x2F3] == 9 || mem[0x2F4] == 9",
+		Keys:  []uint8{0x1, 0x4},
+	},
+}
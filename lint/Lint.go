@@ -0,0 +1,389 @@
+// Package lint statically analyzes a Chip8 ROM before it is run.
+// It follows the control flow graph from 0x200, decoding each reachable
+// instruction with arch.Decode, and reports instructions that would make
+// the emulator panic, suspicious jumps, stack imbalances, memory accesses
+// through the index register that run past the end of memory, and
+// instructions whose behavior differs between Chip8 interpreters.
+package lint
+
+import (
+	"fmt"
+	"jugonz/chip8/arch"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Note Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Note:
+		return "note"
+	case Warning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+/**
+ * Datatype to describe a single problem found in a ROM.
+ */
+type Problem struct {
+	Addr     uint16
+	Opcode   uint16
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%03X: %04X: %v: %v", p.Addr, p.Opcode, p.Severity, p.Message)
+}
+
+const (
+	startAddr = 0x200
+	memSize   = 4096
+	stackSize = 16
+	unknownI  = -1 // Index register value that can't be determined statically.
+)
+
+/**
+ * Datatype to describe instructions whose behavior differs between Chip8
+ * interpreters, and what they do with and without the quirk (see arch.Quirks).
+ */
+type quirk struct {
+	Name    string
+	Instrs  []*arch.Instruction
+	Enabled func(q arch.Quirks) bool
+	Off     string
+	On      string
+}
+
+var quirks = []*quirk{
+	{"ShiftRight and ShiftLeft", []*arch.Instruction{&arch.InstrShiftRight, &arch.InstrShiftLeft},
+		func(q arch.Quirks) bool { return q.ShiftVY }, "shift VX in place", "shift VY into VX"},
+	{"SaveRegisters and RestoreRegisters", []*arch.Instruction{&arch.InstrSaveRegisters, &arch.InstrRestoreRegisters},
+		func(q arch.Quirks) bool { return q.IncrementIndex }, "leave I unchanged", "increment I"},
+	{"JumpIndexLiteralOffset", []*arch.Instruction{&arch.InstrJumpIndexLiteralOffset},
+		func(q arch.Quirks) bool { return q.JumpVX }, "jumps relative to V0", "jumps relative to VX"},
+	{"Or, And and Xor", []*arch.Instruction{&arch.InstrOr, &arch.InstrAnd, &arch.InstrXor},
+		func(q arch.Quirks) bool { return q.ResetVF }, "leave VF unchanged", "reset VF"},
+	{"DrawSprite", []*arch.Instruction{&arch.InstrDrawSprite},
+		func(q arch.Quirks) bool { return q.WrapSprites }, "clips sprites at the screen edge", "wraps sprites around it"},
+}
+
+// Returns the quirk that affects an instruction, or nil.
+func quirkOf(instr *arch.Instruction) *quirk {
+	for _, q := range quirks {
+		for _, affected := range q.Instrs {
+			if affected == instr {
+				return q
+			}
+		}
+	}
+	return nil
+}
+
+// Describes what a quirk's instructions do under each profile in
+// arch.QuirkProfiles, e.g. "DrawSprite clips sprites at the screen edge
+// with the default, schip and vip profiles, but wraps sprites around it
+// with xochip".
+func (q *quirk) describe() string {
+	off, on := []string{}, []string{}
+	for _, name := range arch.QuirkProfileNames() {
+		if q.Enabled(arch.QuirkProfiles[name]) {
+			on = append(on, name)
+		} else {
+			off = append(off, name)
+		}
+	}
+	switch {
+	case len(on) == 0:
+		return fmt.Sprintf("%v %v with every profile", q.Name, q.Off)
+	case len(off) == 0:
+		return fmt.Sprintf("%v %v with every profile", q.Name, q.On)
+	}
+	profiles := "profiles"
+	if len(off) == 1 {
+		profiles = "profile"
+	}
+	return fmt.Sprintf("%v %v with the %v %v, but %v with %v",
+		q.Name, q.Off, joinNames(off), profiles, q.On, joinNames(on))
+}
+
+// Joins names as in "a, b and c".
+func joinNames(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// A point in the control flow graph: an address, and the subroutine
+// it is executing in (startAddr if it's not in any subroutine).
+type location struct {
+	Sub  uint16
+	Addr uint16
+}
+
+type call struct {
+	Site   uint16
+	Callee uint16
+}
+
+type linter struct {
+	memory   [memSize]uint8
+	romEnd   int
+	indexReg map[location]int  // Known index register value at each location.
+	calls    map[uint16][]call // Subroutine to the calls made from it.
+	worklist []location
+	problems map[Problem]bool
+	quirks   map[*quirk]map[uint16]bool // Quirk to the addresses that use it.
+}
+
+// Lint analyzes the ROM and returns its problems, sorted by address.
+func Lint(rom []byte) []Problem {
+	l := linter{}
+	l.indexReg = make(map[location]int)
+	l.calls = make(map[uint16][]call)
+	l.problems = make(map[Problem]bool)
+	l.quirks = make(map[*quirk]map[uint16]bool)
+	l.romEnd = startAddr + len(rom)
+	if l.romEnd > memSize {
+		l.romEnd = memSize
+		l.report(startAddr, Error, fmt.Sprintf(
+			"ROM is %v bytes, but only %v bytes fit in memory", len(rom), memSize-startAddr))
+	}
+	copy(l.memory[startAddr:], rom)
+
+	l.visit(location{startAddr, startAddr}, unknownI)
+	for len(l.worklist) > 0 {
+		loc := l.worklist[len(l.worklist)-1]
+		l.worklist = l.worklist[:len(l.worklist)-1]
+		l.step(loc)
+	}
+	l.checkCallDepth()
+	l.reportQuirks()
+
+	problems := []Problem{}
+	for problem := range l.problems {
+		problems = append(problems, problem)
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Addr != problems[j].Addr {
+			return problems[i].Addr < problems[j].Addr
+		}
+		if problems[i].Severity != problems[j].Severity {
+			return problems[i].Severity > problems[j].Severity
+		}
+		return problems[i].Message < problems[j].Message
+	})
+	return problems
+}
+
+func (l *linter) report(addr uint16, severity Severity, message string) {
+	l.problems[Problem{addr, l.opcode(addr), severity, message}] = true
+}
+
+// Returns the opcode at addr, or 0 if it lies outside of memory.
+func (l *linter) opcode(addr uint16) uint16 {
+	if int(addr)+1 >= memSize {
+		return 0
+	}
+	return uint16(l.memory[addr])<<8 | uint16(l.memory[addr+1])
+}
+
+// Queues a location to be analyzed, if we haven't already analyzed it
+// with the same knowledge of the index register.
+func (l *linter) visit(loc location, index int) {
+	old, seen := l.indexReg[loc]
+	if seen && (old == index || old == unknownI) {
+		return
+	}
+	if seen {
+		index = unknownI // Reached with two different values.
+	}
+	l.indexReg[loc] = index
+	l.worklist = append(l.worklist, loc)
+}
+
+// Checks a control flow target, returning whether it's safe to follow.
+func (l *linter) checkTarget(addr, target uint16, kind string) bool {
+	if target < startAddr || int(target)+1 >= memSize {
+		l.report(addr, Error, fmt.Sprintf(
+			"%v to %03X, outside of program memory", kind, target))
+		return false
+	}
+	if target%2 != 0 {
+		l.report(addr, Warning, fmt.Sprintf(
+			"%v to odd address %03X", kind, target))
+	}
+	if int(target) >= l.romEnd {
+		l.report(addr, Warning, fmt.Sprintf(
+			"%v to %03X, past the end of the ROM", kind, target))
+	}
+	return true
+}
+
+// Checks an access of length bytes of memory starting at the index register.
+func (l *linter) checkIndex(addr uint16, index, length int, kind string) {
+	if index != unknownI && index+length > memSize {
+		l.report(addr, Error, fmt.Sprintf(
+			"%v %v bytes at I=%03X, past the end of memory", kind, length, index))
+	}
+}
+
+func (l *linter) step(loc location) {
+	addr := loc.Addr
+	index := l.indexReg[loc]
+	if int(addr)+1 >= memSize {
+		l.report(addr, Error, "execution runs past the end of memory")
+		return
+	}
+	if int(addr) >= l.romEnd {
+		l.report(addr, Warning, "execution runs past the end of the ROM")
+	}
+
+	op := arch.MakeOpcode(l.opcode(addr))
+	instr := arch.Decode(op)
+	next := func(offset uint16, index int) {
+		l.visit(location{loc.Sub, addr + offset}, index)
+	}
+
+	if q := quirkOf(instr); q != nil {
+		if l.quirks[q] == nil {
+			l.quirks[q] = make(map[uint16]bool)
+		}
+		l.quirks[q][addr] = true
+	}
+
+	switch instr {
+	case &arch.InstrUnknownInstruction:
+		l.report(addr, Error, "unknown instruction")
+	case &arch.InstrCallRCA1802:
+		l.report(addr, Error, "RCA 1802 machine code calls are unimplemented")
+	case &arch.InstrJump:
+		if op.Literal == addr {
+			return // Self-jumps halt the program.
+		}
+		if l.checkTarget(addr, op.Literal, "jump") {
+			l.visit(location{loc.Sub, op.Literal}, index)
+		}
+	case &arch.InstrJumpIndexLiteralOffset:
+		l.report(addr, Note, fmt.Sprintf(
+			"computed jump from %03X can't be followed", op.Literal))
+		if int(op.Literal)+0xFF+1 >= memSize {
+			l.report(addr, Warning, fmt.Sprintf(
+				"computed jump from %03X may leave memory", op.Literal))
+		}
+	case &arch.InstrCall:
+		if l.checkTarget(addr, op.Literal, "call") {
+			l.addCall(loc.Sub, call{addr, op.Literal})
+			l.visit(location{op.Literal, op.Literal}, index)
+		}
+		next(2, unknownI) // The subroutine may change I.
+	case &arch.InstrReturn:
+		if loc.Sub == startAddr {
+			l.report(addr, Error,
+				"return outside of any subroutine, with an empty stack")
+		}
+	case &arch.InstrSkipInstrEqualLiteral, &arch.InstrSkipInstrNotEqualLiteral,
+		&arch.InstrSkipInstrEqualReg, &arch.InstrSkipInstrNotEqualReg,
+		&arch.InstrSkipInstrKeyPressed, &arch.InstrSkipInstrKeyNotPressed:
+		next(2, index)
+		next(4, index)
+	case &arch.InstrSetIndexLiteral:
+		next(2, int(op.Literal))
+	case &arch.InstrAddRegisterToIndex, &arch.InstrSetIndexToSprite:
+		next(2, unknownI)
+	case &arch.InstrDrawSprite:
+		l.checkIndex(addr, index, int(op.Value&0xF), "sprite reads")
+		next(2, index)
+	case &arch.InstrSaveBinaryCodedDecimal:
+		l.checkIndex(addr, index, 3, "BCD writes")
+		next(2, index)
+	case &arch.InstrSaveRegisters:
+		l.checkIndex(addr, index, int(op.Xreg)+1, "register save writes")
+		next(2, index)
+	case &arch.InstrRestoreRegisters:
+		l.checkIndex(addr, index, int(op.Xreg)+1, "register restore reads")
+		next(2, index)
+	default:
+		next(2, index)
+	}
+}
+
+// Notes each quirk once, at the first address that uses it, so that a ROM
+// full of sprites doesn't get a note for every DrawSprite.
+func (l *linter) reportQuirks() {
+	for q, used := range l.quirks {
+		addrs := []uint16{}
+		for addr := range used {
+			addrs = append(addrs, addr)
+		}
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+		message := q.describe()
+		if len(addrs) > 1 {
+			message += fmt.Sprintf(" (used in %v places)", len(addrs))
+		}
+		l.report(addrs[0], Note, message)
+	}
+}
+
+func (l *linter) addCall(caller uint16, c call) {
+	for _, known := range l.calls[caller] {
+		if known == c {
+			return
+		}
+	}
+	l.calls[caller] = append(l.calls[caller], c)
+}
+
+// Reports recursion, and call chains deeper than the Chip8 stack.
+func (l *linter) checkCallDepth() {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := map[uint16]int{}
+	depth := map[uint16]int{} // Deepest call chain starting at a subroutine.
+	recursive := false
+
+	var walk func(sub uint16) int
+	walk = func(sub uint16) int {
+		state[sub] = active
+		deepest := 0
+		for _, c := range l.calls[sub] {
+			d := 0
+			switch state[c.Callee] {
+			case active:
+				l.report(c.Site, Warning, fmt.Sprintf(
+					"recursive call to %03X may overflow the stack", c.Callee))
+				recursive = true
+			case done:
+				d = depth[c.Callee] + 1
+			default:
+				d = walk(c.Callee) + 1
+			}
+			if d > deepest {
+				deepest = d
+			}
+		}
+		state[sub] = done
+		depth[sub] = deepest
+		return deepest
+	}
+
+	// Recursion already makes the depth unbounded, so don't report it twice.
+	if deepest := walk(startAddr); deepest > stackSize && !recursive {
+		l.report(startAddr, Error, fmt.Sprintf(
+			"subroutine calls nest %v deep, but the stack only holds %v", deepest, stackSize))
+	}
+}
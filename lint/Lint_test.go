@@ -0,0 +1,110 @@
+package lint
+
+import (
+	"jugonz/chip8/archtest"
+	"strings"
+	"testing"
+)
+
+// Returns the first problem at addr with the given severity, or nil.
+func find(problems []Problem, addr uint16, severity Severity) *Problem {
+	for _, problem := range problems {
+		if problem.Addr == addr && problem.Severity == severity {
+			return &problem
+		}
+	}
+	return nil
+}
+
+func TestLintCleanROM(t *testing.T) {
+	problems := Lint(archtest.Rom([]uint16{
+		0x2206, // 200: Call 206.
+		0x1202, // 202: Loop forever.
+		0x0000, // 204: Unreachable, so not reported.
+		0x6001, // 206: Set V0 to 1.
+		0x00EE, // 208: Return.
+	}))
+	if len(problems) != 0 {
+		t.Errorf("Clean ROM had problems: %v\n", problems)
+	}
+}
+
+func TestLintRejectedOpcodes(t *testing.T) {
+	problems := Lint(archtest.Rom([]uint16{
+		0x3000, // 200: Skip the next instruction if V0 is 0.
+		0x8008, // 202: Unknown instruction.
+		0x0123, // 204: RCA 1802 call.
+	}))
+	if find(problems, 0x202, Error) == nil {
+		t.Errorf("Unknown instruction was not reported! Problems were: %v\n", problems)
+	}
+	if find(problems, 0x204, Error) == nil {
+		t.Errorf("RCA 1802 call was not reported! Problems were: %v\n", problems)
+	}
+}
+
+func TestLintControlFlow(t *testing.T) {
+	problems := Lint(archtest.Rom([]uint16{
+		0x3000, // 200: Skip the next instruction if V0 is 0.
+		0x1207, // 202: Jump to an odd address.
+		0x3000, // 204: Skip the next instruction if V0 is 0.
+		0x1100, // 206: Jump into the interpreter's memory.
+		0x3000, // 208: Skip the next instruction if V0 is 0.
+		0x00EE, // 20A: Return without a call.
+		0x120C, // 20C: Halt.
+	}))
+	if find(problems, 0x202, Warning) == nil {
+		t.Errorf("Odd jump was not reported! Problems were: %v\n", problems)
+	}
+	if find(problems, 0x206, Error) == nil {
+		t.Errorf("Out of range jump was not reported! Problems were: %v\n", problems)
+	}
+	if find(problems, 0x20A, Error) == nil {
+		t.Errorf("Unbalanced return was not reported! Problems were: %v\n", problems)
+	}
+}
+
+func TestLintIndexRegister(t *testing.T) {
+	problems := Lint(archtest.Rom([]uint16{
+		0xAFFE, // 200: Point I two bytes before the end of memory.
+		0xD005, // 202: Draw a 5-byte sprite.
+		0x1204, // 204: Halt.
+	}))
+	problem := find(problems, 0x202, Error)
+	if problem == nil {
+		t.Fatalf("Out of range sprite was not reported! Problems were: %v\n", problems)
+	}
+	if !strings.Contains(problem.Message, "FFE") {
+		t.Errorf("Problem did not report the index register: %v\n", problem)
+	}
+	if find(problems, 0x202, Note) == nil {
+		t.Errorf("Quirky DrawSprite was not noted! Problems were: %v\n", problems)
+	}
+}
+
+func TestLintQuirks(t *testing.T) {
+	problems := Lint(archtest.Rom([]uint16{
+		0x8016, // 200: Shift V0 right.
+		0x801E, // 202: Shift V0 left.
+		0x8016, // 204: Shift V0 right again.
+		0x8011, // 206: Or V0 with V1.
+		0x1208, // 208: Halt.
+	}))
+	notes := []Problem{}
+	for _, problem := range problems {
+		if problem.Severity == Note {
+			notes = append(notes, problem)
+		}
+	}
+	if len(notes) != 2 || notes[0].Addr != 0x200 || notes[1].Addr != 0x206 {
+		t.Fatalf("Quirks were not noted once each! Problems were: %v\n", problems)
+	}
+	expected := "ShiftRight and ShiftLeft shift VX in place with the default and schip " +
+		"profiles, but shift VY into VX with vip and xochip (used in 3 places)"
+	if notes[0].Message != expected {
+		t.Errorf("Shift note was %q\n", notes[0].Message)
+	}
+	if !strings.Contains(notes[1].Message, "default, schip and xochip profiles, but reset VF with vip") {
+		t.Errorf("Or note was %q\n", notes[1].Message)
+	}
+}
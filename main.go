@@ -1,30 +1,525 @@
 package main
 
 import (
+	"embed"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/fs"
 	"jugonz/chip8/arch"
+	"jugonz/chip8/batch"
+	"jugonz/chip8/conformance"
+	"jugonz/chip8/control"
+	"jugonz/chip8/dap"
+	"jugonz/chip8/gdb"
+	"jugonz/chip8/gfx"
+	"jugonz/chip8/gfx/window"
+	"jugonz/chip8/lint"
+	"jugonz/chip8/patch"
+	"jugonz/chip8/roms"
+	"net"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 var path = flag.String("path", "", "path to a Chip8 ROM")
+var romName = flag.String("rom", "", "name of a built-in game to play, like BRIX (see \"chip8 list\")")
 var debug = flag.Bool("debug", false, "debug mode")
-var chip8 arch.Arch
+var profile = flag.Bool("profile", false, "print a hot-spot report on exit")
+var pprofPath = flag.String("pprof", "", "write a pprof profile to this file on exit")
+var coverage = flag.String("coverage", "", "write a code/data coverage map to this file on exit")
+var cheats = flag.String("cheats", "", "cheat file to load (default: the ROM path plus \".cheats\")")
+var debugger = flag.Bool("debugger", false, "start paused, with a debugger console on stdin")
+var gdbAddr = flag.String("gdb", "", "start paused, serving the GDB remote protocol on this address (like localhost:1234)")
+var dapAddr = flag.String("dap", "", "serve the Debug Adapter Protocol on \"stdio\" or this address, for editors to launch ROMs")
+var controlAddr = flag.String("control", "", "serve JSON-RPC commands for scripts on this address (like localhost:6502, or unix:/path/to/socket)")
+var quirks = flag.String("quirks", "default", "interpreter whose quirks to copy: "+strings.Join(arch.QuirkProfileNames(), ", "))
+var fastForward = flag.Float64("fastforward", arch.DefaultFastForward, "speed multiple while fast-forwarding")
+var persistence = flag.String("persistence", "off", "keep pixels lit after they turn off, to hide flicker: off, fade or or (lit in either of the last two frames)")
+var fadeFrames = flag.Int("fade", 4, "frames pixels take to fade out, with -persistence=fade")
+var palette = flag.String("palette", "", "colors to show the screen in: "+strings.Join(gfx.PaletteNames(), ", ")+", or one from -palettes (default: the ROM's entry in -palettes, or "+gfx.DefaultPalette+")")
+var paletteConfig = flag.String("palettes", "", "JSON file of extra palettes, and the palette for each ROM")
+var scaler = flag.String("scaler", "nearest", "how to scale the screen up to fill the window: nearest, epx (also called scale2x) or hq")
+var romDir = flag.String("roms", "", "directory of games for the menu (L), which opens at startup if no game is given (default: the built-in games)")
+var rewind = flag.Float64("rewind", 10, "seconds of gameplay that can be rewound (0 to disable)")
+var patches patchList
+
+func init() {
+	flag.Var(&patches, "patch", "IPS or BPS patch to apply to the ROM (may be repeated)")
+}
+
+// The games in c8games, built into the executable so that they can be
+// played from anywhere.
+//
+//go:embed c8games
+var embedded embed.FS
+
+func library() fs.FS {
+	games, _ := fs.Sub(embedded, "c8games")
+	return games
+}
+
+// A flag that may be given more than once.
+type patchList []string
+
+func (p *patchList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patchList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
 
 func main() {
 	flag.Parse()
-	if *path == "" {
-		fmt.Printf("No Chip8 file path provided, quitting!\n")
+	switch flag.Arg(0) {
+	case "lint":
+		os.Exit(lintCommand(flag.Args()[1:]))
+	case "patch":
+		os.Exit(patchCommand(flag.Args()[1:]))
+	case "batch":
+		os.Exit(batchCommand(flag.Args()[1:]))
+	case "test":
+		os.Exit(testCommand(flag.Args()[1:]))
+	case "list":
+		os.Exit(listCommand(flag.Args()[1:]))
+	}
+
+	openMenu := *path == "" && *romName == "" && *dapAddr == "" && *controlAddr == ""
+	menuDir := library()
+	if *romDir != "" {
+		menuDir = os.DirFS(*romDir)
+	}
+	menu, err := arch.MakeMenu(menuDir)
+	if err != nil && openMenu {
+		where := *romDir
+		if where == "" {
+			where = "the built-in games"
+		}
+		fmt.Printf("No Chip8 file path provided, and no games found in %v, quitting!\n", where)
 		return
 	}
+	var rom []byte
+	if *romName != "" {
+		if *path != "" {
+			fmt.Printf("Error: Only one of -path and -rom can be given!\n")
+			os.Exit(2)
+		}
+		rom, err = readBuiltIn(*romName)
+		if err != nil {
+			fmt.Printf("Error: %v! Run \"chip8 list\" to see the built-in games.\n", err)
+			os.Exit(2)
+		}
+		*path = *romName // For palettes, cheats and profiles.
+	} else if *path != "" {
+		rom, _ = os.ReadFile(*path)
+	}
+	dapOut := os.Stdout
+	if *dapAddr == "stdio" {
+		os.Stdout = os.Stderr // Keep messages out of the protocol.
+	}
 
-	runtime.LockOSThread()         // OpenGL requires code to be run on main thread.
-	chip8 = arch.MakeChip8(*debug) // DEBUG on.
+	runtime.LockOSThread() // OpenGL requires code to be run on main thread.
+	c8 := arch.MakeChip8(*debug)
+	quirkProfile, ok := arch.QuirkProfiles[*quirks]
+	if !ok {
+		fmt.Printf("Error: Unknown quirks %q! Choose from: %v\n", *quirks, strings.Join(arch.QuirkProfileNames(), ", "))
+		os.Exit(2)
+	}
+	c8.Quirks = quirkProfile
+	c8.FastForward = *fastForward
+	persistenceMode, err := gfx.ParsePersistenceMode(*persistence)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	screenScaler, err := gfx.ParseScaler(*scaler)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	screen := window.MakeScreen(640, 480, arch.ScreenWidth, arch.ScreenHeight, "Chip-8 Emulator")
+	if persistenceMode != gfx.PersistenceOff {
+		screen.Persistence = gfx.MakePersistence(persistenceMode, *fadeFrames, arch.ScreenWidth, arch.ScreenHeight)
+	}
+	screen.Palette = choosePalette(rom)
+	screen.Scaler = screenScaler
+	c8.Screen = &screen
+	c8.Controller = &screen
+	if *profile || *pprofPath != "" {
+		c8.Profiler = arch.MakeProfiler()
+	}
+	if *coverage != "" {
+		c8.Coverage = arch.MakeCoverage()
+	}
+	if *rewind > 0 {
+		c8.Rewind = arch.MakeRewind(*rewind)
+	}
+	if menu != nil {
+		c8.Menu = menu
+		menu.Launched = func(name string, rom []byte) {
+			builtIn := *romDir == ""
+			*path = name // For palettes, cheats and profiles.
+			if !builtIn {
+				*path = filepath.Join(*romDir, name)
+			}
+			screen.Palette = choosePalette(rom)
+			loadCheats(c8, builtIn)
+		}
+	}
+	if *debugger {
+		c8.Debugger = arch.MakeDebugger(os.Stdin, os.Stdout)
+		c8.History = arch.MakeHistory()
+		c8.Paused = true
+	}
+	if *gdbAddr != "" {
+		listener, err := net.Listen("tcp", *gdbAddr)
+		if err != nil {
+			fmt.Printf("Error: Could not listen for GDB! Error was: %v\n", err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+		c8.Tasks = make(chan func(c8 *arch.Chip8))
+		if c8.History == nil {
+			c8.History = arch.MakeHistory()
+		}
+		server := gdb.MakeServer(c8)
+		go server.Serve(listener)
+		c8.Paused = true
+		fmt.Printf("Waiting for GDB on %v.\n", listener.Addr())
+	}
+	var dapServer *dap.Server
+	if *dapAddr != "" {
+		if c8.Tasks == nil {
+			c8.Tasks = make(chan func(c8 *arch.Chip8))
+		}
+		if c8.History == nil {
+			c8.History = arch.MakeHistory()
+		}
+		dapServer = dap.MakeServer(c8)
+		c8.Paused = true
+		if err := serveDAP(c8, dapServer, dapOut); err != nil {
+			fmt.Printf("Error: Could not listen for an editor! Error was: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *controlAddr != "" {
+		listener, err := control.Listen(*controlAddr)
+		if err != nil {
+			fmt.Printf("Error: Could not listen for commands! Error was: %v\n", err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+		if c8.Tasks == nil {
+			c8.Tasks = make(chan func(c8 *arch.Chip8))
+		}
+		go control.MakeServer(c8).Serve(listener)
+		fmt.Printf("Listening for commands on %v.\n", listener.Addr())
+	}
+	var chip8 arch.Arch = c8
 
-	chip8.LoadGame(*path)
+	if *romName != "" {
+		if err := c8.LoadGameBytes(*romName, rom, patches...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		loadCheats(c8, true)
+	} else if *path != "" {
+		if err := chip8.LoadGame(*path, patches...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		loadCheats(c8, false)
+	} else if openMenu {
+		c8.OpenMenu()
+	}
+	if *debugger {
+		fmt.Printf("Paused at 200. Type \"help\" for debugger commands.\n(chip8) ")
+	}
 
 	chip8.Run() // Terminates when the quit key is pressed.
+	if dapServer != nil {
+		dapServer.Terminated()
+	}
 
 	chip8.Quit()
 	runtime.UnlockOSThread()
+
+	if c8.Profiler != nil {
+		writeProfile(c8.Profiler)
+	}
+	if c8.Coverage != nil {
+		writeCoverage(c8)
+	}
+}
+
+// Serves a single editor in the background, on stdio or a socket,
+// and quits once it disconnects.
+func serveDAP(c8 *arch.Chip8, server *dap.Server, stdout *os.File) error {
+	stop := func() { c8.Do(func(c8 *arch.Chip8) { c8.Stop = true }) }
+	if *dapAddr == "stdio" {
+		go func() {
+			server.Serve(os.Stdin, stdout)
+			stop()
+		}()
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", *dapAddr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Waiting for an editor on %v.\n", listener.Addr())
+	go func() {
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		server.Serve(conn, conn)
+		stop()
+	}()
+	return nil
+}
+
+// Reads a built-in game, finding it by name as for the menu.
+func readBuiltIn(name string) ([]byte, error) {
+	found, err := roms.Find(library(), name)
+	if err != nil {
+		return nil, err
+	}
+	*romName = found
+	return fs.ReadFile(library(), found)
+}
+
+// Picks the palette from -palette, or the ROM's entry in -palettes.
+func choosePalette(rom []byte) gfx.Palette {
+	var config *gfx.PaletteConfig
+	if *paletteConfig != "" {
+		loaded, err := gfx.LoadPaletteConfig(*paletteConfig)
+		if err != nil {
+			fmt.Printf("Error: Palettes could not be loaded! Error was: %v\n", err)
+		}
+		config = loaded
+	}
+
+	name := *palette
+	if name == "" {
+		if romPalette, ok := config.ForROM(*path, rom); ok {
+			name = romPalette
+		} else {
+			name = gfx.DefaultPalette
+		}
+	}
+	chosen, ok := config.Palette(name)
+	if !ok {
+		fmt.Printf("Error: Unknown palette %q, using %v.\n", name, gfx.DefaultPalette)
+		chosen = gfx.Palettes[gfx.DefaultPalette]
+	}
+	return chosen
+}
+
+// Loads cheats from -cheats, or beside the ROM. Built-in games have
+// nowhere to keep cheats beside them, so they only use -cheats.
+func loadCheats(c8 *arch.Chip8, builtIn bool) {
+	cheatPath := *cheats
+	if cheatPath == "" {
+		if builtIn {
+			return
+		}
+		cheatPath = arch.CheatFilePath(*path)
+	}
+
+	loaded, err := arch.LoadCheats(cheatPath)
+	if err != nil {
+		// A missing cheat file is only a problem if one was asked for.
+		if *cheats != "" || !os.IsNotExist(err) {
+			fmt.Printf("Error: Cheats could not be loaded! Error was: %v\n", err)
+		}
+		return
+	}
+	c8.Cheats = loaded
+	fmt.Printf("Loaded %v cheats from %v.\n", len(loaded.Named), cheatPath)
+}
+
+func writeProfile(profiler *arch.Profiler) {
+	if *profile {
+		profiler.Report(os.Stdout, 20)
+	}
+	if *pprofPath != "" {
+		file, err := os.Create(*pprofPath)
+		if err != nil {
+			fmt.Printf("Error: Profile could not be written! Error was: %v\n", err)
+			return
+		}
+		defer file.Close()
+
+		if err := profiler.WritePprof(file, *path); err != nil {
+			fmt.Printf("Error: Profile could not be written! Error was: %v\n", err)
+		}
+	}
+}
+
+func writeCoverage(c8 *arch.Chip8) {
+	c8.Coverage.Summary(os.Stdout, 0x200, c8.RomSize)
+	if err := c8.Coverage.Save(*coverage, 0x200, c8.RomSize); err != nil {
+		fmt.Printf("Error: Coverage could not be written! Error was: %v\n", err)
+	}
+}
+
+// Usage: chip8 lint path/to/rom...
+// Exits with status 1 if any ROM has errors.
+func lintCommand(paths []string) int {
+	if len(paths) == 0 {
+		fmt.Printf("No Chip8 file paths provided to lint, quitting!\n")
+		return 2
+	}
+
+	status := 0
+	for _, romPath := range paths {
+		rom, err := os.ReadFile(romPath)
+		if err != nil {
+			fmt.Printf("Error: File at %v could not be read! Error was: %v\n", romPath, err)
+			status = 1
+			continue
+		}
+
+		counts := map[lint.Severity]int{}
+		for _, problem := range lint.Lint(rom) {
+			fmt.Printf("%v:%v\n", romPath, problem)
+			counts[problem.Severity]++
+		}
+		fmt.Printf("%v: %v errors, %v warnings, %v notes\n", romPath,
+			counts[lint.Error], counts[lint.Warning], counts[lint.Note])
+		if counts[lint.Error] > 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+// Usage: chip8 patch create path/to/original path/to/modified path/to/patch.{ips,bps}
+func patchCommand(args []string) int {
+	if len(args) != 4 || args[0] != "create" {
+		fmt.Printf("Usage: chip8 patch create ORIGINAL MODIFIED OUTPUT.{ips,bps}\n")
+		return 2
+	}
+
+	original, err := os.ReadFile(args[1])
+	if err != nil {
+		fmt.Printf("Error: File at %v could not be read! Error was: %v\n", args[1], err)
+		return 1
+	}
+	modified, err := os.ReadFile(args[2])
+	if err != nil {
+		fmt.Printf("Error: File at %v could not be read! Error was: %v\n", args[2], err)
+		return 1
+	}
+
+	patchData, err := patch.Create(original, modified, args[3])
+	if err == nil {
+		err = os.WriteFile(args[3], patchData, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error: Patch could not be created! Error was: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %v byte patch to %v.\n", len(patchData), args[3])
+	return 0
+}
+
+// Usage: chip8 batch [-j workers] [-o results.json] manifest.json
+// Exits with status 1 if any run failed.
+func batchCommand(args []string) int {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	workers := flags.Int("j", runtime.NumCPU(), "number of runs to execute at once")
+	output := flags.String("o", "", "write results to this file instead of stdout")
+	flags.Parse(args)
+	if flags.NArg() != 1 || *workers < 1 {
+		fmt.Printf("Usage: chip8 batch [-j WORKERS] [-o RESULTS.json] MANIFEST.json\n")
+		return 2
+	}
+
+	manifest, err := batch.LoadManifest(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: Manifest could not be loaded! Error was: %v\n", err)
+		return 1
+	}
+	results := batch.ExecuteAll(manifest.Runs, *workers)
+
+	data, _ := json.MarshalIndent(results, "", "\t")
+	data = append(data, '\n')
+	if *output == "" {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Printf("Error: Results could not be written! Error was: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if *output != "" {
+		fmt.Printf("%v runs, %v failed. Results are in %v.\n", len(results), failed, *output)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Usage: chip8 test [-cycles N] [-quirks NAME] path/to/test/rom...
+// Exits with status 1 if any test failed or could not be checked.
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	maxCycles := flags.Uint64("cycles", conformance.DefaultMaxCycles, "cycles to wait for each test to halt")
+	testQuirks := flags.String("quirks", *quirks, "interpreter whose quirks to copy: "+strings.Join(arch.QuirkProfileNames(), ", "))
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Printf("Usage: chip8 test [-cycles N] [-quirks NAME] ROM...\n")
+		return 2
+	}
+	quirkProfile, ok := arch.QuirkProfiles[*testQuirks]
+	if !ok {
+		fmt.Printf("Error: Unknown quirks %q! Choose from: %v\n", *testQuirks, strings.Join(arch.QuirkProfileNames(), ", "))
+		return 2
+	}
+
+	results := []conformance.Result{}
+	failed := false
+	for _, romPath := range flags.Args() {
+		result := conformance.RunTest(romPath, *maxCycles, quirkProfile)
+		results = append(results, result)
+		failed = failed || !result.Passed
+	}
+	conformance.PrintTable(os.Stdout, results)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// Usage: chip8 list [path/to/rom/directory]
+// Lists the built-in games, or the games in a directory.
+func listCommand(args []string) int {
+	if len(args) > 1 {
+		fmt.Printf("Usage: chip8 list [DIRECTORY]\n")
+		return 2
+	}
+	dir := library()
+	if len(args) == 1 {
+		dir = os.DirFS(args[0])
+	}
+	if err := roms.PrintList(os.Stdout, dir); err != nil {
+		fmt.Printf("Error: Games could not be listed! Error was: %v\n", err)
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,207 @@
+package patch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+/**
+ * BPS patches describe the target file as a series of actions that copy
+ * from the source file, from earlier in the target, or from the patch.
+ * They end with CRC32 checksums of the source, target and patch, which
+ * we validate so a patch is never applied to the wrong ROM.
+ */
+
+const bpsHeader = "BPS1"
+
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+const bpsFooterSize = 12 // Three CRC32s.
+
+func ApplyBPS(rom, patch []byte) ([]byte, error) {
+	if len(patch) < len(bpsHeader)+bpsFooterSize {
+		return nil, fmt.Errorf("BPS patch is too short")
+	}
+	footer := patch[len(patch)-bpsFooterSize:]
+	sourceCRC := binary.LittleEndian.Uint32(footer[0:])
+	targetCRC := binary.LittleEndian.Uint32(footer[4:])
+	patchCRC := binary.LittleEndian.Uint32(footer[8:])
+
+	if crc := crc32.ChecksumIEEE(patch[:len(patch)-4]); crc != patchCRC {
+		return nil, fmt.Errorf("BPS patch is corrupt (checksum %08X, expected %08X)", crc, patchCRC)
+	}
+	if crc := crc32.ChecksumIEEE(rom); crc != sourceCRC {
+		return nil, fmt.Errorf("BPS patch is for a different ROM (checksum %08X, expected %08X)",
+			crc, sourceCRC)
+	}
+
+	r := bpsReader{data: patch[:len(patch)-bpsFooterSize], pos: len(bpsHeader)}
+	sourceSize := r.number()
+	targetSize := r.number()
+	metadataSize := r.number()
+	r.skip(metadataSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != uint64(len(rom)) {
+		return nil, fmt.Errorf("BPS patch expects a %v byte ROM, got %v bytes", sourceSize, len(rom))
+	}
+	if targetSize > 1<<24 {
+		return nil, fmt.Errorf("BPS patch target is too large (%v bytes)", targetSize)
+	}
+
+	out := make([]byte, 0, targetSize)
+	var sourceOffset, targetOffset int64
+	for r.err == nil && r.pos < len(r.data) {
+		data := r.number()
+		length := int(data>>2) + 1
+		if uint64(len(out)+length) > targetSize {
+			return nil, fmt.Errorf("BPS patch writes past the end of its target")
+		}
+
+		switch data & 3 {
+		case bpsSourceRead:
+			if len(out)+length > len(rom) {
+				return nil, fmt.Errorf("BPS patch reads past the end of its source")
+			}
+			out = append(out, rom[len(out):len(out)+length]...)
+		case bpsTargetRead:
+			out = append(out, r.bytes(length)...)
+		case bpsSourceCopy:
+			sourceOffset += r.signed()
+			if sourceOffset < 0 || sourceOffset+int64(length) > int64(len(rom)) {
+				return nil, fmt.Errorf("BPS patch copies from outside of its source")
+			}
+			out = append(out, rom[sourceOffset:sourceOffset+int64(length)]...)
+			sourceOffset += int64(length)
+		case bpsTargetCopy:
+			targetOffset += r.signed()
+			if targetOffset < 0 || targetOffset >= int64(len(out)) {
+				return nil, fmt.Errorf("BPS patch copies from outside of its target")
+			}
+			// Copy a byte at a time, since the copy may overlap what it writes.
+			for i := 0; i < length; i++ {
+				out = append(out, out[targetOffset])
+				targetOffset++
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if uint64(len(out)) != targetSize {
+		return nil, fmt.Errorf("BPS patch produced %v bytes, expected %v", len(out), targetSize)
+	}
+	if crc := crc32.ChecksumIEEE(out); crc != targetCRC {
+		return nil, fmt.Errorf("BPS patch produced the wrong ROM (checksum %08X, expected %08X)",
+			crc, targetCRC)
+	}
+	return out, nil
+}
+
+// CreateBPS makes a patch from runs of bytes that are either unchanged
+// from the source or stored literally in the patch.
+func CreateBPS(original, modified []byte) []byte {
+	patch := []byte(bpsHeader)
+	patch = bpsAppendNumber(patch, uint64(len(original)))
+	patch = bpsAppendNumber(patch, uint64(len(modified)))
+	patch = bpsAppendNumber(patch, 0) // No metadata.
+
+	same := func(i int) bool {
+		return i < len(original) && original[i] == modified[i]
+	}
+	for start := 0; start < len(modified); {
+		end := start + 1
+		for end < len(modified) && same(end) == same(start) {
+			end++
+		}
+		action := uint64(bpsTargetRead)
+		if same(start) {
+			action = bpsSourceRead
+		}
+		patch = bpsAppendNumber(patch, uint64(end-start-1)<<2|action)
+		if action == bpsTargetRead {
+			patch = append(patch, modified[start:end]...)
+		}
+		start = end
+	}
+
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(original))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(modified))
+	return binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+}
+
+// BPS numbers are a variable-length encoding with no redundant forms.
+func bpsAppendNumber(out []byte, x uint64) []byte {
+	for {
+		b := byte(x & 0x7F)
+		x >>= 7
+		if x == 0 {
+			return append(out, b|0x80)
+		}
+		out = append(out, b)
+		x--
+	}
+}
+
+type bpsReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bpsReader) number() uint64 {
+	var data, shift uint64 = 0, 1
+	for r.err == nil {
+		if r.pos >= len(r.data) {
+			r.err = fmt.Errorf("BPS patch is truncated")
+			break
+		}
+		b := r.data[r.pos]
+		r.pos++
+		data += uint64(b&0x7F) * shift
+		if b&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		data += shift
+		if shift > 1<<56 {
+			r.err = fmt.Errorf("BPS patch has an invalid number")
+		}
+	}
+	return data
+}
+
+// Relative offsets store their sign in the lowest bit.
+func (r *bpsReader) signed() int64 {
+	data := r.number()
+	if data&1 != 0 {
+		return -int64(data >> 1)
+	}
+	return int64(data >> 1)
+}
+
+func (r *bpsReader) bytes(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("BPS patch is truncated")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *bpsReader) skip(n uint64) {
+	if n > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("BPS patch is truncated")
+		return
+	}
+	r.pos += int(n)
+}
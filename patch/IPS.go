@@ -0,0 +1,125 @@
+package patch
+
+import (
+	"fmt"
+)
+
+/**
+ * IPS patches are a list of records, each replacing bytes at a 24-bit
+ * offset, either with literal bytes or with a run of a single byte.
+ * We also support the common extension of a 24-bit length after the
+ * end-of-file marker, which truncates the patched file.
+ */
+
+const (
+	ipsHeader    = "PATCH"
+	ipsFooter    = "EOF"
+	ipsEOFOffset = 0x454F46 // "EOF" read as an offset.
+	ipsMaxRecord = 0xFFFF
+)
+
+func ApplyIPS(rom, patch []byte) ([]byte, error) {
+	out := append([]byte{}, rom...)
+	pos := len(ipsHeader)
+	read := func(n int) (int, error) {
+		if pos+n > len(patch) {
+			return 0, fmt.Errorf("IPS patch is truncated at offset %v", pos)
+		}
+		value := 0
+		for _, b := range patch[pos : pos+n] {
+			value = value<<8 | int(b)
+		}
+		pos += n
+		return value, nil
+	}
+	write := func(offset int, data []byte) {
+		if end := offset + len(data); end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], data)
+	}
+
+	for {
+		offset, err := read(3)
+		if err != nil {
+			return nil, err
+		}
+		if offset == ipsEOFOffset {
+			break
+		}
+		size, err := read(2)
+		if err != nil {
+			return nil, err
+		}
+
+		if size > 0 {
+			if pos+size > len(patch) {
+				return nil, fmt.Errorf("IPS patch is truncated at offset %v", pos)
+			}
+			write(offset, patch[pos:pos+size])
+			pos += size
+		} else { // A run-length encoded record.
+			runLength, err := read(2)
+			if err != nil {
+				return nil, err
+			}
+			value, err := read(1)
+			if err != nil {
+				return nil, err
+			}
+			run := make([]byte, runLength)
+			for i := range run {
+				run[i] = byte(value)
+			}
+			write(offset, run)
+		}
+	}
+
+	// Truncation extension.
+	if len(patch)-pos == 3 {
+		length, _ := read(3)
+		if length < len(out) {
+			out = out[:length]
+		}
+	}
+	return out, nil
+}
+
+func CreateIPS(original, modified []byte) ([]byte, error) {
+	patch := []byte(ipsHeader)
+	put := func(value, n int) {
+		for shift := 8 * (n - 1); shift >= 0; shift -= 8 {
+			patch = append(patch, byte(value>>shift))
+		}
+	}
+
+	for offset := 0; offset < len(modified); {
+		if offset < len(original) && original[offset] == modified[offset] {
+			offset++
+			continue
+		}
+
+		// Extend the record over every differing (or new) byte.
+		end := offset
+		for end < len(modified) && end-offset < ipsMaxRecord &&
+			(end >= len(original) || original[end] != modified[end]) {
+			end++
+		}
+		if offset == ipsEOFOffset {
+			offset-- // That offset would read as the footer; start a byte early.
+		}
+		if offset > 0xFFFFFF {
+			return nil, fmt.Errorf("file is too large for an IPS patch")
+		}
+		put(offset, 3)
+		put(end-offset, 2)
+		patch = append(patch, modified[offset:end]...)
+		offset = end
+	}
+
+	patch = append(patch, ipsFooter...)
+	if len(modified) < len(original) {
+		put(len(modified), 3)
+	}
+	return patch, nil
+}
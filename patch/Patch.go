@@ -0,0 +1,36 @@
+// Package patch applies and creates IPS and BPS patches, so that fixed or
+// translated versions of a ROM can be shared without sharing the ROM itself.
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Apply patches rom with an IPS or BPS patch, detected by its header.
+// The rom slice is not modified.
+func Apply(rom, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte(ipsHeader)):
+		return ApplyIPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte(bpsHeader)):
+		return ApplyBPS(rom, patch)
+	default:
+		return nil, fmt.Errorf("unknown patch format (expected an IPS or BPS header)")
+	}
+}
+
+// Create makes a patch that turns original into modified. The format
+// ("ips" or "bps") is chosen from the extension of the output path.
+func Create(original, modified []byte, outputPath string) ([]byte, error) {
+	switch ext := strings.ToLower(filepath.Ext(outputPath)); ext {
+	case ".ips":
+		return CreateIPS(original, modified)
+	case ".bps":
+		return CreateBPS(original, modified), nil
+	default:
+		return nil, fmt.Errorf("unknown patch format %q (expected .ips or .bps)", ext)
+	}
+}
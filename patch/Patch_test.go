@@ -0,0 +1,121 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+// Returns pairs of ROMs to diff: a real game, and edited copies of it.
+func testROMs(t *testing.T) (original []byte, modified [][]byte) {
+	original, err := os.ReadFile("../c8games/PONG2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := append([]byte{}, original...)
+	changed[0x10] ^= 0xFF
+	changed[0x11] ^= 0xFF
+	changed[len(changed)-1] ^= 0x01
+
+	longer := append(append([]byte{}, original...), 0xDE, 0xAD, 0xBE, 0xEF)
+	shorter := append([]byte{}, original[:len(original)/2]...)
+	return original, [][]byte{original, changed, longer, shorter}
+}
+
+func TestIPSRoundTrip(t *testing.T) {
+	original, modified := testROMs(t)
+	for index, target := range modified {
+		ips, err := Create(original, target, "fix.ips")
+		if err != nil {
+			t.Fatalf("Could not create IPS patch %v! Error was: %v\n", index, err)
+		}
+		patched, err := Apply(original, ips)
+		if err != nil {
+			t.Fatalf("Could not apply IPS patch %v! Error was: %v\n", index, err)
+		}
+		if !bytes.Equal(patched, target) {
+			t.Errorf("IPS patch %v did not produce the modified ROM!\n", index)
+		}
+	}
+}
+
+func TestIPSRunLength(t *testing.T) {
+	// A run of 4 0xAA bytes at offset 2, then the end of the patch.
+	ips := []byte("PATCH\x00\x00\x02\x00\x00\x00\x04\xAAEOF")
+	patched, err := ApplyIPS([]byte{1, 2, 3}, ips)
+	if err != nil {
+		t.Fatalf("Could not apply IPS patch! Error was: %v\n", err)
+	}
+	if !bytes.Equal(patched, []byte{1, 2, 0xAA, 0xAA, 0xAA, 0xAA}) {
+		t.Errorf("IPS run was not applied correctly! Result was %X\n", patched)
+	}
+}
+
+func TestBPSRoundTrip(t *testing.T) {
+	original, modified := testROMs(t)
+	for index, target := range modified {
+		bps, err := Create(original, target, "fix.bps")
+		if err != nil {
+			t.Fatalf("Could not create BPS patch %v! Error was: %v\n", index, err)
+		}
+		patched, err := Apply(original, bps)
+		if err != nil {
+			t.Fatalf("Could not apply BPS patch %v! Error was: %v\n", index, err)
+		}
+		if !bytes.Equal(patched, target) {
+			t.Errorf("BPS patch %v did not produce the modified ROM!\n", index)
+		}
+	}
+}
+
+func TestBPSCopies(t *testing.T) {
+	// Source "ABCD", target "CDCDCDx": a source copy from offset 2,
+	// a target copy of the 2 bytes just written, then a literal "x".
+	bps := []byte(bpsHeader)
+	bps = bpsAppendNumber(bps, 4)
+	bps = bpsAppendNumber(bps, 7)
+	bps = bpsAppendNumber(bps, 0)
+	bps = bpsAppendNumber(bps, (2-1)<<2|bpsSourceCopy)
+	bps = bpsAppendNumber(bps, 2<<1) // Source offset +2.
+	bps = bpsAppendNumber(bps, (4-1)<<2|bpsTargetCopy)
+	bps = bpsAppendNumber(bps, 0) // Target offset +0.
+	bps = bpsAppendNumber(bps, (1-1)<<2|bpsTargetRead)
+	bps = append(bps, 'x')
+	bps = appendCRCs(bps, []byte("ABCD"), []byte("CDCDCDx"))
+
+	patched, err := ApplyBPS([]byte("ABCD"), bps)
+	if err != nil {
+		t.Fatalf("Could not apply BPS patch! Error was: %v\n", err)
+	}
+	if string(patched) != "CDCDCDx" {
+		t.Errorf("BPS copies were not applied correctly! Result was %q\n", patched)
+	}
+}
+
+func TestBPSChecksums(t *testing.T) {
+	original, modified := testROMs(t)
+	bps := CreateBPS(original, modified[1])
+
+	// Applying to a different ROM of the same size must fail.
+	wrongROM := append([]byte{}, original...)
+	wrongROM[0] ^= 0xFF
+	if _, err := ApplyBPS(wrongROM, bps); err == nil {
+		t.Errorf("BPS patch was applied to the wrong ROM!\n")
+	}
+
+	// A corrupted patch must fail.
+	corrupt := append([]byte{}, bps...)
+	corrupt[len(bpsHeader)+4] ^= 0xFF
+	if _, err := ApplyBPS(original, corrupt); err == nil {
+		t.Errorf("Corrupt BPS patch was applied!\n")
+	}
+}
+
+func appendCRCs(patch, source, target []byte) []byte {
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(source))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(target))
+	return binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+}
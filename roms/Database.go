@@ -0,0 +1,77 @@
+// Package roms describes Chip8 games: what they are, how to play them,
+// and where to find them.
+package roms
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+/**
+ * Datatype to describe a game in the ROM database, for menus and listings.
+ * Keys are the Chip8 keypad's, as printed on it (0-9 and A-F).
+ */
+type Info struct {
+	Title       string
+	Description string
+	Keys        string
+}
+
+// Games in c8games, by ROM name.
+var Database = map[string]Info{
+	"15PUZZLE": {"15 Puzzle", "Slide the numbered tiles back into order.",
+		"The keypad matches the grid: press a tile's key to slide it into the gap."},
+	"BLINKY": {"Blinky", "Eat every dot in the maze, and stay away from the ghosts.",
+		"3 up, 6 down, 7 left, 8 right."},
+	"BLITZ": {"Blitz", "Fly over a city, flattening it with bombs so that you can land.",
+		"5 drops a bomb."},
+	"BRIX": {"Brix", "Knock out every brick with the ball, like Breakout.",
+		"4 left, 6 right."},
+	"CONNECT4": {"Connect 4", "Two players take turns dropping counters, to line up four of theirs.",
+		"4 left, 6 right, 5 drops a counter."},
+	"GUESS": {"Guess", "Think of a number up to 63, and the game finds it from the grids it shows.",
+		"5 if your number is shown, any other key if not."},
+	"HIDDEN": {"Hidden", "Turn over cards two at a time to find the matching pairs.",
+		"2 up, 8 down, 4 left, 6 right, 5 turns a card over."},
+	"INVADERS": {"Space Invaders", "Shoot the invaders before they land.",
+		"4 left, 6 right, 5 fires (and starts the game)."},
+	"KALEID": {"Kaleidoscope", "Draw a pattern, which is mirrored into all four corners.",
+		"2 up, 8 down, 4 left, 6 right, 0 repeats the pattern."},
+	"MAZE": {"Maze", "Draws a random maze, over and over.",
+		"None."},
+	"MERLIN": {"Merlin", "Watch the squares light up, then repeat them in the same order.",
+		"4 5 7 8 are the four squares."},
+	"MISSILE": {"Missile Command", "Fire missiles from a moving launcher to hit the targets.",
+		"8 fires."},
+	"PONG": {"Pong", "Two-player table tennis.",
+		"Left player 1 up, 4 down. Right player C up, D down."},
+	"PONG2": {"Pong 2", "Two-player table tennis, with a net and tidier scoring.",
+		"Left player 1 up, 4 down. Right player C up, D down."},
+	"PUZZLE": {"Puzzle", "Slide the tiles back into order.",
+		"2 up, 8 down, 4 left, 6 right."},
+	"SYZYGY": {"Syzygy", "Steer a growing snake to the targets without hitting anything.",
+		"3 up, 6 down, 7 left, 8 right. E starts without a border, F with one."},
+	"TANK": {"Tank", "Drive a tank around and shoot the moving target.",
+		"2 down, 8 up, 4 left, 6 right, 5 fires."},
+	"TETRIS": {"Tetris", "Fit the falling blocks together into full lines.",
+		"4 rotates, 5 left, 6 right, 1 drops."},
+	"TICTAC": {"Tic-Tac-Toe", "Two players take turns at noughts and crosses.",
+		"1-9 pick a square, as on a phone."},
+	"UFO": {"UFO", "Shoot down the UFOs flying overhead.",
+		"4 fires left, 5 up, 6 right."},
+	"VBRIX": {"Vertical Brix", "Brix on its side, with the paddle on the left.",
+		"1 up, 4 down, 7 starts."},
+	"VERS": {"Vers", "Two players leave walls behind them; the first to crash loses.",
+		"Left player 7 left, A right, 1 up, 2 down. Right player B left, F right, C up, D down."},
+	"WIPEOFF": {"Wipe Off", "Wipe the dots off the screen by bouncing the ball into them.",
+		"4 left, 6 right."},
+}
+
+// Lookup finds a game by its ROM's path or file name, ignoring case and
+// any extension, so that "games/brix.ch8" finds BRIX.
+func Lookup(path string) (Info, bool) {
+	name := filepath.Base(path)
+	name = strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+	info, ok := Database[name]
+	return info, ok
+}
@@ -0,0 +1,83 @@
+package roms
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Largest ROM that fits in memory after the interpreter's 512 bytes.
+const MaxSize = 4096 - 0x200
+
+// Files kept beside ROMs that aren't ROMs themselves.
+var notROMs = map[string]bool{
+	".bps": true, ".cheats": true, ".go": true, ".ips": true, ".json": true,
+	".map": true, ".md": true, ".png": true, ".txt": true, ".8o": true,
+}
+
+// List finds the ROMs in the top level of a directory, sorted by name.
+// Hidden files, files too big to be ROMs, and files that go with ROMs
+// (like cheats, patches and source maps) are left out.
+func List(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") ||
+			notROMs[strings.ToLower(path.Ext(name))] {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || info.Size() == 0 || info.Size() > MaxSize {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Find looks up a game in a directory by name, ignoring case and any
+// extension, so that "brix" finds BRIX and "pong" finds pong.ch8.
+func Find(fsys fs.FS, name string) (string, error) {
+	names, err := List(fsys)
+	if err != nil {
+		return "", err
+	}
+	for _, romName := range names {
+		if strings.EqualFold(romName, name) ||
+			strings.EqualFold(strings.TrimSuffix(romName, path.Ext(romName)), name) {
+			return romName, nil
+		}
+	}
+	return "", fmt.Errorf("no game named %q", name)
+}
+
+// PrintList writes the games in a directory, with their descriptions and
+// controls from the database, to w.
+func PrintList(w io.Writer, fsys fs.FS) error {
+	names, err := List(fsys)
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for _, name := range names {
+		info, ok := Lookup(name)
+		if !ok {
+			fmt.Fprintf(w, "%-*v  No description.\n", width, name)
+			continue
+		}
+		fmt.Fprintf(w, "%-*v  %v: %v\n", width, name, info.Title, info.Description)
+		fmt.Fprintf(w, "%-*v  Keys: %v\n", width, "", info.Keys)
+	}
+	return nil
+}
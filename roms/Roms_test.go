@@ -0,0 +1,90 @@
+package roms
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDatabaseCoversGames(t *testing.T) {
+	names, err := List(os.DirFS("../c8games"))
+	if err != nil {
+		t.Fatalf("Could not list c8games: %v\n", err)
+	}
+	if len(names) != len(Database) {
+		t.Errorf("Found %v games, but the database has %v\n", len(names), len(Database))
+	}
+	for _, name := range names {
+		if info, ok := Lookup(name); !ok || info.Title == "" || info.Keys == "" {
+			t.Errorf("%v is missing from the database\n", name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, path := range []string{"BRIX", "brix.ch8", "games/Brix.c8"} {
+		if info, ok := Lookup(path); !ok || info.Title != "Brix" {
+			t.Errorf("%v: expected Brix, got %v\n", path, info)
+		}
+	}
+	if _, ok := Lookup("NOTAGAME"); ok {
+		t.Errorf("Found a game that doesn't exist\n")
+	}
+}
+
+func TestList(t *testing.T) {
+	rom := &fstest.MapFile{Data: []byte{0x12, 0x00}}
+	fsys := fstest.MapFS{
+		"PONG":        rom,
+		"game.ch8":    rom,
+		"BRIX":        rom,
+		"BRIX.cheats": &fstest.MapFile{Data: []byte("Lives: V3=3\n")},
+		"fix.ips":     rom,
+		".hidden":     rom,
+		"empty":       &fstest.MapFile{},
+		"huge":        &fstest.MapFile{Data: make([]byte, MaxSize+1)},
+		"dir/INSIDE":  rom,
+		"notes.md":    rom,
+		"program.8o":  rom,
+		"HUGE_BUT_OK": &fstest.MapFile{Data: make([]byte, MaxSize)},
+	}
+	names, err := List(fsys)
+	if err != nil {
+		t.Fatalf("Could not list: %v\n", err)
+	}
+	expected := []string{"BRIX", "HUGE_BUT_OK", "PONG", "game.ch8"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v\n", expected, names)
+	}
+}
+
+func TestFind(t *testing.T) {
+	rom := &fstest.MapFile{Data: []byte{0x12, 0x00}}
+	fsys := fstest.MapFS{"BRIX": rom, "pong.ch8": rom, "BRIX.cheats": rom}
+	for name, expected := range map[string]string{"BRIX": "BRIX", "brix": "BRIX", "PONG": "pong.ch8", "pong.ch8": "pong.ch8"} {
+		if found, err := Find(fsys, name); err != nil || found != expected {
+			t.Errorf("%v: expected %v, got %v (%v)\n", name, expected, found, err)
+		}
+	}
+	for _, name := range []string{"TETRIS", "BRIX.cheats", ""} {
+		if found, err := Find(fsys, name); err == nil {
+			t.Errorf("%v: expected no game, got %v\n", name, found)
+		}
+	}
+}
+
+func TestPrintList(t *testing.T) {
+	rom := &fstest.MapFile{Data: []byte{0x12, 0x00}}
+	out := &strings.Builder{}
+	if err := PrintList(out, fstest.MapFS{"BRIX": rom, "mygame.ch8": rom}); err != nil {
+		t.Fatalf("Could not list: %v\n", err)
+	}
+	expected := "BRIX        Brix: Knock out every brick with the ball, like Breakout.\n" +
+		"            Keys: 4 left, 6 right.\n" +
+		"mygame.ch8  No description.\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%v\ngot:\n%v\n", expected, out.String())
+	}
+}